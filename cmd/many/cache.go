@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+const cacheUsage = "usage: many cache ls|prune|clear [-cache-dir DIR] [-older-than DURATION]\n"
+
+func runCache(args []string) {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	dir := fs.String("cache-dir", "", "source cache directory (default $XDG_CACHE_HOME/many)")
+	olderThan := fs.Duration("older-than", 30*24*time.Hour, "prune entries not used within this duration")
+	_ = fs.Parse(args[1:])
+
+	if *dir == "" {
+		d, err := resolve.DefaultCacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		*dir = d
+	}
+	c := &resolve.Cache{Dir: *dir}
+
+	var err error
+	switch args[0] {
+	case "ls":
+		err = listCache(c)
+	case "prune":
+		var n int
+		n, err = c.Prune(*olderThan)
+		if err == nil {
+			fmt.Printf("removed %d entries\n", n)
+		}
+	case "clear":
+		err = c.Clear()
+	default:
+		fmt.Fprint(os.Stderr, cacheUsage)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func listCache(c *resolve.Cache) error {
+	entries, err := c.List()
+	if err != nil {
+		return err //nolint:wrapcheck // already wrapped by resolve
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KEY\tSIZE\tLAST USED\tURI\tPIN")
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			e.Key[:min(12, len(e.Key))], e.Size, e.LastUsed.Format(time.RFC3339), resolve.RedactURL(e.URI), e.Pin)
+	}
+	return w.Flush() //nolint:wrapcheck // stdout
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/systemstart/many-templates/pkg/logging"
+	"github.com/systemstart/many-templates/pkg/processing"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+const lockUsage = "usage: many lock update -input DIR [-max-depth N]\n"
+
+// runLock rewrites the many.lock file of a local input directory.
+func runLock(args []string) {
+	if len(args) < 1 || args[0] != "update" {
+		fmt.Fprint(os.Stderr, lockUsage)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("lock update", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, lockUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&inputDirectory, "input", "", "input directory")
+	fs.StringVar(&inputDirectory, "input-directory", "", "input directory (alias for -input)")
+	fs.IntVar(&maxDepth, "max-depth", -1, "max directory recursion depth (-1 = unlimited, 0 = root only)")
+	fs.StringVar(&envFile, "env-file", "", "load environment variables from file")
+	fs.BoolVar(&noCache, "no-cache", false, "disable the persistent source cache")
+	fs.StringVar(&cacheDir, "cache-dir", "", "source cache directory (default $XDG_CACHE_HOME/many)")
+	fs.StringVar(&httpCredentialsFile, "http-credentials", "", "per-host credentials for https sources")
+	fs.DurationVar(&sourceTimeout, "source-timeout", resolve.DefaultTimeout, "time limit for fetching a single source (0 = none)")
+	fs.IntVar(&retries, "retries", resolve.DefaultRetryPolicy.Attempts-1, "retries of https downloads after transient errors")
+	fs.StringVar(&loggingType, "logging-type", "tint", "logging type: json, text or tint")
+	fs.StringVar(&logLevel, "log-level", "info", "logging level: debug, info, warn, error")
+	_ = fs.Parse(args[1:])
+
+	if inputDirectory == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	_ = logging.Initialize(loggingType, logLevel)
+
+	if resolve.IsRemote(inputDirectory) {
+		slog.Error("many lock update needs a local input directory", "input", inputDirectory)
+		exit(exitLockFailed)
+	}
+
+	includeEnv()
+	setupCache()
+	setupNetwork()
+	setupHTTPCredentials()
+	defer runCleanups()
+
+	n, err := processing.UpdateLock(runCtx, inputDirectory, maxDepth)
+	if err != nil {
+		slog.Error("failed to update lock file", "error", err)
+		exit(exitLockFailed)
+	}
+	slog.Info("updated lock file", "sources", n)
+}
+
+// setupLock checks sources against the input's many.lock, if it has one.
+// With -locked the lock file is required and any difference is an error.
+func setupLock() {
+	if err := processing.UseLock(inputDirectory, locked); err != nil {
+		slog.Error("failed to load lock file", "error", err)
+		exit(exitLockFailed)
+	}
+}
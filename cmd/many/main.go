@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
 	"runtime/debug"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/systemstart/many-templates/pkg/api"
@@ -47,6 +49,16 @@ const (
 	exitLoadInstancesFailed
 	exitInstanceInputNotADirectory
 	exitInstancesIncompatibleFlags
+	exitPlanFailed
+	exitPlanHasChanges
+	exitPushFailed
+	exitLoadHTTPCredentialsFailed
+	exitInterrupted
+	exitVendorFailed
+	exitLockFailed
+	exitUpdateFailed
+	exitRehashFailed
+	exitRehashHasChanges
 )
 
 var (
@@ -62,6 +74,18 @@ var (
 	showVersion              bool
 	envFile                  string
 	noSHA256Update           bool
+	parallelism              int
+	noCache                  bool
+	cacheDir                 string
+	dryRun                   bool
+	planFormat               string
+	pushRef                  string
+	httpCredentialsFile      string
+	sourceTimeout            time.Duration
+	retries                  int
+	offline                  bool
+	vendorDir                string
+	locked                   bool
 )
 
 func init() {
@@ -130,61 +154,182 @@ func init() {
 		"no-sha256-update",
 		false,
 		"disable sha256 writeback to .many.yaml files")
+	flag.IntVar(
+		&parallelism,
+		"parallelism",
+		runtime.GOMAXPROCS(0),
+		"maximum number of pipelines to run concurrently")
+	flag.BoolVar(
+		&noCache,
+		"no-cache",
+		false,
+		"disable the persistent source cache")
+	flag.StringVar(
+		&cacheDir,
+		"cache-dir",
+		"",
+		"source cache directory (default $XDG_CACHE_HOME/many)")
+	flag.BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"render into a temporary directory and diff against the output directory without touching it")
+	flag.StringVar(
+		&planFormat,
+		"plan-format",
+		"text",
+		"plan output format for -dry-run: text or json")
+	flag.StringVar(
+		&pushRef,
+		"push",
+		"",
+		"push the output directory as an OCI artifact to this reference after rendering (oci://registry/repo:tag)")
+	flag.StringVar(
+		&httpCredentialsFile,
+		"http-credentials",
+		"",
+		"per-host credentials for https sources (default $XDG_CONFIG_HOME/many/credentials.yaml if it exists)")
+	flag.DurationVar(
+		&sourceTimeout,
+		"source-timeout",
+		resolve.DefaultTimeout,
+		"time limit for fetching a single source unless it sets its own timeout (0 = none)")
+	flag.IntVar(
+		&retries,
+		"retries",
+		resolve.DefaultRetryPolicy.Attempts-1,
+		"retries of https downloads after connection errors, 5xx and 429 responses")
+	flag.BoolVar(
+		&offline,
+		"offline",
+		false,
+		"serve all sources from -vendor-dir and fail on any that are missing")
+	flag.StringVar(
+		&vendorDir,
+		"vendor-dir",
+		"",
+		"vendor directory written by 'many vendor', used with -offline")
+	flag.BoolVar(
+		&locked,
+		"locked",
+		false,
+		"fail if a source is missing from the input's many.lock or resolves to different content")
 }
 
+const pullUsage = "usage: many pull [-no-cache] [-cache-dir DIR] <ref> <dir>\n"
+
 func runPull(args []string) {
-	if len(args) != 2 {
-		fmt.Fprintf(os.Stderr, "usage: many pull <ref> <dir>\n")
+	fs := flag.NewFlagSet("pull", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, pullUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&envFile, "env-file", "", "load environment variables from file")
+	fs.BoolVar(&noCache, "no-cache", false, "disable the persistent source cache")
+	fs.StringVar(&cacheDir, "cache-dir", "", "source cache directory (default $XDG_CACHE_HOME/many)")
+	fs.StringVar(&httpCredentialsFile, "http-credentials", "", "per-host credentials for https sources")
+	fs.DurationVar(&sourceTimeout, "source-timeout", resolve.DefaultTimeout, "time limit for fetching the source (0 = none)")
+	fs.IntVar(&retries, "retries", resolve.DefaultRetryPolicy.Attempts-1, "retries of https downloads after transient errors")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
 		os.Exit(1)
 	}
-	ref, dir := args[0], args[1]
+	ref, dir := fs.Arg(0), fs.Arg(1)
+
+	includeEnv()
+	setupCache()
+	setupNetwork()
+	setupHTTPCredentials()
 
-	resolved, cleanup, _, err := resolve.Resolve(ref, "")
+	resolved, cleanup, _, err := resolve.Resolve(runCtx, ref, "")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
-	if cleanup != nil {
-		defer cleanup()
+		exit(1)
 	}
+	onExit(cleanup)
 
 	if err := processing.CopyTree(resolved, dir); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
+	runCleanups()
 }
 
 func main() {
-	if len(os.Args) >= 2 && os.Args[1] == "pull" {
-		runPull(os.Args[2:])
-		return
+	handleSignals()
+
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case "pull":
+			runPull(os.Args[2:])
+			return
+		case "push":
+			runPush(os.Args[2:])
+			return
+		case "cache":
+			runCache(os.Args[2:])
+			return
+		case "schema":
+			runSchema(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "vendor":
+			runVendor(os.Args[2:])
+			return
+		case "lock":
+			runLock(os.Args[2:])
+			return
+		case "update":
+			runUpdate(os.Args[2:])
+			return
+		case "rehash":
+			runRehash(os.Args[2:])
+			return
+		case "plan":
+			dryRun = true
+			_ = flag.CommandLine.Parse(os.Args[2:])
+		}
 	}
 
-	flag.Parse()
+	if !flag.Parsed() {
+		flag.Parse()
+	}
 
 	if showVersion {
 		fmt.Println(version)
 		os.Exit(0)
 	}
 
-	_ = logging.Initialize(loggingType, logLevel)
+	if dryRun {
+		// Keep stdout free for the plan itself.
+		_ = logging.InitializeWriter(os.Stderr, loggingType, logLevel)
+	} else {
+		_ = logging.Initialize(loggingType, logLevel)
+	}
 
 	includeEnv()
-	cleanup := checkInputDirectory()
-	ctxCleanup := resolveContextFile()
-	instCleanup := resolveInstancesFile()
-	defer func() {
-		for _, fn := range []func(){cleanup, ctxCleanup, instCleanup} {
-			if fn != nil {
-				fn()
-			}
-		}
-	}()
-	ensureOutputDirectory()
+	setupCache()
+	setupNetwork()
+	setupHTTPCredentials()
+	setupVendor()
+	onExit(checkInputDirectory())
+	setupLock()
+	onExit(resolveContextFile())
+	onExit(resolveInstancesFile())
+	defer runCleanups()
+	if dryRun {
+		onExit(preparePlanOutput())
+	} else {
+		ensureOutputDirectory()
+	}
 
 	if instancesFile != "" && processingFile != "" {
 		slog.Error("-instances and -processing are mutually exclusive")
-		os.Exit(exitInstancesIncompatibleFlags)
+		exit(exitInstancesIncompatibleFlags)
 	}
 
 	globalContext := loadGlobalContext()
@@ -197,6 +342,14 @@ func main() {
 		runDiscoveryMode(globalContext)
 	}
 
+	if dryRun {
+		if reportPlan() {
+			exit(exitPlanHasChanges)
+		}
+		return
+	}
+
+	pushOutput()
 	slog.Info("done")
 }
 
@@ -204,7 +357,7 @@ func runInstancesMode(globalContext map[string]any) {
 	cfg, err := api.LoadInstances(instancesFile)
 	if err != nil {
 		slog.Error("failed to load instances file", "filename", instancesFile, "error", err)
-		os.Exit(exitLoadInstancesFailed)
+		exit(exitLoadInstancesFailed)
 	}
 
 	// Validate instance input directories exist (skip remote URIs — resolved at processing time).
@@ -219,30 +372,84 @@ func runInstancesMode(globalContext map[string]any) {
 		st, err := os.Stat(instInputDir)
 		if err != nil || !st.IsDir() {
 			slog.Error("instance input is not a directory", "instance", inst.Name, "path", instInputDir)
-			os.Exit(exitInstanceInputNotADirectory)
+			exit(exitInstanceInputNotADirectory)
 		}
 	}
 
-	if err := processing.RunInstances(cfg, inputDirectory, outputDirectory, globalContext, maxDepth, !noSHA256Update); err != nil {
+	if err := processing.RunInstances(runCtx, cfg, inputDirectory, outputDirectory, globalContext, maxDepth, !noSHA256Update, parallelism); err != nil {
 		slog.Error("instances processing failed", "error", err)
-		os.Exit(exitToolErrors)
+		exit(exitToolErrors)
 	}
 }
 
 func runSinglePipeline(globalContext map[string]any) {
-	err := processing.RunSingle(processingFile, inputDirectory, outputDirectory, globalContext, !noSHA256Update)
+	err := processing.RunSingle(runCtx, processingFile, inputDirectory, outputDirectory, globalContext, !noSHA256Update)
 	if err != nil {
 		slog.Error("pipeline failed", "error", err)
-		os.Exit(exitToolErrors)
+		exit(exitToolErrors)
 	}
 }
 
 func runDiscoveryMode(globalContext map[string]any) {
-	err := processing.RunAll(inputDirectory, outputDirectory, globalContext, maxDepth, !noSHA256Update)
+	err := processing.RunAll(runCtx, inputDirectory, outputDirectory, globalContext, maxDepth, !noSHA256Update, parallelism)
 	if err != nil {
 		slog.Error("processing failed", "error", err)
-		os.Exit(exitToolErrors)
+		exit(exitToolErrors)
+	}
+}
+
+// setupCache installs the persistent source cache unless -no-cache is given.
+// Failing to open the cache is not fatal; sources are then always fetched.
+func setupCache() {
+	if noCache {
+		return
+	}
+	dir := cacheDir
+	if dir == "" {
+		var err error
+		if dir, err = resolve.DefaultCacheDir(); err != nil {
+			slog.Warn("source cache disabled", "error", err)
+			return
+		}
+	}
+	c, err := resolve.OpenCache(dir)
+	if err != nil {
+		slog.Warn("source cache disabled", "directory", dir, "error", err)
+		return
+	}
+	resolve.SetCache(c)
+}
+
+// setupNetwork applies -source-timeout and -retries to the resolvers.
+func setupNetwork() {
+	resolve.SetTimeout(sourceTimeout)
+	policy := resolve.DefaultRetryPolicy
+	policy.Attempts = max(retries, 0) + 1
+	resolve.SetRetryPolicy(policy)
+}
+
+// setupHTTPCredentials installs the per-host credentials for https sources
+// from -http-credentials, or from the default location if that file exists.
+// It runs after -env-file is loaded so the file can reference its variables.
+func setupHTTPCredentials() {
+	file := httpCredentialsFile
+	if file == "" {
+		def, err := resolve.DefaultHTTPCredentialsFile()
+		if err != nil {
+			return
+		}
+		if _, err := os.Stat(def); err != nil {
+			return
+		}
+		file = def
+	}
+	creds, err := resolve.LoadHTTPCredentials(file)
+	if err != nil {
+		slog.Error("failed to load http credentials", "file", file, "error", err)
+		exit(exitLoadHTTPCredentialsFailed)
 	}
+	resolve.SetHTTPCredentials(creds)
+	slog.Debug("loaded http credentials", "file", file, "hosts", len(creds.Hosts))
 }
 
 func loadGlobalContext() map[string]any {
@@ -253,7 +460,7 @@ func loadGlobalContext() map[string]any {
 	ctx, err := processing.LoadContextFile(contextFile)
 	if err != nil {
 		slog.Error("failed to load context file", "filename", contextFile, "error", err)
-		os.Exit(exitLoadContextFailed)
+		exit(exitLoadContextFailed)
 	}
 	return ctx
 }
@@ -264,7 +471,7 @@ func includeEnv() {
 	}
 	if err := godotenv.Load(envFile); err != nil {
 		slog.Error("failed to load env file", "file", envFile, "error", err)
-		os.Exit(exitDotenvError)
+		exit(exitDotenvError)
 	}
 	slog.Info("loaded env file", "file", envFile)
 }
@@ -272,25 +479,25 @@ func includeEnv() {
 func checkInputDirectory() func() {
 	if inputDirectory == "" {
 		slog.Error("-input not set")
-		os.Exit(exitInputDirectoryNotSpecified)
+		exit(exitInputDirectoryNotSpecified)
 	}
 
-	resolved, cleanup, _, err := resolve.Resolve(inputDirectory, "")
+	resolved, cleanup, _, err := resolve.Resolve(runCtx, inputDirectory, "")
 	if err != nil {
 		slog.Error("failed to resolve input", "input", inputDirectory, "error", err)
-		os.Exit(exitInputDirectoryCheckFailed)
+		exit(exitInputDirectoryCheckFailed)
 	}
 	inputDirectory = resolved
 
 	st, err := os.Stat(inputDirectory)
 	if err != nil {
 		slog.Error("failed to check input directory", "directory", inputDirectory, "error", err)
-		os.Exit(exitInputDirectoryCheckFailed)
+		exit(exitInputDirectoryCheckFailed)
 	}
 
 	if !st.IsDir() {
 		slog.Error("-input is not a directory", "directory", inputDirectory)
-		os.Exit(exitInputDirectoryNotADirectory)
+		exit(exitInputDirectoryNotADirectory)
 	}
 
 	return cleanup
@@ -300,10 +507,10 @@ func resolveContextFile() func() {
 	if contextFile == "" {
 		return nil
 	}
-	resolved, cleanup, _, err := resolve.Resolve(contextFile, "")
+	resolved, cleanup, _, err := resolve.Resolve(runCtx, contextFile, "")
 	if err != nil {
 		slog.Error("failed to resolve context file", "file", contextFile, "error", err)
-		os.Exit(exitLoadContextFailed)
+		exit(exitLoadContextFailed)
 	}
 	contextFile = resolved
 	return cleanup
@@ -313,10 +520,10 @@ func resolveInstancesFile() func() {
 	if instancesFile == "" {
 		return nil
 	}
-	resolved, cleanup, _, err := resolve.Resolve(instancesFile, "")
+	resolved, cleanup, _, err := resolve.Resolve(runCtx, instancesFile, "")
 	if err != nil {
 		slog.Error("failed to resolve instances file", "file", instancesFile, "error", err)
-		os.Exit(exitLoadInstancesFailed)
+		exit(exitLoadInstancesFailed)
 	}
 
 	// If resolution produced a directory, look for instances.yaml/yml inside it.
@@ -338,21 +545,21 @@ func resolveInstancesFile() func() {
 func ensureOutputDirectory() {
 	if outputDirectory == "" {
 		slog.Error("-output-directory not set")
-		os.Exit(exitOutputDirectoryNotSpecified)
+		exit(exitOutputDirectoryNotSpecified)
 	}
 
 	_, err := os.Stat(outputDirectory)
 	if !os.IsNotExist(err) {
 		if err != nil {
 			slog.Error("failed to check output directory", "directory", outputDirectory, "error", err)
-			os.Exit(exitOutputDirectoryCheckFailed)
+			exit(exitOutputDirectoryCheckFailed)
 		}
 
 		if overwriteOutputDirectory {
 			err = os.RemoveAll(outputDirectory)
 			if err != nil {
 				slog.Error("failed to clean output directory", "directory", outputDirectory, "error", err)
-				os.Exit(exitOutputDirectoryCleanFailed)
+				exit(exitOutputDirectoryCleanFailed)
 			}
 		}
 	}
@@ -360,6 +567,6 @@ func ensureOutputDirectory() {
 	err = os.MkdirAll(outputDirectory, 0o750)
 	if err != nil {
 		slog.Error("failed to create output directory", "directory", outputDirectory, "error", err)
-		os.Exit(exitOutputDirectoryCreateFailed)
+		exit(exitOutputDirectoryCreateFailed)
 	}
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/systemstart/many-templates/pkg/plan"
+)
+
+// planTargetDirectory is the real output directory in plan mode, while
+// outputDirectory points at a temporary render directory.
+var planTargetDirectory string
+
+// preparePlanOutput redirects rendering into a temporary directory so the real
+// output directory is left untouched, and disables sha256/commit write-back so
+// a plan has no side effects on the input. It returns a cleanup function.
+func preparePlanOutput() func() {
+	if outputDirectory == "" {
+		slog.Error("-output-directory not set")
+		exit(exitOutputDirectoryNotSpecified)
+	}
+	if planFormat != "text" && planFormat != "json" {
+		slog.Error("unknown plan format", "format", planFormat)
+		exit(exitPlanFailed)
+	}
+
+	tmp, err := os.MkdirTemp("", "many-plan-*")
+	if err != nil {
+		slog.Error("failed to create plan directory", "error", err)
+		exit(exitPlanFailed)
+	}
+
+	planTargetDirectory = outputDirectory
+	outputDirectory = tmp
+	noSHA256Update = true
+	return func() { _ = os.RemoveAll(tmp) }
+}
+
+// reportPlan compares the rendered output against the real output directory,
+// prints the result to stdout and reports whether anything would change.
+func reportPlan() bool {
+	p, err := plan.Compare(outputDirectory, planTargetDirectory)
+	if err != nil {
+		slog.Error("failed to compute plan", "error", err)
+		exit(exitPlanFailed)
+	}
+
+	if planFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(p)
+	} else {
+		err = p.WriteText(os.Stdout)
+	}
+	if err != nil {
+		slog.Error("failed to write plan", "error", err)
+		exit(exitPlanFailed)
+	}
+	return p.HasChanges()
+}
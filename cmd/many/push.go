@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/systemstart/many-templates/pkg/processing"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+const pushUsage = "usage: many push [-source URL] [-revision REV] oci://<registry>/<repo>:<tag> <dir>\n"
+
+func runPush(args []string) {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, pushUsage)
+		fs.PrintDefaults()
+	}
+	source := fs.String("source", "", "source URL recorded in the org.opencontainers.image.source annotation")
+	revision := fs.String("revision", "", "source revision recorded in the org.opencontainers.image.revision annotation")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	ref, dir := fs.Arg(0), fs.Arg(1)
+
+	digest, err := resolve.PushOCI(runCtx, ref, dir, resolve.PushOptions{
+		Source:   *source,
+		Revision: *revision,
+		Exclude:  []string{processing.ManifestFileName},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(pushedRef(ref, digest))
+}
+
+// pushOutput publishes the output directory after a render when -push is set.
+func pushOutput() {
+	if pushRef == "" {
+		return
+	}
+	digest, err := resolve.PushOCI(runCtx, pushRef, outputDirectory, resolve.PushOptions{
+		Exclude: []string{processing.ManifestFileName},
+	})
+	if err != nil {
+		slog.Error("failed to push output", "ref", pushRef, "error", err)
+		exit(exitPushFailed)
+	}
+	slog.Info("pushed output", "ref", pushedRef(pushRef, digest))
+}
+
+// pushedRef returns ref without its tag, pinned to digest.
+func pushedRef(ref, digest string) string {
+	ref = strings.TrimPrefix(ref, "oci://")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return "oci://" + ref + "@" + digest
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/systemstart/many-templates/pkg/logging"
+	"github.com/systemstart/many-templates/pkg/processing"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+const rehashUsage = "usage: many rehash [-input DIR] [-only-mismatched] [-check] [-max-depth N]\n"
+
+// runRehash downloads the HTTPS sources of a local input directory again and
+// refreshes their sha256. With -check nothing is written, and the exit code
+// tells whether any checksum is missing or stale.
+func runRehash(args []string) {
+	opts := processing.RehashOptions{}
+
+	fs := flag.NewFlagSet("rehash", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, rehashUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&inputDirectory, "input", ".", "input directory")
+	fs.StringVar(&inputDirectory, "input-directory", ".", "input directory (alias for -input)")
+	fs.BoolVar(&opts.OnlyMismatched, "only-mismatched", false, "only check sources with a sha256, and only list those that differ")
+	fs.BoolVar(&opts.Check, "check", false, "report without modifying pipeline files; exit non-zero on differences")
+	fs.IntVar(&maxDepth, "max-depth", -1, "max directory recursion depth (-1 = unlimited, 0 = root only)")
+	fs.StringVar(&envFile, "env-file", "", "load environment variables from file")
+	fs.StringVar(&httpCredentialsFile, "http-credentials", "", "per-host credentials for https sources")
+	fs.DurationVar(&sourceTimeout, "source-timeout", resolve.DefaultTimeout, "time limit for fetching a single source (0 = none)")
+	fs.IntVar(&retries, "retries", resolve.DefaultRetryPolicy.Attempts-1, "retries of https downloads after transient errors")
+	fs.StringVar(&loggingType, "logging-type", "tint", "logging type: json, text or tint")
+	fs.StringVar(&logLevel, "log-level", "info", "logging level: debug, info, warn, error")
+	_ = fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	_ = logging.Initialize(loggingType, logLevel)
+
+	if resolve.IsRemote(inputDirectory) {
+		slog.Error("many rehash needs a local input directory", "input", inputDirectory)
+		exit(exitRehashFailed)
+	}
+
+	includeEnv()
+	setupNetwork()
+	setupHTTPCredentials()
+	defer runCleanups()
+
+	opts.InputDir = inputDirectory
+	opts.MaxDepth = maxDepth
+	results, err := processing.RehashSources(runCtx, opts)
+	printRehash(results, opts.Check)
+	if err != nil {
+		slog.Error("failed to rehash sources", "error", err)
+		exit(exitRehashFailed)
+	}
+	if opts.Check {
+		for _, r := range results {
+			if r.Changed() {
+				exit(exitRehashHasChanges)
+			}
+		}
+	}
+}
+
+// printRehash writes a table of old and new checksums to stdout.
+func printRehash(results []processing.Rehash, check bool) {
+	if len(results) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "FILE\tURL\tOLD\tNEW\tSTATUS")
+	for _, r := range results {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.File, resolve.RedactURL(r.URL), shortHash(r.Old), shortHash(r.New), rehashStatus(r, check))
+	}
+	_ = w.Flush()
+}
+
+func rehashStatus(r processing.Rehash, check bool) string {
+	switch {
+	case !r.Changed():
+		return "ok"
+	case check && r.Old == "":
+		return "missing"
+	case check:
+		return "mismatch"
+	case r.Old == "":
+		return "added"
+	default:
+		return "updated"
+	}
+}
+
+func shortHash(sum string) string {
+	if sum == "" {
+		return "-"
+	}
+	return sum[:min(12, len(sum))]
+}
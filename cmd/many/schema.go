@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/systemstart/many-templates/pkg/api"
+)
+
+const schemaUsage = "usage: many schema [pipeline|instances]\n"
+
+func runSchema(args []string) {
+	kind := "pipeline"
+	if len(args) > 0 {
+		kind = args[0]
+	}
+	if len(args) > 1 {
+		fmt.Fprint(os.Stderr, schemaUsage)
+		os.Exit(1)
+	}
+
+	var schema map[string]any
+	switch kind {
+	case "pipeline":
+		schema = api.PipelineSchema()
+	case "instances":
+		schema = api.InstancesSchema()
+	default:
+		fmt.Fprint(os.Stderr, schemaUsage)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(schema); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/systemstart/many-templates/pkg/processing"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+// runCtx is cancelled on the first SIGINT or SIGTERM. Pipelines stop before
+// their next step and source downloads and external commands are aborted.
+var runCtx = context.Background()
+
+var (
+	cleanupsMu sync.Mutex
+	cleanups   []func()
+)
+
+// handleSignals installs runCtx. A second signal skips the orderly shutdown
+// and exits immediately after removing the temp directories of resolvers and
+// the work and staging directories of running pipelines.
+func handleSignals() {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	runCtx = ctx
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		slog.Warn("interrupted, cleaning up (repeat to exit immediately)", "signal", sig)
+		cancel(fmt.Errorf("received %v", sig))
+		<-sigs
+		processing.RemoveTempDirs()
+		resolve.RemoveTempDirs()
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// onExit registers fn to run before the process exits, in reverse order of
+// registration. A nil fn is ignored.
+func onExit(fn func()) {
+	if fn == nil {
+		return
+	}
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+	cleanups = append(cleanups, fn)
+}
+
+// runCleanups runs the functions registered with onExit and removes any temp
+// directories pipelines and resolvers still hold.
+func runCleanups() {
+	cleanupsMu.Lock()
+	fns := cleanups
+	cleanups = nil
+	cleanupsMu.Unlock()
+
+	for _, fn := range slices.Backward(fns) {
+		fn()
+	}
+	processing.RemoveTempDirs()
+	resolve.RemoveTempDirs()
+}
+
+// exit runs the cleanups and exits. A failure after an interrupt is reported
+// as exitInterrupted.
+func exit(code int) {
+	runCleanups()
+	if code != 0 && runCtx.Err() != nil {
+		code = exitInterrupted
+	}
+	os.Exit(code)
+}
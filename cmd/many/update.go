@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/systemstart/many-templates/pkg/logging"
+	"github.com/systemstart/many-templates/pkg/processing"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+const updateUsage = "usage: many update [-input DIR] [-source NAME] [-max-depth N]\n"
+
+// runUpdate bumps the Helm, OCI and GitHub release sources of a local input
+// directory to their newest versions.
+func runUpdate(args []string) {
+	var sourceName string
+
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, updateUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&inputDirectory, "input", ".", "input directory")
+	fs.StringVar(&inputDirectory, "input-directory", ".", "input directory (alias for -input)")
+	fs.StringVar(&sourceName, "source", "", "only update sources of this chart or repository name")
+	fs.IntVar(&maxDepth, "max-depth", -1, "max directory recursion depth (-1 = unlimited, 0 = root only)")
+	fs.StringVar(&envFile, "env-file", "", "load environment variables from file")
+	fs.BoolVar(&noCache, "no-cache", false, "disable the persistent source cache")
+	fs.StringVar(&cacheDir, "cache-dir", "", "source cache directory (default $XDG_CACHE_HOME/many)")
+	fs.StringVar(&httpCredentialsFile, "http-credentials", "", "per-host credentials for https sources")
+	fs.DurationVar(&sourceTimeout, "source-timeout", resolve.DefaultTimeout, "time limit for fetching a single source (0 = none)")
+	fs.IntVar(&retries, "retries", resolve.DefaultRetryPolicy.Attempts-1, "retries of https downloads after transient errors")
+	fs.StringVar(&loggingType, "logging-type", "tint", "logging type: json, text or tint")
+	fs.StringVar(&logLevel, "log-level", "info", "logging level: debug, info, warn, error")
+	_ = fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	_ = logging.Initialize(loggingType, logLevel)
+
+	if resolve.IsRemote(inputDirectory) {
+		slog.Error("many update needs a local input directory", "input", inputDirectory)
+		exit(exitUpdateFailed)
+	}
+
+	includeEnv()
+	setupCache()
+	setupNetwork()
+	setupHTTPCredentials()
+	defer runCleanups()
+
+	updates, err := processing.UpdateSources(runCtx, inputDirectory, maxDepth, sourceName)
+	for _, u := range updates {
+		slog.Info("updated source", "file", u.File, "from", u.From, "to", u.To)
+	}
+	if err != nil {
+		slog.Error("failed to update sources", "error", err)
+		exit(exitUpdateFailed)
+	}
+	if len(updates) == 0 {
+		slog.Info("all sources are up to date")
+	}
+}
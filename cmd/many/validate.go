@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/systemstart/many-templates/pkg/processing"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+const validateUsage = "usage: many validate -input DIR [-instances FILE] [-context-file FILE] [-max-depth N] [-offline -vendor-dir DIR]\n"
+
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, validateUsage)
+		fs.PrintDefaults()
+	}
+	opts := processing.CheckOptions{}
+	fs.StringVar(&opts.InputDir, "input", "", "input directory")
+	fs.StringVar(&opts.InputDir, "input-directory", "", "input directory (alias for -input)")
+	fs.StringVar(&opts.Instances, "instances", "", "instances YAML file to check")
+	fs.StringVar(&opts.ContextFile, "context-file", "", "global context YAML file to check")
+	fs.IntVar(&opts.MaxDepth, "max-depth", -1, "max directory recursion depth (-1 = unlimited, 0 = root only)")
+	// Remote base pipelines and macro libraries are fetched like sources.
+	fs.StringVar(&envFile, "env-file", "", "load environment variables from file")
+	fs.BoolVar(&noCache, "no-cache", false, "disable the persistent source cache")
+	fs.StringVar(&cacheDir, "cache-dir", "", "source cache directory (default $XDG_CACHE_HOME/many)")
+	fs.StringVar(&httpCredentialsFile, "http-credentials", "", "per-host credentials for https sources")
+	fs.DurationVar(&sourceTimeout, "source-timeout", resolve.DefaultTimeout, "time limit for fetching a single source (0 = none)")
+	fs.IntVar(&retries, "retries", resolve.DefaultRetryPolicy.Attempts-1, "retries of https downloads after transient errors")
+	fs.BoolVar(&offline, "offline", false, "serve remote bases and macro libraries from -vendor-dir and fail on any that are missing")
+	fs.StringVar(&vendorDir, "vendor-dir", "", "vendor directory written by 'many vendor', used with -offline")
+	_ = fs.Parse(args)
+
+	if opts.InputDir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	includeEnv()
+	setupCache()
+	setupNetwork()
+	setupHTTPCredentials()
+	setupVendor()
+	defer runCleanups()
+
+	problems := processing.Check(runCtx, opts)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+		exit(1)
+	}
+}
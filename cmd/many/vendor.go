@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/systemstart/many-templates/pkg/logging"
+	"github.com/systemstart/many-templates/pkg/processing"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+const vendorUsage = "usage: many vendor -input DIR -vendor-dir DIR [-max-depth N]\n"
+
+// runVendor copies every remote source used below -input into -vendor-dir,
+// for later renders with -offline.
+func runVendor(args []string) {
+	fs := flag.NewFlagSet("vendor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, vendorUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&inputDirectory, "input", "", "input directory (or URI)")
+	fs.StringVar(&inputDirectory, "input-directory", "", "input directory (alias for -input)")
+	fs.StringVar(&vendorDir, "vendor-dir", "", "directory to copy sources into")
+	fs.IntVar(&maxDepth, "max-depth", -1, "max directory recursion depth (-1 = unlimited, 0 = root only)")
+	fs.StringVar(&envFile, "env-file", "", "load environment variables from file")
+	fs.BoolVar(&noCache, "no-cache", false, "disable the persistent source cache")
+	fs.StringVar(&cacheDir, "cache-dir", "", "source cache directory (default $XDG_CACHE_HOME/many)")
+	fs.StringVar(&httpCredentialsFile, "http-credentials", "", "per-host credentials for https sources")
+	fs.DurationVar(&sourceTimeout, "source-timeout", resolve.DefaultTimeout, "time limit for fetching a single source (0 = none)")
+	fs.IntVar(&retries, "retries", resolve.DefaultRetryPolicy.Attempts-1, "retries of https downloads after transient errors")
+	fs.StringVar(&loggingType, "logging-type", "tint", "logging type: json, text or tint")
+	fs.StringVar(&logLevel, "log-level", "info", "logging level: debug, info, warn, error")
+	_ = fs.Parse(args)
+
+	if inputDirectory == "" || vendorDir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	_ = logging.Initialize(loggingType, logLevel)
+
+	includeEnv()
+	setupCache()
+	setupNetwork()
+	setupHTTPCredentials()
+
+	v, err := resolve.OpenVendor(vendorDir)
+	if err != nil {
+		slog.Error("failed to open vendor directory", "directory", vendorDir, "error", err)
+		exit(exitVendorFailed)
+	}
+	resolve.SetVendor(v)
+	defer runCleanups()
+
+	onExit(checkInputDirectory())
+	n, err := processing.VendorSources(runCtx, inputDirectory, maxDepth)
+	if err != nil {
+		slog.Error("vendoring failed", "error", err)
+		exit(exitVendorFailed)
+	}
+	slog.Info("vendored sources", "count", n, "directory", vendorDir)
+}
+
+// setupVendor serves all sources from -vendor-dir when -offline is set.
+func setupVendor() {
+	if !offline {
+		return
+	}
+	if vendorDir == "" {
+		slog.Error("-offline requires -vendor-dir")
+		exit(exitVendorFailed)
+	}
+	if st, err := os.Stat(vendorDir); err != nil || !st.IsDir() {
+		slog.Error("vendor directory not found", "directory", vendorDir)
+		exit(exitVendorFailed)
+	}
+	resolve.SetVendor(&resolve.Vendor{Dir: vendorDir, Offline: true})
+	slog.Info("offline mode, serving sources from vendor directory", "directory", vendorDir)
+}
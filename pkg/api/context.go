@@ -0,0 +1,21 @@
+package api
+
+// MergeContext performs a deep merge of local context over global context.
+// For map values, merging is recursive. For all other types (including slices),
+// local values replace global values.
+func MergeContext(global, local map[string]any) map[string]any {
+	merged := make(map[string]any, len(global)+len(local))
+	for k, v := range global {
+		merged[k] = v
+	}
+	for k, v := range local {
+		if localMap, ok := v.(map[string]any); ok {
+			if globalMap, ok := merged[k].(map[string]any); ok {
+				merged[k] = MergeContext(globalMap, localMap)
+				continue
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeContext(t *testing.T) {
+	global := map[string]any{
+		"domain":   "example.com",
+		"database": map[string]any{"host": "db", "port": 5432},
+		"tags":     []any{"a", "b"},
+	}
+	local := map[string]any{
+		"database": map[string]any{"port": 5433},
+		"tags":     []any{"c"},
+	}
+
+	got := MergeContext(global, local)
+	want := map[string]any{
+		"domain":   "example.com",
+		"database": map[string]any{"host": "db", "port": 5433},
+		"tags":     []any{"c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeContext = %v, want %v", got, want)
+	}
+	if global["database"].(map[string]any)["port"] != 5432 {
+		t.Error("expected the global context to be left unchanged")
+	}
+}
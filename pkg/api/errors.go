@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LocatedError is an error tied to a position in a YAML file.
+type LocatedError struct {
+	File   string
+	Line   int // 1-based; 0 if unknown
+	Column int // 1-based; 0 if unknown
+	Err    error
+}
+
+func (e *LocatedError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+func (e *LocatedError) Unwrap() error { return e.Err }
+
+// pathError attaches a document path to a validation error. A path is a
+// sequence of mapping keys (string) and sequence indexes (int), relative to
+// the path of any enclosing pathError in the error chain.
+type pathError struct {
+	path []any
+	err  error
+}
+
+func (e *pathError) Error() string { return e.err.Error() }
+
+func (e *pathError) Unwrap() error { return e.err }
+
+// atPath annotates err with a document path. A nil err stays nil.
+func atPath(err error, path ...any) error {
+	if err == nil {
+		return nil
+	}
+	return &pathError{path: path, err: err}
+}
+
+// errorPath concatenates the paths of all pathErrors in err's chain,
+// outermost first.
+func errorPath(err error) []any {
+	var path []any
+	for err != nil {
+		var pe *pathError
+		if errors.As(err, &pe) {
+			path = append(path, pe.path...)
+			err = pe.err
+			continue
+		}
+		break
+	}
+	return path
+}
+
+// locate wraps err in a LocatedError pointing at the node addressed by err's
+// document path within root, or at the closest existing ancestor.
+func locate(file string, root *yaml.Node, err error) *LocatedError {
+	le := &LocatedError{File: file, Err: err}
+	if n := nodeAt(root, errorPath(err)); n != nil {
+		le.Line, le.Column = n.Line, n.Column
+	}
+	return le
+}
+
+// nodeAt follows path from root and returns the deepest node reached. For a
+// mapping key whose value is a scalar, the value node is returned; for
+// collections the key node is returned, since the value starts on a later line.
+// A single mapping is treated as a one-element sequence, matching Sources.
+func nodeAt(root *yaml.Node, path []any) *yaml.Node {
+	if root == nil {
+		return nil
+	}
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			return nil
+		}
+		root = root.Content[0]
+	}
+
+	cur, pos := root, root
+	for _, elem := range path {
+		next, nextPos := step(cur, elem)
+		if next == nil {
+			break
+		}
+		cur, pos = next, nextPos
+	}
+	return pos
+}
+
+// step descends one path element from node. It returns the child node and the
+// node whose position best describes it.
+func step(node *yaml.Node, elem any) (*yaml.Node, *yaml.Node) {
+	switch e := elem.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == e {
+				value := node.Content[i+1]
+				if value.Kind == yaml.ScalarNode {
+					return value, value
+				}
+				return value, node.Content[i]
+			}
+		}
+	case int:
+		switch {
+		case node.Kind == yaml.SequenceNode && e >= 0 && e < len(node.Content):
+			return node.Content[e], node.Content[e]
+		case node.Kind == yaml.MappingNode && e == 0:
+			return node, node
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestErrorPath_ConcatenatesNestedPaths(t *testing.T) {
+	inner := atPath(fmt.Errorf("bad"), "sha256")
+	err := atPath(fmt.Errorf("step %q: %w", "a", atPath(inner, "source", 0)), "pipeline", 1)
+
+	want := []any{"pipeline", 1, "source", 0, "sha256"}
+	if got := errorPath(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("errorPath = %v, want %v", got, want)
+	}
+	if err.Error() != `step "a": bad` {
+		t.Errorf("path annotation must not change the message, got %q", err.Error())
+	}
+}
+
+func TestNodeAt(t *testing.T) {
+	src := `pipeline:
+  - name: a
+    type: template
+  - name: b
+    type: kustomize-build
+    kustomize-build:
+      dir: .
+    source:
+      https: https://example.com
+`
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path      []any
+		line, col int
+	}{
+		{[]any{"pipeline", 1, "type"}, 5, 11},
+		{[]any{"pipeline", 1, "kustomize-build"}, 6, 5},
+		{[]any{"pipeline", 1, "kustomize-build", "outputFile"}, 6, 5},
+		{[]any{"pipeline", 1, "source", 0, "https"}, 9, 14},
+		{[]any{"pipeline", 7}, 1, 1},
+	}
+	for _, tt := range tests {
+		n := nodeAt(&doc, tt.path)
+		if n == nil || n.Line != tt.line || n.Column != tt.col {
+			t.Errorf("nodeAt(%v) = %v, want %d:%d", tt.path, n, tt.line, tt.col)
+		}
+	}
+}
+
+func TestLocatedError_Error(t *testing.T) {
+	err := &LocatedError{File: "a.yaml", Line: 3, Column: 5, Err: fmt.Errorf("boom")}
+	if err.Error() != "a.yaml:3:5: boom" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	err.Line = 0
+	if err.Error() != "a.yaml: boom" {
+		t.Errorf("unexpected message without position %q", err.Error())
+	}
+}
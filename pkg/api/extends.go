@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/systemstart/many-templates/pkg/resolve"
+	"gopkg.in/yaml.v3"
+)
+
+// baseFileName is the pipeline file read from a base that resolves to a
+// directory (an OCI artifact or Git repository).
+const baseFileName = ".many.yaml"
+
+// Refs lists base pipelines or macro libraries, as paths relative to the
+// pipeline file or remote URIs. It is written as a single string or a list.
+type Refs []string
+
+// UnmarshalYAML decodes either a single string or a list of strings.
+func (r *Refs) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		*r = Refs{value.Value}
+		return nil
+	case yaml.SequenceNode:
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return fmt.Errorf("decoding list: %w", err)
+		}
+		*r = list
+		return nil
+	default:
+		return fmt.Errorf("must be a string or list of strings")
+	}
+}
+
+// origin records where a step or source was declared, so that validation
+// errors point into the file that declared it.
+type origin struct {
+	file string
+	doc  *yaml.Node
+	path []any // document path of the step or source within doc
+}
+
+// at locates err, with a document path relative to the step or source, in
+// the file that declared it.
+func (o origin) at(err error, path ...any) *LocatedError {
+	return locate(o.file, o.doc, atPath(err, append(slices.Clone(o.path), path...)...))
+}
+
+// layer is a pipeline together with the origin of each of its steps and
+// sources. Its own file and document are those of the outermost pipeline.
+type layer struct {
+	p       *Pipeline
+	file    string
+	doc     *yaml.Node
+	steps   []origin // parallel to p.Pipeline
+	sources []origin // parallel to p.Source
+}
+
+func newLayer(p *Pipeline, file string, doc *yaml.Node) *layer {
+	l := &layer{p: p, file: file, doc: doc}
+	for i := range p.Pipeline {
+		l.steps = append(l.steps, origin{file: file, doc: doc, path: []any{"pipeline", i}})
+	}
+	for i := range p.Source {
+		l.sources = append(l.sources, origin{file: file, doc: doc, path: []any{"source", i}})
+	}
+	return l
+}
+
+// locate wraps a validation error of the merged pipeline in a LocatedError
+// pointing into the file that declared the offending step or source.
+func (l *layer) locate(err error) *LocatedError {
+	path := errorPath(err)
+	if len(path) >= 2 {
+		i, ok := path[1].(int)
+		var origins []origin
+		switch path[0] {
+		case "pipeline":
+			origins = l.steps
+		case "source":
+			origins = l.sources
+		}
+		if ok && i >= 0 && i < len(origins) {
+			o := origins[i]
+			le := &LocatedError{File: o.file, Err: err}
+			if n := nodeAt(o.doc, append(slices.Clone(o.path), path[2:]...)); n != nil {
+				le.Line, le.Column = n.Line, n.Column
+			}
+			return le
+		}
+	}
+	return locate(l.file, l.doc, err)
+}
+
+// extend applies the bases of child, in order, beneath it. Relative base
+// paths are resolved against dir; chain holds the files being extended, to
+// detect cycles. Bases below a remote one are never recorded in Bases, as
+// they cannot be written back to.
+func extend(ctx context.Context, child *layer, dir string, chain []string, remote bool) (*layer, error) {
+	acc := &layer{p: &Pipeline{}}
+	for i, ref := range child.p.Extends {
+		base, err := loadBase(ctx, ref, dir, chain, remote)
+		if err != nil {
+			return nil, locate(child.file, child.doc, atPath(fmt.Errorf("extends %s: %w", ref, err), "extends", i))
+		}
+		if acc, err = overlay(acc, base); err != nil {
+			return nil, err
+		}
+	}
+	return overlay(acc, child)
+}
+
+// fetched is a base pipeline or macro library read by reference.
+type fetched struct {
+	id      string // absolute path or URI, to detect cycles
+	path    string // local file to read
+	display string // name in error messages
+	remote  bool   // whether it comes from a remote URI, directly or through a base
+}
+
+// fetch locates ref, resolving relative paths against dir. Remote refs are
+// fetched with resolve.Resolve; one that resolves to a directory (an OCI
+// artifact or Git repository) is read from its .many.yaml. The returned
+// cleanup, if not nil, removes the fetched copy. The fetch is bounded by the
+// timeout set via resolve.SetTimeout and aborted when ctx is cancelled.
+func fetch(ctx context.Context, ref, dir string, remote bool) (*fetched, func(), error) {
+	if ref == "" {
+		return nil, nil, fmt.Errorf("reference is empty")
+	}
+	if !resolve.IsRemote(ref) {
+		path := strings.TrimPrefix(ref, "file://")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		f := &fetched{id: path, path: path, display: path, remote: remote}
+		if remote {
+			f.display = ref
+		}
+		return f, nil, nil
+	}
+
+	ctx, cancel := resolve.WithTimeout(ctx, 0)
+	defer cancel()
+	path, cleanup, _, err := resolve.Resolve(ctx, ref, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	if st, err := os.Stat(path); err == nil && st.IsDir() {
+		path = filepath.Join(path, baseFileName)
+	}
+	return &fetched{id: ref, path: path, display: ref, remote: true}, cleanup, nil
+}
+
+// loadBase reads and extends the base pipeline ref. Its own use steps are
+// expanded with its own macro libraries.
+func loadBase(ctx context.Context, ref, dir string, chain []string, remote bool) (*layer, error) {
+	f, cleanup, err := fetch(ctx, ref, dir, remote)
+	if err != nil {
+		return nil, err
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	if slices.Contains(chain, f.id) {
+		return nil, fmt.Errorf("extends cycle: %s", strings.Join(append(chain, f.id), " -> "))
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading base pipeline: %w", err)
+	}
+	l, err := decodeLayer(f.display, data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base pipeline: %w", err)
+	}
+	if !f.remote {
+		l.p.Bases = []string{f.path}
+	}
+	if err := expandMacros(ctx, l, filepath.Dir(f.path), f.remote); err != nil {
+		return nil, err
+	}
+	if len(l.p.Extends) == 0 {
+		return l, nil
+	}
+	return extend(ctx, l, filepath.Dir(f.path), append(slices.Clone(chain), f.id), f.remote)
+}
+
+// overlay lays child over base: contexts are deep-merged with child values
+// winning, base sources come before child sources, and each child step
+// replaces the base step of the same name in place, is inserted relative to
+// the step named by its before or after, or is appended.
+func overlay(base, child *layer) (*layer, error) {
+	p := *child.p
+	p.Context = MergeContext(base.p.Context, child.p.Context)
+	p.Source = append(slices.Clone(base.p.Source), child.p.Source...)
+	p.Bases = append(slices.Clone(base.p.Bases), child.p.Bases...)
+
+	out := &layer{
+		p:       &p,
+		file:    child.file,
+		doc:     child.doc,
+		steps:   slices.Clone(base.steps),
+		sources: append(slices.Clone(base.sources), child.sources...),
+	}
+	p.Pipeline = slices.Clone(base.p.Pipeline)
+
+	seen := make(map[string]bool)
+	for i, step := range child.p.Pipeline {
+		o := child.steps[i]
+		if seen[step.Name] {
+			return nil, o.at(fmt.Errorf("step %d: duplicate step name %q", i, step.Name), "name")
+		}
+		seen[step.Name] = true
+		idx := slices.IndexFunc(p.Pipeline, func(s StepConfig) bool { return s.Name == step.Name })
+		anchor, field := step.Before, "before"
+		if step.After != "" {
+			anchor, field = step.After, "after"
+		}
+
+		switch {
+		case step.Before != "" && step.After != "":
+			return nil, o.at(fmt.Errorf("step %q: before and after are mutually exclusive", step.Name), "after")
+		case anchor == "" && idx >= 0:
+			p.Pipeline[idx], out.steps[idx] = step, o
+			continue
+		case anchor == "":
+			p.Pipeline, out.steps = append(p.Pipeline, step), append(out.steps, o)
+			continue
+		case idx >= 0:
+			// Moved as well as replaced.
+			p.Pipeline, out.steps = slices.Delete(p.Pipeline, idx, idx+1), slices.Delete(out.steps, idx, idx+1)
+		}
+
+		at := slices.IndexFunc(p.Pipeline, func(s StepConfig) bool { return s.Name == anchor })
+		if at < 0 {
+			return nil, o.at(fmt.Errorf("step %q: %s: no step %q in the base pipeline", step.Name, field, anchor), field)
+		}
+		if step.After != "" {
+			at++
+		}
+		step.Before, step.After = "", ""
+		p.Pipeline, out.steps = slices.Insert(p.Pipeline, at, step), slices.Insert(out.steps, at, o)
+	}
+	return out, nil
+}
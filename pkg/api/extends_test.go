@@ -0,0 +1,332 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// helmService is the four-step pipeline shared by the Helm-based services.
+const helmService = `context:
+  chart:
+    name: app
+    version: 1.0.0
+  replicas: 1
+
+source:
+  - file: values.yaml
+
+pipeline:
+  - name: render-templates
+    type: template
+    template:
+      files:
+        include: ["**/*.yaml"]
+
+  - name: build
+    type: kustomize-build
+    kustomize-build:
+      enableHelm: true
+      outputFile: kustomize-output.yaml
+
+  - name: split-output
+    type: split
+    split:
+      input: kustomize-output.yaml
+      by: resource
+
+  - name: create-kustomization
+    type: kustomize-create
+    kustomize-create:
+      autodetect: true
+`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func stepNames(p *Pipeline) []string {
+	names := make([]string, 0, len(p.Pipeline))
+	for _, s := range p.Pipeline {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestLoadPipeline_ExtendsContextAndSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "_bases", "helm-service.yaml"), helmService)
+	writeFile(t, filepath.Join(dir, "dex", ".many.yaml"), `extends: ../_bases/helm-service.yaml
+context:
+  namespace: dex
+  chart:
+    name: dex
+source:
+  - file: externalsecret.yaml
+`)
+
+	p, err := LoadPipeline(t.Context(), filepath.Join(dir, "dex", ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stepNames(p), []string{"render-templates", "build", "split-output", "create-kustomization"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+	wantContext := map[string]any{
+		"namespace": "dex",
+		"replicas":  1,
+		"chart":     map[string]any{"name": "dex", "version": "1.0.0"},
+	}
+	if !reflect.DeepEqual(p.Context, wantContext) {
+		t.Errorf("context = %v, want %v", p.Context, wantContext)
+	}
+	if len(p.Source) != 2 || p.Source[0].File != "values.yaml" || p.Source[1].File != "externalsecret.yaml" {
+		t.Errorf("expected base sources before own sources, got %+v", p.Source)
+	}
+	if want := filepath.Join(dir, "dex"); p.Dir != want {
+		t.Errorf("Dir = %s, want %s", p.Dir, want)
+	}
+	if want := []string{filepath.Join(dir, "_bases", "helm-service.yaml")}; !reflect.DeepEqual(p.Bases, want) {
+		t.Errorf("Bases = %v, want %v", p.Bases, want)
+	}
+}
+
+func TestLoadPipeline_ExtendsSteps(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "base.yaml"), helmService)
+	writeFile(t, filepath.Join(dir, ".many.yaml"), `extends: base.yaml
+pipeline:
+  - name: build # replaced in place
+    type: kustomize-build
+    kustomize-build:
+      outputFile: out.yaml
+  - name: fetch-crds
+    type: copy
+    before: render-templates
+    copy:
+      files:
+        include: ["crds/**"]
+      dest: crds/
+  - name: split-output # moved
+    type: split
+    after: create-kustomization
+    split:
+      input: out.yaml
+  - name: lint
+    type: template
+    template: {}
+`)
+
+	p, err := LoadPipeline(t.Context(), filepath.Join(dir, ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fetch-crds", "render-templates", "build", "create-kustomization", "split-output", "lint"}
+	if got := stepNames(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+	if got := p.Pipeline[2].KustomizeBuild; got.OutputFile != "out.yaml" || got.EnableHelm {
+		t.Errorf("expected build to be replaced, got %+v", got)
+	}
+	for _, s := range p.Pipeline {
+		if s.Before != "" || s.After != "" {
+			t.Errorf("step %q: before/after not cleared", s.Name)
+		}
+	}
+}
+
+func TestLoadPipeline_ExtendsChain(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib", "base.yaml"), helmService)
+	writeFile(t, filepath.Join(dir, "lib", "ha.yaml"), "extends: base.yaml\ncontext:\n  replicas: 3\n")
+	writeFile(t, filepath.Join(dir, "lib", "monitoring.yaml"), `pipeline:
+  - name: dashboards
+    type: copy
+    after: render-templates
+    copy:
+      files:
+        include: ["dashboards/**"]
+      dest: dashboards/
+`)
+	writeFile(t, filepath.Join(dir, "app", ".many.yaml"), "extends:\n  - ../lib/ha.yaml\n  - ../lib/monitoring.yaml\n")
+
+	p, err := LoadPipeline(t.Context(), filepath.Join(dir, "app", ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Context["replicas"] != 3 {
+		t.Errorf("replicas = %v, want 3", p.Context["replicas"])
+	}
+	want := []string{"render-templates", "dashboards", "build", "split-output", "create-kustomization"}
+	if got := stepNames(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+	if len(p.Bases) != 3 {
+		t.Errorf("expected 3 local bases, got %v", p.Bases)
+	}
+}
+
+func TestLoadPipeline_ExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		child string
+		file  string // file the error is located in
+		line  int
+		want  string
+	}{
+		{
+			name:  "unknown anchor",
+			base:  helmService,
+			child: "extends: base.yaml\npipeline:\n  - name: extra\n    type: template\n    template: {}\n    after: missing\n",
+			file:  ".many.yaml", line: 6,
+			want: `no step "missing" in the base pipeline`,
+		},
+		{
+			name:  "invalid base step",
+			base:  "pipeline:\n  - name: render\n    type: template\n",
+			child: "extends: base.yaml\ncontext: {a: 1}\n",
+			file:  "base.yaml", line: 2,
+			want: "template config is required",
+		},
+		{
+			name:  "cycle",
+			base:  "extends: .many.yaml\n",
+			child: "extends: base.yaml\n",
+			file:  ".many.yaml", line: 1,
+			want: "extends cycle",
+		},
+		{
+			name:  "missing base",
+			child: "extends: [other.yaml]\n",
+			file:  ".many.yaml", line: 1,
+			want: "reading base pipeline",
+		},
+		{
+			name:  "unknown field in base",
+			base:  "pipline: []\n",
+			child: "extends: base.yaml\n",
+			file:  ".many.yaml", line: 1,
+			want: `unknown field "pipline"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.base != "" {
+				writeFile(t, filepath.Join(dir, "base.yaml"), tt.base)
+			}
+			writeFile(t, filepath.Join(dir, ".many.yaml"), tt.child)
+
+			_, err := LoadPipeline(t.Context(), filepath.Join(dir, ".many.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+			var le *LocatedError
+			if !errors.As(err, &le) {
+				t.Fatalf("expected a LocatedError, got %T", err)
+			}
+			if filepath.Base(le.File) != tt.file || le.Line != tt.line {
+				t.Errorf("located at %s:%d, want %s:%d", le.File, le.Line, tt.file, tt.line)
+			}
+		})
+	}
+}
+
+func TestLoadPipeline_BeforeWithoutExtends(t *testing.T) {
+	f := filepath.Join(t.TempDir(), ".many.yaml")
+	writeFile(t, f, "pipeline:\n  - name: a\n    type: template\n    template: {}\n    before: b\n")
+
+	_, err := LoadPipeline(t.Context(), f)
+	if err == nil || !strings.Contains(err.Error(), "only allowed in a pipeline with extends") {
+		t.Fatalf("expected before to be rejected, got %v", err)
+	}
+}
+
+func TestLoadPipeline_ExtendsRemote(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: ".many.yaml", Mode: 0o644, Size: int64(len(helmService))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(helmService)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/bases/helm-service:v1"
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(parsed, img); err != nil {
+		t.Fatal(err)
+	}
+
+	f := filepath.Join(t.TempDir(), ".many.yaml")
+	writeFile(t, f, "extends: oci://"+ref+"\ncontext:\n  namespace: dex\n")
+	p, err := LoadPipeline(t.Context(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Pipeline) != 4 || p.Context["namespace"] != "dex" {
+		t.Errorf("expected the remote base to be applied, got %v and %v", stepNames(p), p.Context)
+	}
+	if len(p.Bases) != 0 {
+		t.Errorf("expected no local bases, got %v", p.Bases)
+	}
+}
+
+func TestLoadPipeline_ExtendsRemoteCancelled(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	f := filepath.Join(t.TempDir(), ".many.yaml")
+	writeFile(t, f, "extends: oci://"+strings.TrimPrefix(srv.URL, "http://")+"/bases/helm-service:v1\n")
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := LoadPipeline(ctx, f)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the fetch to be cancelled, got %v", err)
+	}
+}
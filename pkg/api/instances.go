@@ -9,6 +9,21 @@ import (
 
 // LoadInstances reads an instances YAML file, unmarshals it, and validates.
 func LoadInstances(filename string) (*InstancesConfig, error) {
+	cfg, err := ParseInstances(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validating instances file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// ParseInstances reads and unmarshals an instances YAML file without
+// validating it.
+func ParseInstances(filename string) (*InstancesConfig, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("reading instances file: %w", err)
@@ -19,10 +34,6 @@ func LoadInstances(filename string) (*InstancesConfig, error) {
 		return nil, fmt.Errorf("parsing instances file: %w", err)
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("validating instances file: %w", err)
-	}
-
 	return &cfg, nil
 }
 
@@ -167,3 +167,19 @@ func TestLoadInstances_InvalidYAML(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestParseInstances_DoesNotValidate(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "instances.yaml")
+	if err := os.WriteFile(f, []byte("instances: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ParseInstances(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Instances) != 0 {
+		t.Errorf("expected no instances, got %d", len(cfg.Instances))
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LockFileName is the lock file at the root of an input tree.
+const LockFileName = "many.lock"
+
+// LockVersion is the lock file format version written by Save.
+const LockVersion = 1
+
+const lockHeader = "# Generated by `many lock update`. Do not edit.\n"
+
+// Lock records the resolved content of every source used below an input
+// tree, keyed by source (see the processing package for the key format).
+type Lock struct {
+	Version int                  `yaml:"version"`
+	Sources map[string]LockEntry `yaml:"sources"`
+}
+
+// LockEntry is the resolved state of one source.
+type LockEntry struct {
+	Digest   string `yaml:"digest"`             // sha256 over the resolved files
+	Resolved string `yaml:"resolved,omitempty"` // OCI manifest digest, git commit or https sha256
+}
+
+// NewLock returns an empty lock.
+func NewLock() *Lock {
+	return &Lock{Version: LockVersion, Sources: make(map[string]LockEntry)}
+}
+
+// LoadLock reads a lock file.
+func LoadLock(filename string) (*Lock, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading lock file: %w", err)
+	}
+
+	lock := NewLock()
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(lock); err != nil {
+		return nil, fmt.Errorf("parsing lock file %s: %w", filename, err)
+	}
+	if lock.Version != LockVersion {
+		return nil, fmt.Errorf("lock file %s: unsupported version %d", filename, lock.Version)
+	}
+	if lock.Sources == nil {
+		lock.Sources = make(map[string]LockEntry)
+	}
+	return lock, nil
+}
+
+// Save writes the lock atomically, with sources sorted by key.
+func (l *Lock) Save(filename string) error {
+	var buf bytes.Buffer
+	buf.WriteString(lockHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(l); err != nil {
+		return fmt.Errorf("encoding lock file: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("encoding lock file: %w", err)
+	}
+
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing lock file: %w", err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing lock file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLock_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFileName)
+	lock := NewLock()
+	lock.Sources["oci://ghcr.io/org/app:v1"] = LockEntry{Digest: "sha256:bb", Resolved: "sha256:cc"}
+	lock.Sources["file:base"] = LockEntry{Digest: "sha256:aa"}
+	if err := lock.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Generated by `many lock update`. Do not edit.\n" +
+		"version: 1\n" +
+		"sources:\n" +
+		"  file:base:\n" +
+		"    digest: sha256:aa\n" +
+		"  oci://ghcr.io/org/app:v1:\n" +
+		"    digest: sha256:bb\n" +
+		"    resolved: sha256:cc\n"
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+
+	loaded, err := LoadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Sources) != 2 || loaded.Sources["oci://ghcr.io/org/app:v1"].Resolved != "sha256:cc" {
+		t.Errorf("unexpected lock: %+v", loaded)
+	}
+}
+
+func TestLoadLock_Errors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"unsupported version": "version: 2\nsources: {}\n",
+		"unknown field":       "version: 1\nsources:\n  file:a:\n    sha: x\n",
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadLock(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
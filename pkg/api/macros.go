@@ -0,0 +1,327 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// MacroLibrary is the format of a macro library file, listed in the macros
+// field of a pipeline.
+type MacroLibrary struct {
+	Macros map[string]Macro `yaml:"macros"`
+}
+
+// Macro is a named bundle of steps, invoked by a single step with use and
+// expanded into its steps when the pipeline is loaded. String values of the
+// steps may reference parameters as ${{ .name }}.
+type Macro struct {
+	Description string                `yaml:"description,omitempty"`
+	Params      map[string]MacroParam `yaml:"params,omitempty"`
+	Steps       []StepConfig          `yaml:"steps"`
+}
+
+// MacroParam declares a macro parameter. A parameter without a default must
+// be passed with with.
+type MacroParam struct {
+	Description string `yaml:"description,omitempty"`
+	Default     any    `yaml:"default,omitempty"`
+}
+
+// macro is a Macro as read from its library, with the steps kept as YAML so
+// that parameters are substituted before they are decoded.
+type macro struct {
+	name   string
+	params map[string]MacroParam
+	steps  *yaml.Node // sequence of steps
+	file   string
+	doc    *yaml.Node
+}
+
+// expandMacros replaces every step of l that uses a macro with the macro's
+// steps, named "<step>/<macro step>". Macros are looked up in the libraries
+// listed in l's macros field, relative to dir.
+func expandMacros(ctx context.Context, l *layer, dir string, remote bool) error {
+	uses := slices.ContainsFunc(l.p.Pipeline, func(s StepConfig) bool { return s.Use != "" })
+	if !uses && len(l.p.Macros) == 0 {
+		return nil
+	}
+	macros, err := loadMacros(ctx, l, dir, remote)
+	if err != nil {
+		return err
+	}
+
+	steps := make([]StepConfig, 0, len(l.p.Pipeline))
+	origins := make([]origin, 0, len(l.steps))
+	for i, step := range l.p.Pipeline {
+		if step.Use == "" {
+			steps, origins = append(steps, step), append(origins, l.steps[i])
+			continue
+		}
+		expanded, from, err := expandStep(step, i, macros, l.steps[i], len(l.p.Extends) > 0)
+		if err != nil {
+			return err
+		}
+		steps, origins = append(steps, expanded...), append(origins, from...)
+	}
+	l.p.Pipeline, l.steps = steps, origins
+	return nil
+}
+
+// loadMacros reads the macro libraries listed in l's macros field. A macro
+// name may only be defined once across them.
+func loadMacros(ctx context.Context, l *layer, dir string, remote bool) (map[string]*macro, error) {
+	macros := make(map[string]*macro)
+	for i, ref := range l.p.Macros {
+		lib, err := loadLibrary(ctx, ref, dir, remote)
+		if err != nil {
+			return nil, locate(l.file, l.doc, atPath(fmt.Errorf("macros %s: %w", ref, err), "macros", i))
+		}
+		for _, m := range lib {
+			if prev, ok := macros[m.name]; ok {
+				return nil, locate(m.file, m.doc, atPath(fmt.Errorf("macro %q is already defined in %s", m.name, prev.file), "macros", m.name))
+			}
+			macros[m.name] = m
+		}
+	}
+	return macros, nil
+}
+
+// loadLibrary reads the macro library ref. Parameter references are parsed,
+// so that syntax errors are reported even for macros that are not used.
+func loadLibrary(ctx context.Context, ref, dir string, remote bool) ([]*macro, error) {
+	f, cleanup, err := fetch(ctx, ref, dir, remote)
+	if err != nil {
+		return nil, err
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading macro library: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing macro library: %w", err)
+	}
+	if err := checkKnownFields(f.display, &doc, reflect.TypeFor[MacroLibrary]()); err != nil {
+		return nil, err
+	}
+	var defs *yaml.Node
+	if root := nodeAt(&doc, nil); root != nil {
+		defs, _ = step(root, "macros")
+	}
+	if defs == nil || defs.Kind != yaml.MappingNode || len(defs.Content) == 0 {
+		return nil, locate(f.display, &doc, fmt.Errorf("macro library defines no macros"))
+	}
+
+	var lib []*macro
+	for i := 0; i+1 < len(defs.Content); i += 2 {
+		name, def := defs.Content[i].Value, defs.Content[i+1]
+		at := func(err error, path ...any) *LocatedError {
+			return locate(f.display, &doc, atPath(fmt.Errorf("macro %q: %w", name, err), append([]any{"macros", name}, path...)...))
+		}
+		if err := checkKnownFields(f.display, def, reflect.TypeFor[Macro]()); err != nil {
+			return nil, err
+		}
+		var m struct {
+			Params map[string]MacroParam `yaml:"params"`
+		}
+		if err := def.Decode(&m); err != nil {
+			return nil, at(err, "params")
+		}
+		steps, _ := step(def, "steps")
+		if steps == nil || steps.Kind != yaml.SequenceNode || len(steps.Content) == 0 {
+			return nil, at(fmt.Errorf("steps are required"))
+		}
+		for j, s := range steps.Content {
+			if n, _ := step(s, "name"); n == nil || n.Value == "" {
+				return nil, at(fmt.Errorf("step %d: name is required", j), "steps", j)
+			}
+			for _, field := range []string{"use", "before", "after"} {
+				if n, _ := step(s, field); n != nil {
+					return nil, at(fmt.Errorf("step %d: %s is not allowed in a macro", j, field), "steps", j, field)
+				}
+			}
+		}
+		err := eachString(steps, func(n *yaml.Node) error {
+			if _, err := paramTemplate(name, n.Value); err != nil {
+				return &LocatedError{File: f.display, Line: n.Line, Column: n.Column, Err: fmt.Errorf("macro %q: %w", name, err)}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		lib = append(lib, &macro{name: name, params: m.Params, steps: steps, file: f.display, doc: &doc})
+	}
+	return lib, nil
+}
+
+// expandStep expands step, at index i of its pipeline, into the steps of the
+// macro it uses. The steps keep the order of the macro, including when step
+// is placed with before or after.
+func expandStep(step StepConfig, i int, macros map[string]*macro, o origin, extends bool) ([]StepConfig, []origin, error) {
+	if step.Name == "" {
+		return nil, nil, o.at(fmt.Errorf("step %d: name is required", i), "name")
+	}
+	rest := step
+	rest.Name, rest.Use, rest.With, rest.Before, rest.After = "", "", nil, "", ""
+	if !reflect.DeepEqual(rest, StepConfig{}) {
+		return nil, nil, o.at(fmt.Errorf("step %q: a step with use only takes name, with, before and after", step.Name))
+	}
+	if (step.Before != "" || step.After != "") && !extends {
+		field := "before"
+		if step.Before == "" {
+			field = "after"
+		}
+		return nil, nil, o.at(fmt.Errorf("step %q: %s is only allowed in a pipeline with extends", step.Name, field), field)
+	}
+
+	m, ok := macros[step.Use]
+	if !ok {
+		names := make([]string, 0, len(macros))
+		for name := range macros {
+			names = append(names, name)
+		}
+		return nil, nil, o.at(fmt.Errorf("step %q: unknown macro %q%s", step.Name, step.Use, suggest(step.Use, names)), "use")
+	}
+	args, err := macroArgs(m, step.With)
+	if err != nil {
+		return nil, nil, o.at(fmt.Errorf("step %q: %w", step.Name, err))
+	}
+
+	node := cloneNode(m.steps)
+	err = eachString(node, func(n *yaml.Node) error {
+		var buf bytes.Buffer
+		tmpl, err := paramTemplate(m.name, n.Value)
+		if err == nil {
+			err = tmpl.Execute(&buf, args)
+		}
+		if err != nil {
+			return &LocatedError{File: m.file, Line: n.Line, Column: n.Column, Err: fmt.Errorf("step %q: macro %q: %w", step.Name, m.name, err)}
+		}
+		n.Value = buf.String()
+		if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			n.Tag = "" // resolved again, e.g. to a bool
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var steps []StepConfig
+	if err := node.Decode(&steps); err != nil {
+		return nil, nil, o.at(fmt.Errorf("step %q: expanding macro %q: %w", step.Name, m.name, err), "use")
+	}
+	origins := make([]origin, len(steps))
+	for j := range steps {
+		macroStep := steps[j].Name
+		steps[j].Name = step.Name + "/" + macroStep
+		switch {
+		case step.Before != "":
+			steps[j].Before = step.Before
+		case step.After != "" && j == 0:
+			steps[j].After = step.After
+		case step.After != "":
+			steps[j].After = steps[j-1].Name
+		}
+		origins[j] = origin{file: m.file, doc: m.doc, path: []any{"macros", m.name, "steps", j}}
+	}
+	return steps, origins, nil
+}
+
+// macroArgs returns the parameters of m: the values passed with with, or the
+// defaults. Errors carry the path of the offending argument.
+func macroArgs(m *macro, with map[string]any) (map[string]any, error) {
+	params := make([]string, 0, len(m.params))
+	for name := range m.params {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+
+	given := make([]string, 0, len(with))
+	for name := range with {
+		given = append(given, name)
+	}
+	sort.Strings(given)
+	for _, name := range given {
+		if _, ok := m.params[name]; !ok {
+			return nil, atPath(fmt.Errorf("macro %q has no parameter %q%s", m.name, name, suggest(name, params)), "with", name)
+		}
+	}
+
+	args := make(map[string]any, len(params))
+	var missing []string
+	for _, name := range params {
+		switch v, ok := with[name]; {
+		case ok:
+			args[name] = v
+		case m.params[name].Default != nil:
+			args[name] = m.params[name].Default
+		default:
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, atPath(fmt.Errorf("macro %q requires parameters %s", m.name, strings.Join(missing, ", ")), "with")
+	}
+	return args, nil
+}
+
+// paramTemplate parses a string value of a macro step. Parameters are
+// referenced as ${{ .name }}, leaving {{ }} to the templates rendered when the
+// step runs. Unknown parameters are an error.
+func paramTemplate(name, value string) (*template.Template, error) {
+	tmpl, err := template.New(name).Delims("${{", "}}").Funcs(sprig.FuncMap()).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("parsing parameter reference: %w", err)
+	}
+	return tmpl, nil
+}
+
+// eachString calls fn for every scalar value, not mapping key, below n that
+// references a parameter.
+func eachString(n *yaml.Node, fn func(*yaml.Node) error) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if strings.Contains(n.Value, "${{") {
+			return fn(n)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := eachString(n.Content[i], fn); err != nil {
+				return err
+			}
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := eachString(c, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cloneNode deep-copies n, so that a macro can be expanded more than once.
+func cloneNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = cloneNode(child)
+	}
+	return &c
+}
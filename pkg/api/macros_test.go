@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const macroLibrary = `macros:
+  helm-kustomize-split:
+    description: Render a Helm chart with kustomize and split the output.
+    params:
+      namespace: {}
+      outputDir:
+        default: manifests
+      enableHelm:
+        default: true
+    steps:
+      - name: build
+        type: kustomize-build
+        kustomize-build:
+          enableHelm: ${{ .enableHelm }}
+          outputFile: ${{ .outputDir }}/all.yaml
+      - name: split
+        type: split
+        split:
+          input: ${{ .outputDir }}/all.yaml
+          by: kind
+          fileNameTemplate: "{{ .kind }}-${{ .namespace }}.yaml"
+      - name: namespace
+        type: generate
+        generate:
+          output: ${{ .outputDir }}/namespace.yaml
+          template: |
+            kind: Namespace
+            metadata:
+              name: ${{ .namespace | quote }}
+`
+
+func TestLoadPipeline_Macros(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "_lib", "macros.yaml"), macroLibrary)
+	writeFile(t, filepath.Join(dir, "dex", ".many.yaml"), `macros: ../_lib/macros.yaml
+pipeline:
+  - name: render
+    type: template
+    template: {}
+  - name: dex
+    use: helm-kustomize-split
+    with:
+      namespace: dex
+  - name: crds
+    use: helm-kustomize-split
+    with:
+      namespace: dex-crds
+      outputDir: crds
+      enableHelm: false
+`)
+
+	p, err := LoadPipeline(t.Context(), filepath.Join(dir, "dex", ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"render", "dex/build", "dex/split", "dex/namespace", "crds/build", "crds/split", "crds/namespace"}
+	if got := stepNames(p); !reflect.DeepEqual(got, want) {
+		t.Fatalf("steps = %v, want %v", got, want)
+	}
+
+	dex, crds := p.Pipeline[1:4], p.Pipeline[4:]
+	if got := dex[0].KustomizeBuild; got.OutputFile != "manifests/all.yaml" || !got.EnableHelm {
+		t.Errorf("expected defaults to apply, got %+v", got)
+	}
+	if got := crds[0].KustomizeBuild; got.OutputFile != "crds/all.yaml" || got.EnableHelm {
+		t.Errorf("expected arguments to apply, got %+v", got)
+	}
+	if got, want := dex[1].Split.FileNameTemplate, "{{ .kind }}-dex.yaml"; got != want {
+		t.Errorf("fileNameTemplate = %q, want %q", got, want)
+	}
+	if got := crds[2].Generate.Template; !strings.Contains(got, `name: "dex-crds"`) {
+		t.Errorf("expected the namespace in the template, got %q", got)
+	}
+	for _, s := range p.Pipeline {
+		if s.Use != "" || s.With != nil {
+			t.Errorf("step %q: use not expanded", s.Name)
+		}
+	}
+}
+
+func TestLoadPipeline_MacrosWithExtends(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "macros.yaml"), macroLibrary)
+	writeFile(t, filepath.Join(dir, "base.yaml"), `macros: macros.yaml
+pipeline:
+  - name: render
+    type: template
+    template: {}
+  - name: app
+    use: helm-kustomize-split
+    with: {namespace: app}
+  - name: kustomization
+    type: kustomize-create
+    kustomize-create:
+      autodetect: true
+`)
+	writeFile(t, filepath.Join(dir, ".many.yaml"), `extends: base.yaml
+macros: macros.yaml
+pipeline:
+  - name: extra
+    use: helm-kustomize-split
+    after: render
+    with: {namespace: extra, outputDir: extra}
+`)
+
+	p, err := LoadPipeline(t.Context(), filepath.Join(dir, ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"render", "extra/build", "extra/split", "extra/namespace",
+		"app/build", "app/split", "app/namespace", "kustomization",
+	}
+	if got := stepNames(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+}
+
+func TestLoadPipeline_MacroErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		library  string
+		pipeline string
+		file     string // file the error is located in
+		line     int
+		want     string
+	}{
+		{
+			name:     "unknown macro",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: helm-kustomize-splt\n",
+			file:     ".many.yaml", line: 4,
+			want: `unknown macro "helm-kustomize-splt", did you mean "helm-kustomize-split"?`,
+		},
+		{
+			name:     "unknown parameter",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: helm-kustomize-split\n    with:\n      namespace: a\n      outputDirs: b\n",
+			file:     ".many.yaml", line: 7,
+			want: `has no parameter "outputDirs", did you mean "outputDir"?`,
+		},
+		{
+			name:     "missing parameter",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: helm-kustomize-split\n    with: {outputDir: b}\n",
+			file:     ".many.yaml", line: 5,
+			want: "requires parameters namespace",
+		},
+		{
+			name:     "use with type",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    type: template\n    use: helm-kustomize-split\n",
+			file:     ".many.yaml", line: 3,
+			want: "only takes name, with, before and after",
+		},
+		{
+			name:     "after without extends",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: helm-kustomize-split\n    after: b\n    with: {namespace: a}\n",
+			file:     ".many.yaml", line: 5,
+			want: "after is only allowed in a pipeline with extends",
+		},
+		{
+			name:     "duplicate step name",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: helm-kustomize-split\n    with: {namespace: a}\n  - name: a/split\n    type: template\n    template: {}\n",
+			file:     ".many.yaml", line: 6,
+			want: `duplicate step name "a/split"`,
+		},
+		{
+			name:     "undefined parameter reference",
+			library:  "macros:\n  m:\n    steps:\n      - name: s\n        type: copy\n        copy:\n          dest: ${{ .dest }}\n",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: m\n",
+			file:     "lib.yaml", line: 7,
+			want: `map has no entry for key "dest"`,
+		},
+		{
+			name:     "invalid expanded step",
+			library:  "macros:\n  m:\n    params: {input: {default: ''}}\n    steps:\n      - name: s\n        type: split\n        split:\n          input: ${{ .input }}\n",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: m\n",
+			file:     "lib.yaml", line: 7,
+			want: `step "a/s": split.input is required`,
+		},
+		{
+			name:     "use in macro",
+			library:  "macros:\n  m:\n    steps:\n      - name: s\n        use: other\n",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    use: m\n",
+			file:     ".many.yaml", line: 1,
+			want: "use is not allowed in a macro",
+		},
+		{
+			name:     "parameter syntax error",
+			library:  "macros:\n  m:\n    steps:\n      - name: s\n        type: copy\n        copy:\n          dest: ${{ .dest\n",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    type: template\n    template: {}\n",
+			file:     ".many.yaml", line: 1,
+			want: "parsing parameter reference",
+		},
+		{
+			name:     "unknown field in macro",
+			library:  "macros:\n  m:\n    parms: {}\n    steps: []\n",
+			pipeline: "macros: lib.yaml\npipeline:\n  - name: a\n    type: template\n    template: {}\n",
+			file:     ".many.yaml", line: 1,
+			want: `unknown field "parms", did you mean "params"?`,
+		},
+		{
+			name:     "use without macros",
+			pipeline: "pipeline:\n  - name: a\n    use: helm-kustomize-split\n",
+			file:     ".many.yaml", line: 3,
+			want: `unknown macro "helm-kustomize-split"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			library := tt.library
+			if library == "" {
+				library = macroLibrary
+			}
+			writeFile(t, filepath.Join(dir, "lib.yaml"), library)
+			writeFile(t, filepath.Join(dir, ".many.yaml"), tt.pipeline)
+
+			_, err := LoadPipeline(t.Context(), filepath.Join(dir, ".many.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+			var le *LocatedError
+			if !errors.As(err, &le) {
+				t.Fatalf("expected a LocatedError, got %T", err)
+			}
+			if filepath.Base(le.File) != tt.file || le.Line != tt.line {
+				t.Errorf("located at %s:%d, want %s:%d", le.File, le.Line, tt.file, tt.line)
+			}
+		})
+	}
+}
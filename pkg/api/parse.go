@@ -1,22 +1,32 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"gopkg.in/yaml.v3"
 )
 
-// LoadPipeline reads a .many.yaml file, sets Dir/FilePath, and validates it.
-func LoadPipeline(filename string) (*Pipeline, error) {
+// LoadPipeline reads a .many.yaml file, sets Dir/FilePath, expands the macros
+// its steps use, applies the base pipelines it extends, and validates the
+// result. Unknown fields are rejected. Unknown-field and validation errors are
+// reported as *LocatedError with the file, line and column of the offending
+// node, in the base pipeline or macro library file if that is where it was
+// declared. Remote bases and macro libraries are fetched within ctx.
+func LoadPipeline(ctx context.Context, filename string) (*Pipeline, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("reading pipeline file: %w", err)
 	}
 
-	var p Pipeline
-	if err := yaml.Unmarshal(data, &p); err != nil {
+	l, err := decodeLayer(filename, data)
+	if err != nil {
 		return nil, fmt.Errorf("parsing pipeline file: %w", err)
 	}
 
@@ -24,12 +34,42 @@ func LoadPipeline(filename string) (*Pipeline, error) {
 	if err != nil {
 		return nil, fmt.Errorf("resolving absolute path: %w", err)
 	}
-	p.FilePath = absPath
-	p.Dir = filepath.Dir(absPath)
+	l.p.FilePath = absPath
+	l.p.Dir = filepath.Dir(absPath)
+
+	if err := expandMacros(ctx, l, l.p.Dir, false); err != nil {
+		return nil, fmt.Errorf("expanding macros: %w", err)
+	}
 
-	if err := p.Validate(); err != nil {
-		return nil, fmt.Errorf("validating pipeline %s: %w", filename, err)
+	if len(l.p.Extends) > 0 {
+		if l, err = extend(ctx, l, l.p.Dir, []string{absPath}, false); err != nil {
+			return nil, fmt.Errorf("extending pipeline: %w", err)
+		}
 	}
 
-	return &p, nil
+	if err := l.p.Validate(); err != nil {
+		return nil, fmt.Errorf("validating pipeline: %w", l.locate(err))
+	}
+
+	return l.p, nil
+}
+
+// decodeLayer parses the pipeline file data, read from file, rejecting
+// unknown fields.
+func decodeLayer(file string, data []byte) (*layer, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by the caller
+	}
+	if err := checkKnownFields(file, &doc, reflect.TypeFor[Pipeline]()); err != nil {
+		return nil, err
+	}
+
+	var p Pipeline
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err //nolint:wrapcheck // wrapped by the caller
+	}
+	return newLayer(&p, file, &doc), nil
 }
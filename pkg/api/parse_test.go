@@ -35,7 +35,7 @@ pipeline:
 		t.Fatal(err)
 	}
 
-	p, err := LoadPipeline(f)
+	p, err := LoadPipeline(t.Context(), f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -51,8 +51,40 @@ pipeline:
 	}
 }
 
+func TestLoadPipeline_MergeKeys(t *testing.T) {
+	content := `
+context:
+  defaults: &defaults
+    replicas: 1
+  app:
+    <<: *defaults
+    name: app
+  render: &render
+    type: template
+    template: {}
+pipeline:
+  - name: render
+    <<: *render
+`
+	f := filepath.Join(t.TempDir(), ".many.yaml")
+	if err := os.WriteFile(f, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPipeline(t.Context(), f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Pipeline[0].Type != StepTypeTemplate {
+		t.Errorf("expected the merged step type, got %q", p.Pipeline[0].Type)
+	}
+	if app, _ := p.Context["app"].(map[string]any); app["replicas"] != 1 {
+		t.Errorf("expected the merged context, got %v", p.Context["app"])
+	}
+}
+
 func TestLoadPipeline_FileNotFound(t *testing.T) {
-	_, err := LoadPipeline("/nonexistent/.many.yaml")
+	_, err := LoadPipeline(t.Context(), "/nonexistent/.many.yaml")
 	if err == nil {
 		t.Fatal("expected error for missing file")
 	}
@@ -68,7 +100,7 @@ func TestLoadPipeline_InvalidYAML(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err := LoadPipeline(f)
+	_, err := LoadPipeline(t.Context(), f)
 	if err == nil {
 		t.Fatal("expected error for invalid YAML")
 	}
@@ -89,7 +121,7 @@ pipeline:
 		t.Fatal(err)
 	}
 
-	_, err := LoadPipeline(f)
+	_, err := LoadPipeline(t.Context(), f)
 	if err == nil {
 		t.Fatal("expected validation error")
 	}
@@ -97,3 +129,80 @@ pipeline:
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestLoadPipeline_Errors_Located(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "unknown field",
+			content: `pipeline:
+  - name: build
+    type: kustomize-build
+    kustomize-bulid:
+      outputFile: out.yaml
+`,
+			want: `:4:5: unknown field "kustomize-bulid", did you mean "kustomize-build"?`,
+		},
+		{
+			name: "unknown step type",
+			content: `pipeline:
+  - name: render
+    type: templte
+`,
+			want: `:3:11: step "render": unknown type "templte", did you mean "template"?`,
+		},
+		{
+			name: "invalid source field",
+			content: `pipeline:
+  - name: render
+    type: template
+    template: {}
+    source:
+      - file: .
+      - https: https://example.com/a.tar.gz
+        sha256: nothex
+`,
+			want: `:8:17: step "render": source[1]: sha256 must be exactly 64 lowercase hex characters`,
+		},
+		{
+			name: "missing nested field",
+			content: `pipeline:
+  - name: build
+    type: kustomize-build
+    kustomize-build:
+      dir: .
+`,
+			want: `:4:5: step "build": kustomize-build.outputFile is required`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filepath.Join(t.TempDir(), ".many.yaml")
+			if err := os.WriteFile(f, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadPipeline(t.Context(), f)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), f+tt.want) {
+				t.Errorf("error %q does not contain %q", err.Error(), f+tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPipeline_Empty(t *testing.T) {
+	f := filepath.Join(t.TempDir(), ".many.yaml")
+	if err := os.WriteFile(f, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadPipeline(t.Context(), f)
+	if err == nil || !strings.Contains(err.Error(), "pipeline has no steps") {
+		t.Fatalf("expected no-steps error, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"reflect"
+	"sort"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// PipelineSchema returns a JSON Schema (draft 2020-12) for .many.yaml files.
+// It is generated from the Go types and mirrors the checks of Validate that
+// JSON Schema can express; path traversal and glob syntax are only checked by
+// Validate.
+func PipelineSchema() map[string]any {
+	return newSchemaGen(true).document(reflect.TypeFor[Pipeline](), "many pipeline (.many.yaml)")
+}
+
+// InstancesSchema returns a JSON Schema (draft 2020-12) for instances files.
+// Uniqueness of instance names and outputs is only checked by Validate.
+func InstancesSchema() map[string]any {
+	return newSchemaGen(false).document(reflect.TypeFor[InstancesConfig](), "many instances file")
+}
+
+// schemaRequired lists the fields each struct requires. Required string fields
+// must also be non-empty.
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeFor[StepConfig]():           {"name"},
+	reflect.TypeFor[KustomizeBuildConfig](): {"outputFile"},
+	reflect.TypeFor[HelmConfig]():           {"chart", "releaseName"},
+	reflect.TypeFor[GenerateConfig]():       {"output", "template"},
+	reflect.TypeFor[SplitConfig]():          {"input"},
+	reflect.TypeFor[InstancesConfig]():      {"instances"},
+	reflect.TypeFor[Instance]():             {"name", "output"},
+}
+
+// schemaRefinements add constraints that cannot be derived from the types.
+var schemaRefinements = map[reflect.Type]func(s map[string]any){
+	reflect.TypeFor[Pipeline](): func(s map[string]any) {
+		// Steps may all come from the pipelines it extends.
+		s["anyOf"] = []any{
+			map[string]any{
+				"properties": map[string]any{"pipeline": map[string]any{"minItems": 1}},
+				"required":   []string{"pipeline"},
+			},
+			map[string]any{"required": []string{"extends"}},
+		}
+		// Steps can only be placed relative to those of a base pipeline.
+		placed := map[string]any{"anyOf": []any{
+			map[string]any{"required": []string{"before"}},
+			map[string]any{"required": []string{"after"}},
+		}}
+		s["allOf"] = []any{implies(
+			map[string]any{
+				"properties": map[string]any{"pipeline": map[string]any{"contains": placed}},
+				"required":   []string{"pipeline"},
+			},
+			map[string]any{"required": []string{"extends"}},
+		)}
+	},
+	reflect.TypeFor[StepConfig]():  refineStepSchema,
+	reflect.TypeFor[SourceEntry](): refineSourceEntrySchema,
+	reflect.TypeFor[SplitConfig](): func(s map[string]any) {
+		prop(s, "by")["enum"] = sortedKeys(validSplitStrategies)
+		s["allOf"] = []any{implies(requireConst("by", SplitByCustom), requireNonEmpty("fileNameTemplate"))}
+	},
+	reflect.TypeFor[KustomizeBuildConfig](): func(s map[string]any) {
+		prop(s, "engine")["enum"] = sortedKeys(validKustomizeEngines)
+	},
+	reflect.TypeFor[KustomizeCreateConfig](): func(s map[string]any) {
+		prop(s, "engine")["enum"] = sortedKeys(validKustomizeEngines)
+		s["anyOf"] = []any{
+			requireTrue("autodetect"),
+			map[string]any{
+				"properties": map[string]any{"resources": map[string]any{"minItems": 1}},
+				"required":   []string{"resources"},
+			},
+		}
+		s["allOf"] = []any{implies(requireTrue("recursive"), requireTrue("autodetect"))}
+	},
+	reflect.TypeFor[InstancesConfig](): func(s map[string]any) {
+		prop(s, "instances")["minItems"] = 1
+	},
+}
+
+// refineStepSchema restricts type to the known step types and requires the
+// config block matching the type, as validateStepConfig does. Steps using a
+// macro have no type.
+func refineStepSchema(s map[string]any) {
+	types := sortedKeys(validStepTypes)
+	prop(s, "type")["enum"] = types
+
+	// A step either has a type or uses a macro, which takes its arguments.
+	s["oneOf"] = []any{requireNonEmpty("type"), requireNonEmpty("use")}
+	coupling := make([]any, 0, len(types)+1)
+	for _, t := range types {
+		coupling = append(coupling, implies(requireConst("type", t), map[string]any{"required": []string{t}}))
+	}
+	coupling = append(coupling, implies(map[string]any{"required": []string{"with"}}, requireNonEmpty("use")))
+	s["allOf"] = coupling
+}
+
+// refineSourceEntrySchema requires exactly one scheme and ties scheme-specific
+// options to their scheme, as validateSourceEntry does.
+func refineSourceEntrySchema(s map[string]any) {
+	schemes := []string{"oci", "https", "file", "ocm", "helm", "git"}
+	oneOf := make([]any, 0, len(schemes))
+	for _, scheme := range schemes {
+		oneOf = append(oneOf, requireNonEmpty(scheme))
+	}
+	s["oneOf"] = oneOf
+
+	// An empty sha256 or commit means "compute and write back".
+	prop(s, "sha256")["pattern"] = "^([0-9a-f]{64})?$"
+	prop(s, "commit")["pattern"] = "^([0-9a-f]{40}|[0-9a-f]{64})?$"
+	prop(s, "digest")["pattern"] = "^(sha256:[0-9a-f]{64})?$"
+	// git and ref are passed to git fetch and must not look like options.
+	prop(s, "git")["pattern"] = "^([^-].*)?$"
+	prop(s, "ref")["pattern"] = "^([^-].*)?$"
+	prop(s, "archive")["enum"] = sortedKeys(validArchiveFormats)
+	prop(s, "onConflict")["enum"] = sortedKeys(validOnConflict)
+	prop(s, "timeout")["pattern"] = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+	s["allOf"] = []any{
+		implies(requireNonEmpty("helm"), requireNonEmpty("repo")),
+		implies(requireNonEmpty("repo"), requireNonEmpty("helm")),
+		implies(requireNonEmpty("version"), requireNonEmpty("helm")),
+		implies(requireNonEmpty("ref"), requireNonEmpty("git")),
+		implies(requireNonEmpty("commit"), requireNonEmpty("git")),
+		implies(requireNonEmpty("sha256"), requireNonEmpty("https")),
+		implies(requireNonEmpty("digest"), requireNonEmpty("oci")),
+		implies(requireNonEmpty("archive"), requireNonEmpty("https")),
+		implies(map[string]any{"required": []string{"headers"}}, requireNonEmpty("https")),
+		implies(requireTrue("recursive"), requireNonEmpty("ocm")),
+	}
+}
+
+type schemaGen struct {
+	strict bool // reject unknown fields, as LoadPipeline does
+	defs   map[string]any
+}
+
+func newSchemaGen(strict bool) *schemaGen {
+	return &schemaGen{strict: strict, defs: make(map[string]any)}
+}
+
+func (g *schemaGen) document(t reflect.Type, title string) map[string]any {
+	root := g.structSchema(t)
+	root["$schema"] = schemaDialect
+	root["title"] = title
+	if len(g.defs) > 0 {
+		root["$defs"] = g.defs
+	}
+	return root
+}
+
+func (g *schemaGen) typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeFor[Refs]() {
+		ref := map[string]any{"type": "string", "minLength": 1}
+		return map[string]any{
+			"oneOf": []any{ref, map[string]any{"type": "array", "items": ref, "minItems": 1}},
+		}
+	}
+	if t == reflect.TypeFor[Sources]() {
+		entry := g.typeSchema(reflect.TypeFor[SourceEntry]())
+		return map[string]any{
+			"oneOf": []any{entry, map[string]any{"type": "array", "items": entry}},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		s := map[string]any{"type": "object"}
+		if t.Elem().Kind() != reflect.Interface {
+			s["additionalProperties"] = g.typeSchema(t.Elem())
+		}
+		return s
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = true // placeholder, guards against recursion
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	fields := yamlFields(t)
+	props := make(map[string]any, len(fields))
+	for name, ft := range fields {
+		props[name] = g.typeSchema(ft)
+	}
+
+	s := map[string]any{"type": "object", "properties": props}
+	if g.strict {
+		s["additionalProperties"] = false
+	}
+
+	if required := schemaRequired[t]; len(required) > 0 {
+		s["required"] = required
+		for _, name := range required {
+			if fields[name].Kind() == reflect.String {
+				props[name].(map[string]any)["minLength"] = 1
+			}
+		}
+	}
+	if refine := schemaRefinements[t]; refine != nil {
+		refine(s)
+	}
+	return s
+}
+
+// prop returns the schema of property name in the object schema s.
+func prop(s map[string]any, name string) map[string]any {
+	return s["properties"].(map[string]any)[name].(map[string]any)
+}
+
+// implies returns a subschema enforcing then whenever cond matches.
+func implies(cond, then map[string]any) map[string]any {
+	return map[string]any{"if": cond, "then": then}
+}
+
+// requireConst returns a subschema requiring name to equal value.
+func requireConst(name string, value any) map[string]any {
+	return map[string]any{
+		"properties": map[string]any{name: map[string]any{"const": value}},
+		"required":   []string{name},
+	}
+}
+
+// requireTrue returns a subschema requiring the boolean name to be true.
+func requireTrue(name string) map[string]any {
+	return requireConst(name, true)
+}
+
+// requireNonEmpty returns a subschema requiring name to be present and non-empty.
+func requireNonEmpty(name string) map[string]any {
+	return map[string]any{
+		"properties": map[string]any{name: map[string]any{"minLength": 1}},
+		"required":   []string{name},
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
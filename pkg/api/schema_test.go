@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"gopkg.in/yaml.v3"
+)
+
+func compileSchema(t *testing.T, schema map[string]any) *jsonschema.Schema {
+	t.Helper()
+	doc := jsonRoundTrip(t, schema)
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("schema.json", doc); err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Compile("schema.json")
+	if err != nil {
+		t.Fatalf("schema does not compile: %v", err)
+	}
+	return s
+}
+
+// jsonRoundTrip converts v into the generic form the validator expects.
+func jsonRoundTrip(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func yamlInstance(t *testing.T, src string) any {
+	t.Helper()
+	var v any
+	if err := yaml.Unmarshal([]byte(src), &v); err != nil {
+		t.Fatal(err)
+	}
+	return jsonRoundTrip(t, v)
+}
+
+const (
+	testSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	testCommit = "0123456789abcdef0123456789abcdef01234567"
+)
+
+// TestPipelineSchema_AgreesWithValidate keeps the schema and the Go
+// validators from drifting: every document must be accepted or rejected by both.
+func TestPipelineSchema_AgreesWithValidate(t *testing.T) {
+	schema := compileSchema(t, PipelineSchema())
+
+	step := func(body string) string { return "pipeline:\n  - name: s\n" + body }
+	tests := []struct {
+		name  string
+		yaml  string
+		valid bool
+	}{
+		{"minimal template", step("    type: template\n    template: {}\n"), true},
+		{"no steps", "pipeline: []\n", false},
+		{"missing pipeline", "context: {a: 1}\n", false},
+		{"unknown top-level field", "pipelines: []\n", false},
+		{"unknown step field", step("    type: template\n    template: {}\n    tempalte: {}\n"), false},
+		{"missing step name", "pipeline:\n  - type: template\n    template: {}\n", false},
+		{"unknown step type", step("    type: templte\n    template: {}\n"), false},
+		{"type without config block", step("    type: helm\n"), false},
+		{"kustomize-build ok", step("    type: kustomize-build\n    kustomize-build:\n      dir: .\n      outputFile: out.yaml\n"), true},
+		{"kustomize-build no outputFile", step("    type: kustomize-build\n    kustomize-build:\n      dir: .\n"), false},
+		{"kustomize-build exec engine", step("    type: kustomize-build\n    kustomize-build:\n      outputFile: out.yaml\n      engine: exec\n"), true},
+		{"kustomize-build unknown engine", step("    type: kustomize-build\n    kustomize-build:\n      outputFile: out.yaml\n      engine: docker\n"), false},
+		{"kustomize-create unknown engine", step("    type: kustomize-create\n    kustomize-create:\n      autodetect: true\n      engine: docker\n"), false},
+		{"helm ok", step("    type: helm\n    helm:\n      chart: ./c\n      releaseName: r\n      set: {a: b}\n"), true},
+		{"helm no releaseName", step("    type: helm\n    helm:\n      chart: ./c\n"), false},
+		{"generate no template", step("    type: generate\n    generate:\n      output: a.yaml\n"), false},
+		{"split ok", step("    type: split\n    split:\n      input: all.yaml\n      by: kind\n"), true},
+		{"split invalid by", step("    type: split\n    split:\n      input: all.yaml\n      by: knd\n"), false},
+		{"split custom without template", step("    type: split\n    split:\n      input: all.yaml\n      by: custom\n"), false},
+		{"split custom ok", step("    type: split\n    split:\n      input: all.yaml\n      by: custom\n      fileNameTemplate: x\n"), true},
+		{"kustomize-create autodetect", step("    type: kustomize-create\n    kustomize-create:\n      autodetect: true\n      recursive: true\n"), true},
+		{"kustomize-create nothing", step("    type: kustomize-create\n    kustomize-create:\n      dir: .\n"), false},
+		{"kustomize-create recursive without autodetect", step("    type: kustomize-create\n    kustomize-create:\n      resources: [a.yaml]\n      recursive: true\n"), false},
+		{"copy ok", step("    type: copy\n    copy:\n      files:\n        include: ['*']\n      dest: out/\n"), true},
+		{"single source map", "source:\n  oci: ghcr.io/a/b:v1\n" + step("    type: template\n    template: {}\n"), true},
+		{"source list", step("    type: template\n    template: {}\n    source:\n      - file: .\n      - git: https://example.com/r.git\n        ref: main\n        commit: " + testCommit + "\n"), true},
+		{"source without scheme", step("    type: template\n    template: {}\n    source:\n      path: x/\n"), false},
+		{"source with two schemes", step("    type: template\n    template: {}\n    source:\n      file: .\n      oci: a/b:v1\n"), false},
+		{"https with sha256", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      sha256: " + testSHA256 + "\n"), true},
+		{"https with empty sha256", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      sha256: \"\"\n"), true},
+		{"bad sha256", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      sha256: ABC\n"), false},
+		{"sha256 on oci", step("    type: template\n    template: {}\n    source:\n      oci: a/b:v1\n      sha256: " + testSHA256 + "\n"), false},
+		{"oci with digest", step("    type: template\n    template: {}\n    source:\n      oci: a/b:v1\n      digest: sha256:" + testSHA256 + "\n"), true},
+		{"oci with empty digest", step("    type: template\n    template: {}\n    source:\n      oci: a/b:v1\n      digest: \"\"\n"), true},
+		{"bad digest", step("    type: template\n    template: {}\n    source:\n      oci: a/b:v1\n      digest: " + testSHA256 + "\n"), false},
+		{"digest on https", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      digest: sha256:" + testSHA256 + "\n"), false},
+		{"https with archive", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/release\n      archive: tar.zst\n"), true},
+		{"unknown archive", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/release\n      archive: rar\n"), false},
+		{"archive on file", step("    type: template\n    template: {}\n    source:\n      file: .\n      archive: zip\n"), false},
+		{"https with headers", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      headers:\n        PRIVATE-TOKEN: ${TOKEN}\n"), true},
+		{"headers on file", step("    type: template\n    template: {}\n    source:\n      file: .\n      headers:\n        Accept: '*/*'\n"), false},
+		{"onConflict merge-yaml", step("    type: template\n    template: {}\n    source:\n      file: .\n      onConflict: merge-yaml\n"), true},
+		{"unknown onConflict", step("    type: template\n    template: {}\n    source:\n      file: .\n      onConflict: merge\n"), false},
+		{"source timeout", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      timeout: 2m30s\n"), true},
+		{"malformed timeout", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      timeout: 2 minutes\n"), false},
+		{"https with subdir and include", step("    type: template\n    template: {}\n    source:\n      https: https://example.com/a.tgz\n      subdir: deploy\n      include: ['**/*.yaml']\n      exclude: [tests/**]\n"), true},
+		{"helm source without repo", step("    type: template\n    template: {}\n    source:\n      helm: chart\n"), false},
+		{"repo without helm", step("    type: template\n    template: {}\n    source:\n      file: .\n      repo: https://charts\n"), false},
+		{"ref without git", step("    type: template\n    template: {}\n    source:\n      file: .\n      ref: main\n"), false},
+		{"short commit", step("    type: template\n    template: {}\n    source:\n      git: https://example.com/r.git\n      commit: abc123\n"), false},
+		{"recursive without ocm", step("    type: template\n    template: {}\n    source:\n      file: .\n      recursive: true\n"), false},
+		{"recursive with ocm", step("    type: template\n    template: {}\n    source:\n      ocm: a//b:v1\n      recursive: true\n"), true},
+		{"unknown source field", step("    type: template\n    template: {}\n    source:\n      file: .\n      sha265: x\n"), false},
+		{"extends without steps", "extends: base.yaml\ncontext: {a: 1}\n", true},
+		{"extends list", "extends: [base.yaml]\n" + step("    type: template\n    template: {}\n    after: base\n"), true},
+		{"empty extends", "extends: ''\n", false},
+		{"before without extends", step("    type: template\n    template: {}\n    before: other\n"), false},
+		{"use", "macros: lib.yaml\n" + step("    use: render\n    with: {dir: out}\n"), true},
+		{"use with type", "macros: lib.yaml\n" + step("    use: render\n    type: template\n"), false},
+		{"with without use", step("    type: template\n    template: {}\n    with: {dir: out}\n"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			base := "pipeline:\n  - name: base\n    type: template\n    template: {}\n"
+			if err := os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(base), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			lib := "macros:\n  render:\n    params: {dir: {}}\n    steps:\n      - name: render\n        type: generate\n        generate:\n          output: ${{ .dir }}/a.yaml\n          template: a\n"
+			if err := os.WriteFile(filepath.Join(dir, "lib.yaml"), []byte(lib), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			f := filepath.Join(dir, ".many.yaml")
+			if err := os.WriteFile(f, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, goErr := LoadPipeline(t.Context(), f)
+			schemaErr := schema.Validate(yamlInstance(t, tt.yaml))
+
+			if (goErr == nil) != tt.valid {
+				t.Errorf("LoadPipeline: valid=%v, want %v (err: %v)", goErr == nil, tt.valid, goErr)
+			}
+			if (schemaErr == nil) != tt.valid {
+				t.Errorf("schema: valid=%v, want %v (err: %v)", schemaErr == nil, tt.valid, schemaErr)
+			}
+		})
+	}
+}
+
+func TestInstancesSchema_AgreesWithValidate(t *testing.T) {
+	schema := compileSchema(t, InstancesSchema())
+
+	tests := []struct {
+		name  string
+		yaml  string
+		valid bool
+	}{
+		{"valid", "instances:\n  - name: a\n    output: a/\n    include: [x]\n    context: {k: v}\n", true},
+		{"empty", "instances: []\n", false},
+		{"missing name", "instances:\n  - output: a/\n", false},
+		{"missing output", "instances:\n  - name: a\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filepath.Join(t.TempDir(), "instances.yaml")
+			if err := os.WriteFile(f, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, goErr := LoadInstances(f)
+			schemaErr := schema.Validate(yamlInstance(t, tt.yaml))
+
+			if (goErr == nil) != tt.valid {
+				t.Errorf("LoadInstances: valid=%v, want %v (err: %v)", goErr == nil, tt.valid, goErr)
+			}
+			if (schemaErr == nil) != tt.valid {
+				t.Errorf("schema: valid=%v, want %v (err: %v)", schemaErr == nil, tt.valid, schemaErr)
+			}
+		})
+	}
+}
+
+// TestPipelineSchema_CoversAllStepTypes guards against adding a step type
+// without a matching config-block rule.
+func TestPipelineSchema_CoversAllStepTypes(t *testing.T) {
+	data, err := json.Marshal(PipelineSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for stepType := range validStepTypes {
+		if !strings.Contains(string(data), `"then":{"required":["`+stepType+`"]}`) {
+			t.Errorf("schema has no config-block rule for step type %q", stepType)
+		}
+	}
+}
+
+// TestPublishedSchemas_UpToDate checks the schema files in schema/ match the
+// generated schemas. Regenerate them with `make schema`.
+func TestPublishedSchemas_UpToDate(t *testing.T) {
+	for file, schema := range map[string]map[string]any{
+		"pipeline.schema.json":  PipelineSchema(),
+		"instances.schema.json": InstancesSchema(),
+	} {
+		want, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join("..", "..", "schema", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want)+"\n" {
+			t.Errorf("schema/%s is out of date, run `make schema`", file)
+		}
+	}
+}
@@ -141,7 +141,7 @@ pipeline:
 		t.Fatal(err)
 	}
 
-	p, err := LoadPipeline(pipelineFile)
+	p, err := LoadPipeline(t.Context(), pipelineFile)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -161,3 +161,43 @@ pipeline:
 		t.Errorf("expected path 'extra/', got %q", step.Source[0].Path)
 	}
 }
+
+func TestSourceEntry_URI_Git(t *testing.T) {
+	e := SourceEntry{Git: "https://example.com/repo.git", Ref: "v1"}
+	if got := e.URI(); got != "git+https://example.com/repo.git" {
+		t.Errorf("URI() = %q", got)
+	}
+	if got := e.SchemeCount(); got != 1 {
+		t.Errorf("SchemeCount() = %d, want 1", got)
+	}
+}
+
+func TestLoadPipeline_WithPipelineSource(t *testing.T) {
+	dir := t.TempDir()
+	pipelineYAML := `
+source:
+  ocm: ghcr.io/myorg/ocm//github.com/myorg/my-templates:v1.0.0
+  recursive: true
+pipeline:
+  - name: render
+    type: template
+    template:
+      files:
+        include: ["**/*.yaml"]
+`
+	pipelineFile := filepath.Join(dir, ".many.yaml")
+	if err := os.WriteFile(pipelineFile, []byte(pipelineYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPipeline(t.Context(), pipelineFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Source) != 1 {
+		t.Fatalf("expected 1 pipeline source, got %d", len(p.Source))
+	}
+	if p.Source[0].OCM != "ghcr.io/myorg/ocm//github.com/myorg/my-templates:v1.0.0" || !p.Source[0].Recursive {
+		t.Errorf("unexpected pipeline source: %+v", p.Source[0])
+	}
+}
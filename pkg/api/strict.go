@@ -0,0 +1,173 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkKnownFields reports the first mapping key in node that has no
+// corresponding yaml field in t, with its position and a suggestion for the
+// closest known key. Values that do not have the shape t expects are skipped;
+// decoding reports those.
+func checkKnownFields(file string, node *yaml.Node, t reflect.Type) error {
+	if node == nil {
+		return nil
+	}
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.DocumentNode {
+		for _, c := range node.Content {
+			if err := checkKnownFields(file, c, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return checkStructFields(file, node, t)
+	case reflect.Slice:
+		switch node.Kind {
+		case yaml.SequenceNode:
+			for _, c := range node.Content {
+				if err := checkKnownFields(file, c, t.Elem()); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			// Single-entry shorthand, as accepted by Sources.
+			return checkKnownFields(file, node, t.Elem())
+		}
+	}
+	return nil
+}
+
+func checkStructFields(file string, node *yaml.Node, t reflect.Type) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	fields := yamlFields(t)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if key.Tag == "!!merge" {
+			if err := checkMerged(file, node.Content[i+1], t); err != nil {
+				return err
+			}
+			continue
+		}
+		field, ok := fields[key.Value]
+		if !ok {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			return &LocatedError{
+				File:   file,
+				Line:   key.Line,
+				Column: key.Column,
+				Err:    fmt.Errorf("unknown field %q%s", key.Value, suggest(key.Value, names)),
+			}
+		}
+		if err := checkKnownFields(file, node.Content[i+1], field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMerged checks the mappings merged into a mapping of type t by a merge
+// key (<<), which are an alias, a mapping or a sequence of those.
+func checkMerged(file string, value *yaml.Node, t reflect.Type) error {
+	for value.Kind == yaml.AliasNode {
+		value = value.Alias
+	}
+	if value.Kind != yaml.SequenceNode {
+		return checkStructFields(file, value, t)
+	}
+	for _, c := range value.Content {
+		if err := checkMerged(file, c, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlFields maps the yaml keys of struct type t to their field types,
+// following inline fields.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(opts, "inline") {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// suggest returns `, did you mean "x"?` for the candidate closest to name,
+// or "" if none is close enough to be a plausible typo.
+func suggest(name string, candidates []string) string {
+	sort.Strings(candidates)
+
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		d := levenshtein(strings.ToLower(name), strings.ToLower(c))
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+
+	maxDist := max(1, len(name)/3)
+	if best == "" || bestDist > maxDist {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
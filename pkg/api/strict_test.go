@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kustomize-bulid", "kustomize-build", 2},
+		{"outputfile", "outputfile", 0},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"outputFile", "dir", "enableHelm"}
+	if got := suggest("outputfile", candidates); got != `, did you mean "outputFile"?` {
+		t.Errorf("unexpected suggestion %q", got)
+	}
+	if got := suggest("zzz", candidates); got != "" {
+		t.Errorf("expected no suggestion, got %q", got)
+	}
+}
+
+func TestCheckKnownFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		wantErr  string
+		wantLine int
+		wantCol  int
+	}{
+		{
+			name: "valid",
+			yaml: "pipeline:\n  - name: a\n    type: template\n    template:\n      files:\n        include: [x]\n",
+		},
+		{
+			name:     "misspelled step config",
+			yaml:     "pipeline:\n  - name: a\n    type: kustomize-build\n    kustomize-bulid:\n      dir: .\n",
+			wantErr:  `unknown field "kustomize-bulid", did you mean "kustomize-build"?`,
+			wantLine: 4,
+			wantCol:  5,
+		},
+		{
+			name:     "wrong case",
+			yaml:     "pipeline:\n  - name: a\n    type: kustomize-build\n    kustomize-build:\n      outputfile: out.yaml\n",
+			wantErr:  `unknown field "outputfile", did you mean "outputFile"?`,
+			wantLine: 5,
+			wantCol:  7,
+		},
+		{
+			name:     "single-map source",
+			yaml:     "source:\n  https: https://example.com\n  sha265: abc\npipeline: []\n",
+			wantErr:  `unknown field "sha265", did you mean "sha256"?`,
+			wantLine: 3,
+			wantCol:  3,
+		},
+		{
+			name: "merge keys",
+			yaml: "context:\n  step: &step\n    type: template\n  cfg: &cfg {files: {include: [x]}}\npipeline:\n  - name: a\n    <<: [*step, {when: .x}]\n    template:\n      <<: *cfg\n",
+		},
+		{
+			name:     "unknown field in merged mapping",
+			yaml:     "context:\n  step: &step\n    typ: template\npipeline:\n  - name: a\n    <<: *step\n",
+			wantErr:  `unknown field "typ", did you mean "type"?`,
+			wantLine: 3,
+			wantCol:  5,
+		},
+		{
+			name: "free-form context",
+			yaml: "context:\n  anything:\n    goes: here\npipeline: []\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.yaml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			err := checkKnownFields("f.yaml", &doc, reflect.TypeFor[Pipeline]())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var le *LocatedError
+			if !errors.As(err, &le) {
+				t.Fatalf("expected LocatedError, got %v", err)
+			}
+			if !strings.Contains(le.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", le.Error(), tt.wantErr)
+			}
+			if le.Line != tt.wantLine || le.Column != tt.wantCol {
+				t.Errorf("position = %d:%d, want %d:%d", le.Line, le.Column, tt.wantLine, tt.wantCol)
+			}
+		})
+	}
+}
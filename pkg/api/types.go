@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -22,20 +23,63 @@ const (
 	SplitByGroup    = "group"
 	SplitByKindDir  = "kind-dir"
 	SplitByCustom   = "custom"
+
+	KustomizeEngineBuiltin = "builtin" // in-process kustomize library (default)
+	KustomizeEngineExec    = "exec"    // kustomize binary on PATH
+
+	ArchiveAuto   = "auto" // detect from the URL extension or magic bytes (default)
+	ArchiveNone   = "none" // keep the download as a single file
+	ArchiveZip    = "zip"
+	ArchiveTar    = "tar"
+	ArchiveTarGz  = "tar.gz"
+	ArchiveTarXz  = "tar.xz"
+	ArchiveTarZst = "tar.zst"
+	ArchiveTarBz2 = "tar.bz2"
+
+	OnConflictOverwrite = "overwrite"  // replace the existing file (default)
+	OnConflictSkip      = "skip"       // keep the existing file
+	OnConflictError     = "error"      // fail the step
+	OnConflictMergeYAML = "merge-yaml" // deep-merge into the existing YAML file
 )
 
 // SourceEntry represents a single source to fetch and overlay.
 type SourceEntry struct {
-	OCI       string `yaml:"oci,omitempty"`
-	HTTPS     string `yaml:"https,omitempty"`
-	File      string `yaml:"file,omitempty"`
-	OCM       string `yaml:"ocm,omitempty"`
-	Helm      string `yaml:"helm,omitempty"`      // Helm chart name
-	Repo      string `yaml:"repo,omitempty"`      // Helm chart repository URL (helm only)
-	Version   string `yaml:"version,omitempty"`   // Helm chart version (helm only)
-	SHA256    string `yaml:"sha256,omitempty"`    // optional checksum for HTTPS sources
-	Recursive bool   `yaml:"recursive,omitempty"` // only valid with OCM
-	Path      string `yaml:"path,omitempty"`      // target subdirectory within pipeline dir
+	OCI        string            `yaml:"oci,omitempty"`
+	HTTPS      string            `yaml:"https,omitempty"`
+	File       string            `yaml:"file,omitempty"`
+	OCM        string            `yaml:"ocm,omitempty"`
+	Helm       string            `yaml:"helm,omitempty"`       // Helm chart name
+	Git        string            `yaml:"git,omitempty"`        // Git repository URL
+	Repo       string            `yaml:"repo,omitempty"`       // Helm chart repository URL (helm only)
+	Version    string            `yaml:"version,omitempty"`    // Helm chart version (helm only)
+	Ref        string            `yaml:"ref,omitempty"`        // branch, tag or commit (git only)
+	Commit     string            `yaml:"commit,omitempty"`     // pinned commit SHA (git only)
+	SHA256     string            `yaml:"sha256,omitempty"`     // optional checksum for HTTPS sources
+	Archive    string            `yaml:"archive,omitempty"`    // archive format override (https only)
+	Headers    map[string]string `yaml:"headers,omitempty"`    // request headers, may reference ${ENV} (https only)
+	Digest     string            `yaml:"digest,omitempty"`     // pinned manifest digest, written back (oci only)
+	Recursive  bool              `yaml:"recursive,omitempty"`  // only valid with OCM
+	Subdir     string            `yaml:"subdir,omitempty"`     // source subdirectory to use as the root
+	Include    []string          `yaml:"include,omitempty"`    // globs selecting files below the root
+	Exclude    []string          `yaml:"exclude,omitempty"`    // globs of files below the root to leave out
+	Path       string            `yaml:"path,omitempty"`       // target subdirectory within pipeline dir
+	OnConflict string            `yaml:"onConflict,omitempty"` // what to do when a file already exists in the work dir
+	Timeout    string            `yaml:"timeout,omitempty"`    // limit on fetching the source, e.g. "2m"
+}
+
+// TimeoutDuration returns the parsed timeout, or 0 if none is set.
+func (e SourceEntry) TimeoutDuration() (time.Duration, error) {
+	if e.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(e.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", e.Timeout, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive, got %q", e.Timeout)
+	}
+	return d, nil
 }
 
 // URI returns the resolve-compatible URI string.
@@ -51,6 +95,8 @@ func (e SourceEntry) URI() string {
 		return "ocm://" + e.OCM
 	case e.Helm != "":
 		return "helm://" + e.Helm
+	case e.Git != "":
+		return "git+" + e.Git
 	default:
 		return ""
 	}
@@ -74,6 +120,9 @@ func (e SourceEntry) SchemeCount() int {
 	if e.Helm != "" {
 		n++
 	}
+	if e.Git != "" {
+		n++
+	}
 	return n
 }
 
@@ -103,18 +152,33 @@ func (s *Sources) UnmarshalYAML(value *yaml.Node) error {
 
 // Pipeline is the .many.yaml configuration format.
 type Pipeline struct {
+	Extends  Refs           `yaml:"extends,omitempty"` // base pipelines applied beneath this one
+	Macros   Refs           `yaml:"macros,omitempty"`  // macro libraries providing the steps named by use
 	Context  map[string]any `yaml:"context"`
+	Source   Sources        `yaml:"source,omitempty"` // resolved into the work dir before the first step
 	Pipeline []StepConfig   `yaml:"pipeline"`
 
 	// Set by the loader, not from YAML.
-	Dir      string `yaml:"-"`
-	FilePath string `yaml:"-"`
+	Dir      string   `yaml:"-"`
+	FilePath string   `yaml:"-"`
+	Bases    []string `yaml:"-"` // local base pipeline files, for write-back
+}
+
+// Files returns the pipeline file followed by its local base files: every
+// file declaring a source of the pipeline that can be written back to.
+func (p *Pipeline) Files() []string {
+	return append([]string{p.FilePath}, p.Bases...)
 }
 
 // StepConfig defines a single step within a pipeline.
 type StepConfig struct {
 	Name            string                 `yaml:"name"`
 	Type            string                 `yaml:"type"`
+	Use             string                 `yaml:"use,omitempty"`    // macro expanded in place of this step when loading
+	With            map[string]any         `yaml:"with,omitempty"`   // macro parameters
+	When            string                 `yaml:"when,omitempty"`   // template condition; the step is skipped when falsy
+	Before          string                 `yaml:"before,omitempty"` // insert before this base step (extends only)
+	After           string                 `yaml:"after,omitempty"`  // insert after this base step (extends only)
 	Source          Sources                `yaml:"source,omitempty"`
 	Exclude         []string               `yaml:"exclude,omitempty"`
 	Template        *TemplateConfig        `yaml:"template,omitempty"`
@@ -140,8 +204,9 @@ type TemplateConfig struct {
 // KustomizeBuildConfig configures the kustomize-build step.
 type KustomizeBuildConfig struct {
 	Dir        string `yaml:"dir"`
-	EnableHelm bool   `yaml:"enableHelm"`
+	EnableHelm bool   `yaml:"enableHelm"` // inflate helmCharts; runs the helm binary on PATH
 	OutputFile string `yaml:"outputFile,omitempty"`
+	Engine     string `yaml:"engine,omitempty"` // builtin (default) or exec
 }
 
 // HelmConfig configures the helm step.
@@ -150,7 +215,13 @@ type HelmConfig struct {
 	ReleaseName string            `yaml:"releaseName"`
 	Namespace   string            `yaml:"namespace"`
 	ValuesFiles []string          `yaml:"valuesFiles"`
+	Values      map[string]any    `yaml:"values,omitempty"` // merged over valuesFiles; strings are rendered against the context
 	Set         map[string]string `yaml:"set"`
+	APIVersions []string          `yaml:"apiVersions,omitempty"` // extra Capabilities.APIVersions
+	KubeVersion string            `yaml:"kubeVersion,omitempty"` // Capabilities.KubeVersion
+	IncludeCRDs bool              `yaml:"includeCRDs,omitempty"`
+	SkipTests   bool              `yaml:"skipTests,omitempty"`
+	IsUpgrade   bool              `yaml:"isUpgrade,omitempty"` // set .Release.IsUpgrade instead of .Release.IsInstall
 	OutputFile  string            `yaml:"outputFile,omitempty"`
 }
 
@@ -171,6 +242,7 @@ type KustomizeCreateConfig struct {
 	NameSuffix  string            `yaml:"namesuffix"`
 	Annotations map[string]string `yaml:"annotations"`
 	Labels      map[string]string `yaml:"labels"`
+	Engine      string            `yaml:"engine,omitempty"` // builtin (default) or exec
 }
 
 // SplitConfig configures the split step.
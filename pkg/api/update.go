@@ -7,14 +7,37 @@ import (
 	"os"
 	"strings"
 
+	"github.com/systemstart/many-templates/pkg/resolve"
 	"gopkg.in/yaml.v3"
 )
 
+// SourcePin records a pinning value (checksum, commit, digest) to write back
+// onto a source entry in a pipeline file. A pin whose Field is its Scheme
+// points the entry at a new URI; pins are applied in order, so pins of the
+// same entry that match the old URI must come first.
+type SourcePin struct {
+	Scheme string            // scheme key identifying the entry, e.g. "https" or "git"
+	URI    string            // value of the scheme key
+	Match  map[string]string // further fields that must match; "" matches an absent field
+	Field  string            // field to set, e.g. "sha256" or "commit"
+	Value  string
+}
+
 // UpdateSourceSHA256 reads a .many.yaml file, finds HTTPS source entries whose
 // URL matches a key in updates, and sets the corresponding sha256 value.
 // It uses yaml.Node-based round-tripping to preserve comments and formatting.
 func UpdateSourceSHA256(filePath string, updates map[string]string) error {
-	if len(updates) == 0 {
+	pins := make([]SourcePin, 0, len(updates))
+	for url, sha := range updates {
+		pins = append(pins, SourcePin{Scheme: "https", URI: url, Field: "sha256", Value: sha})
+	}
+	return UpdateSourcePins(filePath, pins)
+}
+
+// UpdateSourcePins reads a .many.yaml file and sets each pin's field on every
+// source entry it matches, preserving comments and formatting.
+func UpdateSourcePins(filePath string, pins []SourcePin) error {
+	if len(pins) == 0 {
 		return nil
 	}
 
@@ -32,7 +55,7 @@ func UpdateSourceSHA256(filePath string, updates map[string]string) error {
 		return fmt.Errorf("unexpected YAML structure in %s", filePath)
 	}
 
-	if !walkAndUpdate(doc.Content[0], updates) {
+	if !walkAndUpdate(doc.Content[0], pins) {
 		return nil
 	}
 
@@ -40,8 +63,12 @@ func UpdateSourceSHA256(filePath string, updates map[string]string) error {
 		return err
 	}
 
-	for url, sha := range updates {
-		slog.Info("updated sha256 in pipeline file", "file", filePath, "url", url, "sha256", sha)
+	for _, pin := range pins {
+		if pin.Field == pin.Scheme {
+			slog.Info("updated "+pin.Scheme+" source in pipeline file", "file", filePath, "from", resolve.RedactURL(pin.URI), "to", resolve.RedactURL(pin.Value))
+			continue
+		}
+		slog.Info("updated "+pin.Field+" in pipeline file", "file", filePath, pin.Scheme, resolve.RedactURL(pin.URI), pin.Field, pin.Value)
 	}
 
 	return nil
@@ -83,9 +110,9 @@ func writeYAMLFile(filePath string, doc *yaml.Node, originalData []byte) error {
 }
 
 // walkAndUpdate recursively walks the YAML node tree looking for mapping nodes
-// that contain an "https" key matching a URL in updates. When found, it updates
-// the sibling "sha256" value (or inserts one if missing).
-func walkAndUpdate(node *yaml.Node, updates map[string]string) bool {
+// that match a pin. When found, it updates the pinned field's value (or
+// inserts one if missing).
+func walkAndUpdate(node *yaml.Node, pins []SourcePin) bool {
 	if node == nil {
 		return false
 	}
@@ -93,10 +120,14 @@ func walkAndUpdate(node *yaml.Node, updates map[string]string) bool {
 	modified := false
 
 	if node.Kind == yaml.MappingNode {
-		modified = updateMapping(node, updates)
+		for _, pin := range pins {
+			if updateMapping(node, pin) {
+				modified = true
+			}
+		}
 		// Also recurse into mapping values.
 		for i := 1; i < len(node.Content); i += 2 {
-			if walkAndUpdate(node.Content[i], updates) {
+			if walkAndUpdate(node.Content[i], pins) {
 				modified = true
 			}
 		}
@@ -104,66 +135,77 @@ func walkAndUpdate(node *yaml.Node, updates map[string]string) bool {
 	}
 
 	for _, child := range node.Content {
-		if walkAndUpdate(child, updates) {
+		if walkAndUpdate(child, pins) {
 			modified = true
 		}
 	}
 	return modified
 }
 
-// updateMapping checks if a mapping node has an "https" key whose value matches
-// an entry in updates. If so, it updates or inserts the "sha256" key.
-func updateMapping(node *yaml.Node, updates map[string]string) bool {
-	httpsIdx := -1
-	sha256Idx := -1
-
+// mappingValues returns the scalar values of a mapping node by key, along
+// with each key's index in node.Content.
+func mappingValues(node *yaml.Node) (map[string]string, map[string]int) {
+	values := make(map[string]string)
+	indexes := make(map[string]int)
 	for i := 0; i < len(node.Content)-1; i += 2 {
 		key := node.Content[i]
 		if key.Kind == yaml.ScalarNode {
-			switch key.Value {
-			case "https":
-				httpsIdx = i
-			case "sha256":
-				sha256Idx = i
-			}
+			values[key.Value] = node.Content[i+1].Value
+			indexes[key.Value] = i
 		}
 	}
+	return values, indexes
+}
 
-	if httpsIdx < 0 {
-		return false
-	}
+// updateMapping checks if a mapping node is the source entry identified by pin.
+// If so, it updates or inserts the pinned field after the identifying fields.
+func updateMapping(node *yaml.Node, pin SourcePin) bool {
+	values, indexes := mappingValues(node)
 
-	httpsValue := node.Content[httpsIdx+1].Value
-	newSHA, ok := updates[httpsValue]
-	if !ok {
+	schemeIdx, ok := indexes[pin.Scheme]
+	if !ok || values[pin.Scheme] != pin.URI {
 		return false
 	}
-
-	if sha256Idx >= 0 {
-		// Update existing sha256 value.
-		node.Content[sha256Idx+1].Value = newSHA
-		node.Content[sha256Idx+1].Style = yaml.DoubleQuotedStyle
-	} else {
-		// Insert sha256 key+value after the https pair.
-		keyNode := &yaml.Node{
-			Kind:  yaml.ScalarNode,
-			Tag:   "!!str",
-			Value: "sha256",
+	insertPos := schemeIdx + 2
+	for k, v := range pin.Match {
+		if values[k] != v {
+			return false
 		}
-		valueNode := &yaml.Node{
-			Kind:  yaml.ScalarNode,
-			Tag:   "!!str",
-			Value: newSHA,
-			Style: yaml.DoubleQuotedStyle,
+		if idx, ok := indexes[k]; ok && idx+2 > insertPos {
+			insertPos = idx + 2
 		}
+	}
 
-		insertPos := httpsIdx + 2
-		newContent := make([]*yaml.Node, 0, len(node.Content)+2)
-		newContent = append(newContent, node.Content[:insertPos]...)
-		newContent = append(newContent, keyNode, valueNode)
-		newContent = append(newContent, node.Content[insertPos:]...)
-		node.Content = newContent
+	if idx, ok := indexes[pin.Field]; ok {
+		// Update existing value. A replaced URI keeps its quoting; the
+		// encoder still quotes it if it would no longer read as a string.
+		value := node.Content[idx+1]
+		value.Value = pin.Value
+		value.Tag = "!!str"
+		if pin.Field != pin.Scheme {
+			value.Style = yaml.DoubleQuotedStyle
+		}
+		return true
+	}
+
+	// Insert key+value after the identifying pairs.
+	keyNode := &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: pin.Field,
 	}
+	valueNode := &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: pin.Value,
+		Style: yaml.DoubleQuotedStyle,
+	}
+
+	newContent := make([]*yaml.Node, 0, len(node.Content)+2)
+	newContent = append(newContent, node.Content[:insertPos]...)
+	newContent = append(newContent, keyNode, valueNode)
+	newContent = append(newContent, node.Content[insertPos:]...)
+	node.Content = newContent
 
 	return true
 }
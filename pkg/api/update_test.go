@@ -265,3 +265,114 @@ pipeline: []
 		t.Errorf("should not have leading --- when original didn't, got:\n%s", string(data))
 	}
 }
+
+func TestUpdateSourcePins_GitCommitMatchesRef(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, ".many.yaml")
+	content := `pipeline:
+  - name: a
+    type: template
+    source:
+      - git: "https://example.com/repo.git"
+        ref: v1
+        path: one/
+      - git: "https://example.com/repo.git"
+        ref: v2
+`
+	if err := os.WriteFile(f, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pins := []SourcePin{{
+		Scheme: "git",
+		URI:    "https://example.com/repo.git",
+		Match:  map[string]string{"ref": "v2", "subdir": ""},
+		Field:  "commit",
+		Value:  "abc",
+	}}
+	if err := UpdateSourcePins(f, pins); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(data)
+	if strings.Count(result, "commit:") != 1 {
+		t.Fatalf("expected exactly one commit field, got:\n%s", result)
+	}
+	if !strings.Contains(result, "ref: v2\n        commit: \"abc\"") {
+		t.Errorf("expected commit inserted after ref v2, got:\n%s", result)
+	}
+}
+
+func TestUpdateSourceSHA256_PipelineLevelSource(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, ".many.yaml")
+	content := `source:
+  https: https://example.com/a.tar.gz
+pipeline:
+  - name: render
+    type: template
+`
+	if err := os.WriteFile(f, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sha := strings.Repeat("ab", 32)
+	if err := UpdateSourceSHA256(f, map[string]string{"https://example.com/a.tar.gz": sha}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "https: https://example.com/a.tar.gz\n  sha256: \""+sha+"\"") {
+		t.Errorf("sha256 not written to pipeline-level source:\n%s", data)
+	}
+}
+
+func TestUpdateSourcePins_ReplacesURI(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, ".many.yaml")
+	content := `source:
+  # pinned release
+  - https: https://example.com/o/r/releases/download/v1.0.0/r-1.0.0.tar.gz
+    sha256: "aaa"
+  - oci: "registry.example.com/app:1.0.0"
+pipeline: []
+`
+	if err := os.WriteFile(f, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldURL := "https://example.com/o/r/releases/download/v1.0.0/r-1.0.0.tar.gz"
+	newURL := "https://example.com/o/r/releases/download/v1.1.0/r-1.1.0.tar.gz"
+	pins := []SourcePin{
+		{Scheme: "https", URI: oldURL, Field: "sha256", Value: "bbb"},
+		{Scheme: "https", URI: oldURL, Field: "https", Value: newURL},
+		{Scheme: "oci", URI: "registry.example.com/app:1.0.0", Field: "digest", Value: "sha256:ccc"},
+		{Scheme: "oci", URI: "registry.example.com/app:1.0.0", Field: "oci", Value: "registry.example.com/app:1.1.0"},
+	}
+	if err := UpdateSourcePins(f, pins); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `source:
+  # pinned release
+  - https: https://example.com/o/r/releases/download/v1.1.0/r-1.1.0.tar.gz
+    sha256: "bbb"
+  - oci: "registry.example.com/app:1.1.0"
+    digest: "sha256:ccc"
+pipeline: []
+`
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
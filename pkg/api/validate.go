@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/bmatcuk/doublestar/v4"
 )
 
@@ -19,7 +21,36 @@ var validStepTypes = map[string]bool{
 	StepTypeCopy:            true,
 }
 
-var sha256Re = regexp.MustCompile(`^[0-9a-f]{64}$`)
+var validKustomizeEngines = map[string]bool{
+	KustomizeEngineBuiltin: true,
+	KustomizeEngineExec:    true,
+}
+
+var validArchiveFormats = map[string]bool{
+	ArchiveAuto:   true,
+	ArchiveNone:   true,
+	ArchiveZip:    true,
+	ArchiveTar:    true,
+	ArchiveTarGz:  true,
+	ArchiveTarXz:  true,
+	ArchiveTarZst: true,
+	ArchiveTarBz2: true,
+}
+
+var validOnConflict = map[string]bool{
+	OnConflictOverwrite: true,
+	OnConflictSkip:      true,
+	OnConflictError:     true,
+	OnConflictMergeYAML: true,
+}
+
+var (
+	sha256Re    = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	gitCommitRe = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+	ociDigestRe = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+	// httpHeaderNameRe matches an RFC 9110 token.
+	httpHeaderNameRe = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+)
 
 var validSplitStrategies = map[string]bool{
 	SplitByKind:     true,
@@ -32,7 +63,11 @@ var validSplitStrategies = map[string]bool{
 // Validate checks the pipeline configuration for errors.
 func (p *Pipeline) Validate() error {
 	if len(p.Pipeline) == 0 {
-		return fmt.Errorf("pipeline has no steps")
+		return atPath(fmt.Errorf("pipeline has no steps"), "pipeline")
+	}
+
+	if err := validateSources(p.Source, "pipeline"); err != nil {
+		return atPath(err, "source")
 	}
 
 	return validateSteps(p.Pipeline)
@@ -42,29 +77,64 @@ func validateSteps(steps []StepConfig) error {
 	names := make(map[string]int)
 
 	for i, step := range steps {
-		if step.Name == "" {
-			return fmt.Errorf("step %d: name is required", i)
+		if err := validateStep(step, i, names); err != nil {
+			return atPath(err, "pipeline", i)
 		}
-		if prev, exists := names[step.Name]; exists {
-			return fmt.Errorf("step %d: duplicate step name %q (first defined at step %d)", i, step.Name, prev)
-		}
-		names[step.Name] = i
+	}
 
-		if err := validateSources(step.Source, fmt.Sprintf("step %q", step.Name)); err != nil {
-			return err
-		}
+	return nil
+}
+
+// validateStep checks a single step. Errors carry a document path relative to
+// the step.
+func validateStep(step StepConfig, i int, names map[string]int) error {
+	if step.Name == "" {
+		return atPath(fmt.Errorf("step %d: name is required", i), "name")
+	}
+	if prev, exists := names[step.Name]; exists {
+		return atPath(fmt.Errorf("step %d: duplicate step name %q (first defined at step %d)", i, step.Name, prev), "name")
+	}
+	names[step.Name] = i
 
-		if !validStepTypes[step.Type] {
-			return fmt.Errorf("step %q: unknown type %q", step.Name, step.Type)
+	if err := validateSources(step.Source, fmt.Sprintf("step %q", step.Name)); err != nil {
+		return atPath(err, "source")
+	}
+
+	if step.Before != "" || step.After != "" {
+		field := "before"
+		if step.Before == "" {
+			field = "after"
 		}
+		return atPath(fmt.Errorf("step %q: %s is only allowed in a pipeline with extends", step.Name, field), field)
+	}
+
+	if step.Use != "" {
+		return atPath(fmt.Errorf("step %q: macro %q is only expanded by LoadPipeline", step.Name, step.Use), "use")
+	}
+	if step.With != nil {
+		return atPath(fmt.Errorf("step %q: with is only allowed in a step with use", step.Name), "with")
+	}
 
-		if err := validateStepConfig(step); err != nil {
-			return fmt.Errorf("step %q: %w", step.Name, err)
+	if step.When != "" {
+		if _, err := ParseWhen(step.When); err != nil {
+			return atPath(fmt.Errorf("step %q: %w", step.Name, err), "when")
 		}
+	}
 
-		if err := validateExcludePatterns(step.Exclude); err != nil {
-			return fmt.Errorf("step %q: %w", step.Name, err)
+	if !validStepTypes[step.Type] {
+		types := make([]string, 0, len(validStepTypes))
+		for t := range validStepTypes {
+			types = append(types, t)
 		}
+		return atPath(fmt.Errorf("step %q: unknown type %q%s", step.Name, step.Type, suggest(step.Type, types)), "type")
+	}
+
+	if err := validateStepConfig(step); err != nil {
+		return fmt.Errorf("step %q: %w", step.Name, err)
+	}
+
+	if err := validateGlobPatterns("exclude", step.Exclude); err != nil {
+		return fmt.Errorf("step %q: %w", step.Name, atPath(err, "exclude"))
 	}
 
 	return nil
@@ -97,20 +167,36 @@ func validateKustomizeBuildConfig(step StepConfig) error {
 		return fmt.Errorf("kustomize-build config is required")
 	}
 	if step.KustomizeBuild.OutputFile == "" {
-		return fmt.Errorf("kustomize-build.outputFile is required")
+		return atPath(fmt.Errorf("kustomize-build.outputFile is required"), "kustomize-build")
+	}
+	if err := validateKustomizeEngine(step.KustomizeBuild.Engine); err != nil {
+		return atPath(fmt.Errorf("kustomize-build.%w", err), "kustomize-build", "engine")
 	}
 	return nil
 }
 
+func validateKustomizeEngine(engine string) error {
+	if engine == "" || validKustomizeEngines[engine] {
+		return nil
+	}
+	valid := sortedKeys(validKustomizeEngines)
+	return fmt.Errorf("engine %q is not valid%s (valid: %s)", engine, suggest(engine, valid), strings.Join(valid, ", "))
+}
+
 func validateHelmConfig(step StepConfig) error {
 	if step.Helm == nil {
 		return fmt.Errorf("helm config is required")
 	}
 	if step.Helm.Chart == "" {
-		return fmt.Errorf("helm.chart is required")
+		return atPath(fmt.Errorf("helm.chart is required"), "helm")
 	}
 	if step.Helm.ReleaseName == "" {
-		return fmt.Errorf("helm.releaseName is required")
+		return atPath(fmt.Errorf("helm.releaseName is required"), "helm")
+	}
+	if v := step.Helm.KubeVersion; v != "" {
+		if _, err := semver.NewVersion(v); err != nil {
+			return atPath(fmt.Errorf("helm.kubeVersion %q is not a valid version", v), "helm", "kubeVersion")
+		}
 	}
 	return nil
 }
@@ -120,10 +206,10 @@ func validateGenerateConfig(step StepConfig) error {
 		return fmt.Errorf("generate config is required")
 	}
 	if step.Generate.Output == "" {
-		return fmt.Errorf("generate.output is required")
+		return atPath(fmt.Errorf("generate.output is required"), "generate")
 	}
 	if step.Generate.Template == "" {
-		return fmt.Errorf("generate.template is required")
+		return atPath(fmt.Errorf("generate.template is required"), "generate")
 	}
 	return nil
 }
@@ -133,17 +219,18 @@ func validateSplitConfig(step StepConfig) error {
 		return fmt.Errorf("split config is required")
 	}
 	if step.Split.Input == "" {
-		return fmt.Errorf("split.input is required")
+		return atPath(fmt.Errorf("split.input is required"), "split")
 	}
 	if step.Split.By != "" && !validSplitStrategies[step.Split.By] {
 		valid := make([]string, 0, len(validSplitStrategies))
 		for k := range validSplitStrategies {
 			valid = append(valid, k)
 		}
-		return fmt.Errorf("split.by %q is not valid (valid: %s)", step.Split.By, strings.Join(valid, ", "))
+		sort.Strings(valid)
+		return atPath(fmt.Errorf("split.by %q is not valid%s (valid: %s)", step.Split.By, suggest(step.Split.By, valid), strings.Join(valid, ", ")), "split", "by")
 	}
 	if step.Split.By == SplitByCustom && step.Split.FileNameTemplate == "" {
-		return fmt.Errorf("split.fileNameTemplate is required when split.by is %q", SplitByCustom)
+		return atPath(fmt.Errorf("split.fileNameTemplate is required when split.by is %q", SplitByCustom), "split")
 	}
 	return nil
 }
@@ -154,16 +241,16 @@ func validateCopyConfig(step StepConfig) error {
 	}
 	if step.Copy.Dest != "" {
 		if err := validateSourcePath(step.Copy.Dest); err != nil {
-			return fmt.Errorf("copy.dest: %w", err)
+			return atPath(fmt.Errorf("copy.dest: %w", err), "copy", "dest")
 		}
 	}
 	return nil
 }
 
-func validateExcludePatterns(patterns []string) error {
+func validateGlobPatterns(field string, patterns []string) error {
 	for i, p := range patterns {
 		if !doublestar.ValidatePattern(p) {
-			return fmt.Errorf("exclude[%d]: invalid glob pattern %q", i, p)
+			return atPath(fmt.Errorf("%s[%d]: invalid glob pattern %q", field, i, p), i)
 		}
 	}
 	return nil
@@ -175,10 +262,13 @@ func validateKustomizeCreateConfig(step StepConfig) error {
 	}
 	cfg := step.KustomizeCreate
 	if !cfg.Autodetect && len(cfg.Resources) == 0 {
-		return fmt.Errorf("kustomize-create: at least one of autodetect or resources must be set")
+		return atPath(fmt.Errorf("kustomize-create: at least one of autodetect or resources must be set"), "kustomize-create")
 	}
 	if cfg.Recursive && !cfg.Autodetect {
-		return fmt.Errorf("kustomize-create: recursive requires autodetect to be enabled")
+		return atPath(fmt.Errorf("kustomize-create: recursive requires autodetect to be enabled"), "kustomize-create", "recursive")
+	}
+	if err := validateKustomizeEngine(cfg.Engine); err != nil {
+		return atPath(fmt.Errorf("kustomize-create.%w", err), "kustomize-create", "engine")
 	}
 	return nil
 }
@@ -186,7 +276,7 @@ func validateKustomizeCreateConfig(step StepConfig) error {
 func validateSources(sources Sources, label string) error {
 	for i, entry := range sources {
 		if err := validateSourceEntry(entry); err != nil {
-			return fmt.Errorf("%s: source[%d]: %w", label, i, err)
+			return atPath(fmt.Errorf("%s: source[%d]: %w", label, i, err), i)
 		}
 	}
 	return nil
@@ -199,39 +289,99 @@ func validateSourceEntry(entry SourceEntry) error {
 	if err := validateHelmFields(entry); err != nil {
 		return err
 	}
+	if err := validateGitFields(entry); err != nil {
+		return err
+	}
 	if err := validateSHA256Field(entry); err != nil {
 		return err
 	}
+	if err := validateDigestField(entry); err != nil {
+		return err
+	}
+	if err := validateArchiveField(entry); err != nil {
+		return err
+	}
+	if err := validateHeadersField(entry); err != nil {
+		return err
+	}
+	if err := validateSelectionFields(entry); err != nil {
+		return err
+	}
 	if entry.Path != "" {
 		if err := validateSourcePath(entry.Path); err != nil {
-			return fmt.Errorf("invalid path: %w", err)
+			return atPath(fmt.Errorf("invalid path: %w", err), "path")
 		}
 	}
+	if _, err := entry.TimeoutDuration(); err != nil {
+		return atPath(err, "timeout")
+	}
+	if entry.OnConflict != "" && !validOnConflict[entry.OnConflict] {
+		valid := sortedKeys(validOnConflict)
+		return atPath(fmt.Errorf("onConflict %q is not valid%s (valid: %s)", entry.OnConflict, suggest(entry.OnConflict, valid), strings.Join(valid, ", ")), "onConflict")
+	}
 	return nil
 }
 
 func validateSourceScheme(entry SourceEntry) error {
 	if entry.SchemeCount() == 0 {
-		return fmt.Errorf("exactly one of oci, https, file, ocm, or helm must be set")
+		return fmt.Errorf("exactly one of oci, https, file, ocm, helm, or git must be set")
 	}
 	if entry.SchemeCount() > 1 {
-		return fmt.Errorf("exactly one of oci, https, file, ocm, or helm must be set, got %d", entry.SchemeCount())
+		return fmt.Errorf("exactly one of oci, https, file, ocm, helm, or git must be set, got %d", entry.SchemeCount())
 	}
 	if entry.Recursive && entry.OCM == "" {
-		return fmt.Errorf("recursive is only valid when ocm is set")
+		return atPath(fmt.Errorf("recursive is only valid when ocm is set"), "recursive")
 	}
 	return nil
 }
 
 func validateHelmFields(entry SourceEntry) error {
 	if entry.Helm != "" && entry.Repo == "" {
-		return fmt.Errorf("repo is required when helm is set")
+		return atPath(fmt.Errorf("repo is required when helm is set"), "helm")
 	}
 	if entry.Repo != "" && entry.Helm == "" {
-		return fmt.Errorf("repo is only valid when helm is set")
+		return atPath(fmt.Errorf("repo is only valid when helm is set"), "repo")
 	}
 	if entry.Version != "" && entry.Helm == "" {
-		return fmt.Errorf("version is only valid when helm is set")
+		return atPath(fmt.Errorf("version is only valid when helm is set"), "version")
+	}
+	return nil
+}
+
+func validateGitFields(entry SourceEntry) error {
+	if entry.Git != "" {
+		if strings.HasPrefix(entry.Git, "-") {
+			return atPath(fmt.Errorf("git must not start with \"-\""), "git")
+		}
+		if strings.HasPrefix(entry.Ref, "-") {
+			return atPath(fmt.Errorf("ref must not start with \"-\""), "ref")
+		}
+		if entry.Commit != "" && !gitCommitRe.MatchString(entry.Commit) {
+			return atPath(fmt.Errorf("commit must be a full 40 or 64 character lowercase hex SHA"), "commit")
+		}
+		return nil
+	}
+	if entry.Ref != "" {
+		return atPath(fmt.Errorf("ref is only valid when git is set"), "ref")
+	}
+	if entry.Commit != "" {
+		return atPath(fmt.Errorf("commit is only valid when git is set"), "commit")
+	}
+	return nil
+}
+
+// validateSelectionFields checks the fields selecting part of a source.
+func validateSelectionFields(entry SourceEntry) error {
+	if entry.Subdir != "" {
+		if err := validateSourcePath(entry.Subdir); err != nil {
+			return atPath(fmt.Errorf("invalid subdir: %w", err), "subdir")
+		}
+	}
+	if err := validateGlobPatterns("include", entry.Include); err != nil {
+		return atPath(err, "include")
+	}
+	if err := validateGlobPatterns("exclude", entry.Exclude); err != nil {
+		return atPath(err, "exclude")
 	}
 	return nil
 }
@@ -241,10 +391,44 @@ func validateSHA256Field(entry SourceEntry) error {
 		return nil
 	}
 	if entry.HTTPS == "" {
-		return fmt.Errorf("sha256 is only supported for https sources")
+		return atPath(fmt.Errorf("sha256 is only supported for https sources"), "sha256")
 	}
 	if !sha256Re.MatchString(entry.SHA256) {
-		return fmt.Errorf("sha256 must be exactly 64 lowercase hex characters")
+		return atPath(fmt.Errorf("sha256 must be exactly 64 lowercase hex characters"), "sha256")
+	}
+	return nil
+}
+
+func validateArchiveField(entry SourceEntry) error {
+	if entry.Archive == "" {
+		return nil
+	}
+	if entry.HTTPS == "" {
+		return atPath(fmt.Errorf("archive is only valid when https is set"), "archive")
+	}
+	if !validArchiveFormats[entry.Archive] {
+		valid := sortedKeys(validArchiveFormats)
+		return atPath(fmt.Errorf("archive %q is not valid%s (valid: %s)", entry.Archive, suggest(entry.Archive, valid), strings.Join(valid, ", ")), "archive")
+	}
+	return nil
+}
+
+func validateHeadersField(entry SourceEntry) error {
+	if len(entry.Headers) == 0 {
+		return nil
+	}
+	if entry.HTTPS == "" {
+		return atPath(fmt.Errorf("headers is only valid when https is set"), "headers")
+	}
+	names := make([]string, 0, len(entry.Headers))
+	for name := range entry.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !httpHeaderNameRe.MatchString(name) {
+			return atPath(fmt.Errorf("%q is not a valid HTTP header name", name), "headers", name)
+		}
 	}
 	return nil
 }
@@ -259,3 +443,19 @@ func validateSourcePath(p string) error {
 	}
 	return nil
 }
+
+func validateDigestField(entry SourceEntry) error {
+	if entry.Digest == "" {
+		return nil
+	}
+	if entry.OCI == "" {
+		return atPath(fmt.Errorf("digest is only valid when oci is set"), "digest")
+	}
+	if !ociDigestRe.MatchString(entry.Digest) {
+		return atPath(fmt.Errorf("digest must be sha256: followed by 64 lowercase hex characters"), "digest")
+	}
+	if i := strings.Index(entry.OCI, "@"); i >= 0 && entry.OCI[i+1:] != entry.Digest {
+		return atPath(fmt.Errorf("digest conflicts with the digest in the oci reference"), "digest")
+	}
+	return nil
+}
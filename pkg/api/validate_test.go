@@ -301,7 +301,7 @@ func TestValidate_SourceNoScheme(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for source with no scheme")
 	}
-	if !strings.Contains(err.Error(), "exactly one of oci, https, file, ocm, or helm must be set") {
+	if !strings.Contains(err.Error(), "exactly one of oci, https, file, ocm, helm, or git must be set") {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -316,7 +316,7 @@ func TestValidate_SourceMultipleSchemes(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for source with multiple schemes")
 	}
-	if !strings.Contains(err.Error(), "exactly one of oci, https, file, ocm, or helm must be set") {
+	if !strings.Contains(err.Error(), "exactly one of oci, https, file, ocm, helm, or git must be set") {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -414,7 +414,23 @@ func TestValidate_StepSourceInvalid(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for step source with no scheme")
 	}
-	if !strings.Contains(err.Error(), "exactly one of oci, https, file, ocm, or helm must be set") {
+	if !strings.Contains(err.Error(), "exactly one of oci, https, file, ocm, helm, or git must be set") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidate_PipelineSourceInvalid(t *testing.T) {
+	p := &Pipeline{
+		Source: Sources{{HTTPS: "https://example.com/a.tar.gz", SHA256: "bad"}},
+		Pipeline: []StepConfig{
+			{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}},
+		},
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected error for invalid pipeline source")
+	}
+	if !strings.Contains(err.Error(), "pipeline") || !strings.Contains(err.Error(), "sha256") {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -768,3 +784,295 @@ func TestValidate_CopyDestTraversal(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestValidate_GitSource(t *testing.T) {
+	commit := strings.Repeat("a", 40)
+	tests := []struct {
+		name    string
+		entry   SourceEntry
+		wantErr string
+	}{
+		{"valid", SourceEntry{Git: "https://example.com/repo.git", Ref: "v1", Subdir: "deploy", Commit: commit}, ""},
+		{"short commit", SourceEntry{Git: "https://example.com/repo.git", Commit: "abc123"}, "commit must be a full"},
+		{"subdir traversal", SourceEntry{Git: "https://example.com/repo.git", Subdir: "../x"}, "invalid subdir"},
+		{"ref without git", SourceEntry{HTTPS: "https://example.com/x", Ref: "v1"}, "ref is only valid when git is set"},
+		{"commit without git", SourceEntry{OCI: "x", Commit: commit}, "commit is only valid when git is set"},
+		{"git and https", SourceEntry{Git: "x", HTTPS: "y"}, "exactly one of"},
+		{"git option", SourceEntry{Git: "--upload-pack=touch x"}, `git must not start with "-"`},
+		{"ref option", SourceEntry{Git: "https://example.com/repo.git", Ref: "--upload-pack=touch x"}, `ref must not start with "-"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{
+				Pipeline: []StepConfig{
+					{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{tt.entry}},
+				},
+			}
+			err := p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_OCIDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		name    string
+		entry   SourceEntry
+		wantErr string
+	}{
+		{"valid", SourceEntry{OCI: "ghcr.io/org/repo:v1", Digest: digest}, ""},
+		{"matches reference", SourceEntry{OCI: "ghcr.io/org/repo@" + digest, Digest: digest}, ""},
+		{"bad format", SourceEntry{OCI: "ghcr.io/org/repo:v1", Digest: "abc"}, "digest must be sha256:"},
+		{"digest without oci", SourceEntry{HTTPS: "https://example.com/x", Digest: digest}, "digest is only valid when oci is set"},
+		{"conflicting reference", SourceEntry{OCI: "ghcr.io/org/repo@sha256:" + strings.Repeat("b", 64), Digest: digest}, "digest conflicts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{
+				Pipeline: []StepConfig{
+					{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{tt.entry}},
+				},
+			}
+			err := p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_SourceSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   SourceEntry
+		wantErr string
+	}{
+		{"https subdir", SourceEntry{HTTPS: "https://example.com/repo.tar.gz", Subdir: "deploy/manifests"}, ""},
+		{"include and exclude", SourceEntry{OCI: "ghcr.io/org/repo:v1", Include: []string{"**/*.yaml"}, Exclude: []string{"**/test/**"}}, ""},
+		{"subdir traversal", SourceEntry{File: "x", Subdir: "../y"}, "invalid subdir"},
+		{"bad include", SourceEntry{File: "x", Include: []string{"[a-"}}, `include[0]: invalid glob pattern "[a-"`},
+		{"bad exclude", SourceEntry{File: "x", Exclude: []string{"ok", "{a"}}, `exclude[1]: invalid glob pattern "{a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{
+				Pipeline: []StepConfig{
+					{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{tt.entry}},
+				},
+			}
+			err := p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_ArchiveField(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   SourceEntry
+		wantErr string
+	}{
+		{"zip", SourceEntry{HTTPS: "https://example.com/release", Archive: ArchiveZip}, ""},
+		{"none", SourceEntry{HTTPS: "https://example.com/release.tar.gz", Archive: ArchiveNone}, ""},
+		{"unknown", SourceEntry{HTTPS: "https://example.com/release", Archive: "tar.gzip"}, `archive "tar.gzip" is not valid`},
+		{"archive without https", SourceEntry{File: "x", Archive: ArchiveZip}, "archive is only valid when https is set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{
+				Pipeline: []StepConfig{
+					{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{tt.entry}},
+				},
+			}
+			err := p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_HeadersField(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   SourceEntry
+		wantErr string
+	}{
+		{"https", SourceEntry{HTTPS: "https://example.com/a", Headers: map[string]string{"PRIVATE-TOKEN": "${TOKEN}"}}, ""},
+		{"headers without https", SourceEntry{File: "x", Headers: map[string]string{"Accept": "*/*"}}, "headers is only valid when https is set"},
+		{"invalid name", SourceEntry{HTTPS: "https://example.com/a", Headers: map[string]string{"Bad Header": "x"}}, `"Bad Header" is not a valid HTTP header name`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{Pipeline: []StepConfig{
+				{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{tt.entry}},
+			}}
+			err := p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_OnConflict(t *testing.T) {
+	for _, policy := range []string{"", OnConflictOverwrite, OnConflictSkip, OnConflictError, OnConflictMergeYAML} {
+		p := &Pipeline{Pipeline: []StepConfig{
+			{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{{File: "x", OnConflict: policy}}},
+		}}
+		if err := p.Validate(); err != nil {
+			t.Errorf("onConflict %q: unexpected error: %v", policy, err)
+		}
+	}
+
+	p := &Pipeline{Pipeline: []StepConfig{
+		{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{{File: "x", OnConflict: "merge-yml"}}},
+	}}
+	err := p.Validate()
+	if err == nil || !strings.Contains(err.Error(), `onConflict "merge-yml" is not valid, did you mean "merge-yaml"?`) {
+		t.Fatalf("expected onConflict error with suggestion, got %v", err)
+	}
+	if got := errorPath(err); len(got) == 0 || got[len(got)-1] != "onConflict" {
+		t.Errorf("unexpected error path: %v", got)
+	}
+}
+
+func TestValidate_Timeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		wantErr string
+	}{
+		{"", ""},
+		{"90s", ""},
+		{"1h30m", ""},
+		{"ten minutes", `invalid timeout "ten minutes"`},
+		{"0s", `timeout must be positive, got "0s"`},
+		{"-1m", `timeout must be positive, got "-1m"`},
+	}
+	for _, tt := range tests {
+		p := &Pipeline{Pipeline: []StepConfig{
+			{Name: "a", Type: StepTypeTemplate, Template: &TemplateConfig{}, Source: Sources{{File: "x", Timeout: tt.timeout}}},
+		}}
+		err := p.Validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("timeout %q: unexpected error: %v", tt.timeout, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("timeout %q: expected error containing %q, got %v", tt.timeout, tt.wantErr, err)
+			continue
+		}
+		if got := errorPath(err); len(got) == 0 || got[len(got)-1] != "timeout" {
+			t.Errorf("timeout %q: unexpected error path: %v", tt.timeout, got)
+		}
+	}
+}
+
+func TestValidate_InvalidWhen(t *testing.T) {
+	p := &Pipeline{
+		Pipeline: []StepConfig{
+			{Name: "render", Type: StepTypeTemplate, When: "eq .env (", Template: &TemplateConfig{}},
+		},
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected error for invalid when expression")
+	}
+	if !strings.Contains(err.Error(), "parsing when expression") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := errorPath(err); len(got) != 3 || got[2] != "when" {
+		t.Errorf("unexpected error path: %v", got)
+	}
+}
+
+func TestValidate_KustomizeEngine(t *testing.T) {
+	build := func(engine string) *Pipeline {
+		return &Pipeline{Pipeline: []StepConfig{{
+			Name:           "build",
+			Type:           StepTypeKustomizeBuild,
+			KustomizeBuild: &KustomizeBuildConfig{OutputFile: "out.yaml", Engine: engine},
+		}}}
+	}
+	create := func(engine string) *Pipeline {
+		return &Pipeline{Pipeline: []StepConfig{{
+			Name:            "create",
+			Type:            StepTypeKustomizeCreate,
+			KustomizeCreate: &KustomizeCreateConfig{Autodetect: true, Engine: engine},
+		}}}
+	}
+
+	for _, engine := range []string{"", KustomizeEngineBuiltin, KustomizeEngineExec} {
+		if err := build(engine).Validate(); err != nil {
+			t.Errorf("kustomize-build engine %q: unexpected error: %v", engine, err)
+		}
+		if err := create(engine).Validate(); err != nil {
+			t.Errorf("kustomize-create engine %q: unexpected error: %v", engine, err)
+		}
+	}
+
+	err := build("exe").Validate()
+	if err == nil || !strings.Contains(err.Error(), `kustomize-build.engine "exe" is not valid, did you mean "exec"?`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = create("docker").Validate()
+	if err == nil || !strings.Contains(err.Error(), `kustomize-create.engine "docker" is not valid`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidate_HelmKubeVersion(t *testing.T) {
+	p := func(kubeVersion string) *Pipeline {
+		return &Pipeline{Pipeline: []StepConfig{{
+			Name: "render",
+			Type: StepTypeHelm,
+			Helm: &HelmConfig{Chart: "./chart", ReleaseName: "app", KubeVersion: kubeVersion},
+		}}}
+	}
+	for _, v := range []string{"", "1.29.0", "v1.30"} {
+		if err := p(v).Validate(); err != nil {
+			t.Errorf("kubeVersion %q: unexpected error: %v", v, err)
+		}
+	}
+	err := p("latest").Validate()
+	if err == nil || !strings.Contains(err.Error(), `helm.kubeVersion "latest" is not a valid version`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// ParseWhen parses a step's when: condition. A bare expression such as
+// `.eso.enabled` or `eq .env "prod"` is evaluated with the truthiness rules of
+// a template {{ if }}. A value containing "{{" is treated as a full template
+// whose trimmed output is the condition; "", "<no value>" and anything
+// strconv.ParseBool reads as false are falsy.
+func ParseWhen(expr string) (*template.Template, error) {
+	src := expr
+	if !strings.Contains(expr, "{{") {
+		src = "{{ if " + expr + " }}true{{ end }}"
+	}
+	tmpl, err := template.New("when").Funcs(sprig.FuncMap()).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parsing when expression: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Enabled evaluates the step's when: condition against ctx. Steps without a
+// condition are always enabled.
+func (s StepConfig) Enabled(ctx map[string]any) (bool, error) {
+	if s.When == "" {
+		return true, nil
+	}
+	tmpl, err := ParseWhen(s.When)
+	if err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return false, fmt.Errorf("evaluating when expression: %w", err)
+	}
+	return truthy(strings.TrimSpace(buf.String())), nil
+}
+
+func truthy(s string) bool {
+	if s == "" || s == "<no value>" {
+		return false
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return true
+}
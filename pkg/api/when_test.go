@@ -0,0 +1,60 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStepConfigEnabled(t *testing.T) {
+	ctx := map[string]any{
+		"env": "prod",
+		"eso": map[string]any{"enabled": true},
+		"off": false,
+		"n":   0,
+	}
+	tests := []struct {
+		when string
+		want bool
+	}{
+		{"", true},
+		{".eso.enabled", true},
+		{".off", false},
+		{".n", false},
+		{".missing", false},
+		{`eq .env "prod"`, true},
+		{`eq .env "dev"`, false},
+		{".nothing.enabled", false},
+		{`dig "eso" "enabled" false .`, true},
+		{"{{ .eso.enabled }}", true},
+		{"{{ .off }}", false},
+		{"{{ .missing }}", false},
+		{"{{ if .off }}yes{{ end }}", false},
+		{"{{ .env }}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.when, func(t *testing.T) {
+			got, err := StepConfig{When: tt.when}.Enabled(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Enabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepConfigEnabled_ExecError(t *testing.T) {
+	_, err := StepConfig{When: "index .items 3"}.Enabled(map[string]any{"items": []any{"a"}})
+	if err == nil || !strings.Contains(err.Error(), "evaluating when expression") {
+		t.Fatalf("expected evaluation error, got %v", err)
+	}
+}
+
+func TestParseWhen_Invalid(t *testing.T) {
+	for _, expr := range []string{"eq .a (", "{{ .a "} {
+		if _, err := ParseWhen(expr); err == nil {
+			t.Errorf("expected parse error for %q", expr)
+		}
+	}
+}
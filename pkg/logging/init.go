@@ -2,6 +2,7 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 
@@ -15,6 +16,11 @@ const (
 )
 
 func Initialize(loggingType string, logLevelName string) error {
+	return InitializeWriter(os.Stdout, loggingType, logLevelName)
+}
+
+// InitializeWriter is like Initialize but logs to w instead of stdout.
+func InitializeWriter(w io.Writer, loggingType string, logLevelName string) error {
 	var logLevel slog.Level
 	err := logLevel.UnmarshalText([]byte(logLevelName))
 	if err != nil {
@@ -31,11 +37,11 @@ func Initialize(loggingType string, logLevelName string) error {
 
 	switch loggingType {
 	case JSON:
-		logHandler = slog.NewJSONHandler(os.Stdout, &logHandlerOptions)
+		logHandler = slog.NewJSONHandler(w, &logHandlerOptions)
 	case Text:
-		logHandler = slog.NewTextHandler(os.Stdout, &logHandlerOptions)
+		logHandler = slog.NewTextHandler(w, &logHandlerOptions)
 	case Tint:
-		logHandler = tint.NewHandler(os.Stdout, &tint.Options{
+		logHandler = tint.NewHandler(w, &tint.Options{
 			AddSource: logHandlerOptions.AddSource,
 			Level:     logHandlerOptions.Level,
 		})
@@ -1,6 +1,10 @@
 package logging
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
 
 func TestInitialize(t *testing.T) {
 	tests := []struct {
@@ -26,3 +30,13 @@ func TestInitialize(t *testing.T) {
 		})
 	}
 }
+
+func TestInitializeWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := InitializeWriter(&buf, JSON, "info"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "logging initialized") {
+		t.Errorf("expected log output in writer, got %q", buf.String())
+	}
+}
@@ -0,0 +1,242 @@
+// Package plan compares a freshly rendered output tree against an existing
+// output directory without modifying either.
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/systemstart/many-templates/pkg/processing"
+)
+
+const (
+	StatusAdded    = "added"
+	StatusRemoved  = "removed"
+	StatusModified = "modified"
+)
+
+// diffContextLines is the number of unchanged lines shown around each hunk.
+const diffContextLines = 3
+
+// FileChange describes a single file that differs between the two trees.
+type FileChange struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// Plan is the result of comparing a rendered tree against an output directory.
+type Plan struct {
+	Added    int          `json:"added"`
+	Removed  int          `json:"removed"`
+	Modified int          `json:"modified"`
+	Changes  []FileChange `json:"changes"`
+}
+
+// HasChanges reports whether applying the plan would change the output directory.
+func (p *Plan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// Compare walks renderedDir and outputDir and reports every file that would be
+// added, removed or modified by promoting renderedDir into outputDir. Only files
+// recorded in the manifest of a promotion root are candidates for removal,
+// mirroring how promotion prunes stale output. The promotion roots are
+// outputDir and, in instances mode, every instance output directory: those
+// with a manifest in renderedDir. Manifests themselves are not compared. A
+// missing outputDir is treated as empty. Changes are sorted by path.
+func Compare(renderedDir, outputDir string) (*Plan, error) {
+	rendered, roots, err := listFiles(renderedDir)
+	if err != nil {
+		return nil, err
+	}
+	existing, _, err := listFiles(outputDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	owned, err := readManifests(outputDir, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{Changes: []FileChange{}}
+
+	for rel := range rendered {
+		change, err := compareFile(rel, filepath.Join(renderedDir, rel), filepath.Join(outputDir, rel), existing[rel])
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			p.add(*change)
+		}
+	}
+	for rel := range existing {
+		if rendered[rel] || !owned[rel] {
+			continue
+		}
+		old, err := os.ReadFile(filepath.Join(outputDir, rel))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", rel, err)
+		}
+		p.add(FileChange{Path: rel, Status: StatusRemoved, Diff: unifiedDiff(rel, old, nil)})
+	}
+
+	sort.Slice(p.Changes, func(i, j int) bool { return p.Changes[i].Path < p.Changes[j].Path })
+	return p, nil
+}
+
+func (p *Plan) add(c FileChange) {
+	switch c.Status {
+	case StatusAdded:
+		p.Added++
+	case StatusRemoved:
+		p.Removed++
+	case StatusModified:
+		p.Modified++
+	}
+	p.Changes = append(p.Changes, c)
+}
+
+func compareFile(rel, renderedPath, outputPath string, exists bool) (*FileChange, error) {
+	newData, err := os.ReadFile(renderedPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", rel, err)
+	}
+	if !exists {
+		return &FileChange{Path: rel, Status: StatusAdded, Diff: unifiedDiff(rel, nil, newData)}, nil
+	}
+	oldData, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", rel, err)
+	}
+	if bytes.Equal(oldData, newData) {
+		return nil, nil
+	}
+	return &FileChange{Path: rel, Status: StatusModified, Diff: unifiedDiff(rel, oldData, newData)}, nil
+}
+
+// readManifests returns the files owned by the manifests of outputDir and of
+// the directories roots below it, as slash-separated paths relative to
+// outputDir.
+func readManifests(outputDir string, roots []string) (map[string]bool, error) {
+	owned := make(map[string]bool)
+	for _, root := range append([]string{"."}, roots...) {
+		files, err := processing.ReadManifest(filepath.Join(outputDir, filepath.FromSlash(root)))
+		if err != nil {
+			return nil, fmt.Errorf("reading output manifest of %s: %w", root, err)
+		}
+		for rel := range files {
+			owned[path.Join(root, rel)] = true
+		}
+	}
+	return owned, nil
+}
+
+// listFiles returns the slash-separated relative paths of all regular files
+// under root, except manifests, and the directories holding a manifest below
+// root.
+func listFiles(root string) (map[string]bool, []string, error) {
+	files := make(map[string]bool)
+	var roots []string
+	if _, err := os.Stat(root); err != nil {
+		return files, nil, err //nolint:wrapcheck // callers check os.IsNotExist
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error at %s: %w", path, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, relErr := filepath.Rel(root, path)
+		if relErr != nil {
+			return fmt.Errorf("computing relative path for %s: %w", path, relErr)
+		}
+		switch {
+		case rel == processing.ManifestFileName:
+		case d.Name() == processing.ManifestFileName:
+			roots = append(roots, filepath.ToSlash(filepath.Dir(rel)))
+		default:
+			files[filepath.ToSlash(rel)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("walking %s: %w", root, err)
+	}
+	return files, roots, nil
+}
+
+// unifiedDiff returns a unified diff between two versions of a file.
+// A nil side is shown as /dev/null. Binary content is summarised.
+func unifiedDiff(rel string, oldData, newData []byte) string {
+	if isBinary(oldData) || isBinary(newData) {
+		return fmt.Sprintf("Binary files a/%s and b/%s differ\n", rel, rel)
+	}
+
+	fromFile, toFile := "a/"+rel, "b/"+rel
+	if oldData == nil {
+		fromFile = "/dev/null"
+	}
+	if newData == nil {
+		toFile = "/dev/null"
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(oldData),
+		B:        splitLines(newData),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  diffContextLines,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+// splitLines splits data into newline-terminated lines. Unlike
+// difflib.SplitLines it does not invent an empty trailing line.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// WriteText writes a human-readable summary followed by every diff.
+func (p *Plan) WriteText(w io.Writer) error {
+	for _, c := range p.Changes {
+		if _, err := fmt.Fprintf(w, "%-8s %s\n", c.Status, c.Path); err != nil {
+			return fmt.Errorf("writing plan: %w", err)
+		}
+	}
+	for _, c := range p.Changes {
+		if _, err := io.WriteString(w, "\n"+c.Diff); err != nil {
+			return fmt.Errorf("writing plan: %w", err)
+		}
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %d to add, %d to remove, %d to modify.\n", p.Added, p.Removed, p.Modified)
+	if err != nil {
+		return fmt.Errorf("writing plan: %w", err)
+	}
+	return nil
+}
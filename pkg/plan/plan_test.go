@@ -0,0 +1,191 @@
+package plan
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/systemstart/many-templates/pkg/api"
+	"github.com/systemstart/many-templates/pkg/processing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompare_ReportsAddedRemovedModified(t *testing.T) {
+	rendered := t.TempDir()
+	output := t.TempDir()
+	writeTree(t, rendered, map[string]string{
+		"same.yaml":    "a: 1\n",
+		"changed.yaml": "a: 2\n",
+		"new/app.yaml": "kind: Deployment\n",
+	})
+	writeTree(t, output, map[string]string{
+		"same.yaml":      "a: 1\n",
+		"changed.yaml":   "a: 1\n",
+		"old.yaml":       "stale\n",
+		"unowned.yaml":   "hand-written\n",
+		".many-manifest": "changed.yaml\nold.yaml\nsame.yaml\n",
+	})
+	writeTree(t, rendered, map[string]string{".many-manifest": "changed.yaml\nnew/app.yaml\nsame.yaml\n"})
+
+	p, err := Compare(rendered, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Added != 1 || p.Removed != 1 || p.Modified != 1 {
+		t.Fatalf("unexpected counts: %+v", p)
+	}
+
+	want := []struct{ path, status string }{
+		{"changed.yaml", StatusModified},
+		{"new/app.yaml", StatusAdded},
+		{"old.yaml", StatusRemoved},
+	}
+	if len(p.Changes) != len(want) {
+		t.Fatalf("expected %d changes, got %d", len(want), len(p.Changes))
+	}
+	for i, w := range want {
+		if p.Changes[i].Path != w.path || p.Changes[i].Status != w.status {
+			t.Errorf("change %d: got %s %s, want %s %s", i, p.Changes[i].Status, p.Changes[i].Path, w.status, w.path)
+		}
+	}
+
+	diff := p.Changes[0].Diff
+	for _, s := range []string{"--- a/changed.yaml", "+++ b/changed.yaml", "-a: 1", "+a: 2"} {
+		if !strings.Contains(diff, s) {
+			t.Errorf("diff missing %q:\n%s", s, diff)
+		}
+	}
+	if !strings.Contains(p.Changes[1].Diff, "--- /dev/null") {
+		t.Errorf("added diff should start from /dev/null:\n%s", p.Changes[1].Diff)
+	}
+	if !strings.Contains(p.Changes[2].Diff, "+++ /dev/null") {
+		t.Errorf("removed diff should end at /dev/null:\n%s", p.Changes[2].Diff)
+	}
+}
+
+func TestCompare_MissingOutputDirIsEmpty(t *testing.T) {
+	rendered := t.TempDir()
+	writeTree(t, rendered, map[string]string{"a.yaml": "x\n"})
+
+	p, err := Compare(rendered, filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Added != 1 || !p.HasChanges() {
+		t.Errorf("expected one added file, got %+v", p)
+	}
+}
+
+func TestCompare_Instances(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"app/.many.yaml": "pipeline:\n  - name: render\n    type: template\n    source:\n      file: .\n    template:\n      files:\n        include: [\"*.txt\"]\n",
+		"app/a.txt":      "a {{ .env }}\n",
+		"app/b.txt":      "b\n",
+	})
+	cfg := &api.InstancesConfig{Instances: []api.Instance{
+		{Name: "prod", Output: "prod", Context: map[string]any{"env": "prod"}},
+		{Name: "staging", Output: "staging", Context: map[string]any{"env": "staging"}},
+	}}
+	output := t.TempDir()
+	if err := processing.RunInstances(t.Context(), cfg, src, output, nil, -1, false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(src, "app", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	rendered := t.TempDir()
+	if err := processing.RunInstances(t.Context(), cfg, src, rendered, nil, -1, false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Compare(rendered, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileChange{{Path: "prod/app/b.txt", Status: StatusRemoved}, {Path: "staging/app/b.txt", Status: StatusRemoved}}
+	if len(p.Changes) != len(want) {
+		t.Fatalf("expected %v, got %+v", want, p.Changes)
+	}
+	for i, w := range want {
+		if p.Changes[i].Path != w.Path || p.Changes[i].Status != w.Status {
+			t.Errorf("change %d: got %s %s, want %s %s", i, p.Changes[i].Status, p.Changes[i].Path, w.Status, w.Path)
+		}
+	}
+}
+
+func TestCompare_NoChanges(t *testing.T) {
+	rendered := t.TempDir()
+	output := t.TempDir()
+	writeTree(t, rendered, map[string]string{"a.yaml": "x\n"})
+	writeTree(t, output, map[string]string{"a.yaml": "x\n"})
+
+	p, err := Compare(rendered, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.HasChanges() {
+		t.Errorf("expected no changes, got %+v", p.Changes)
+	}
+}
+
+func TestCompare_BinaryFiles(t *testing.T) {
+	rendered := t.TempDir()
+	output := t.TempDir()
+	writeTree(t, rendered, map[string]string{"bin": "a\x00b"})
+	writeTree(t, output, map[string]string{"bin": "a\x00c"})
+
+	p, err := Compare(rendered, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Changes) != 1 || !strings.HasPrefix(p.Changes[0].Diff, "Binary files") {
+		t.Errorf("expected binary diff summary, got %+v", p.Changes)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	p := &Plan{Added: 1, Changes: []FileChange{{Path: "a.yaml", Status: StatusAdded, Diff: "+x\n"}}}
+	var buf bytes.Buffer
+	if err := p.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{"added    a.yaml", "+x", "Plan: 1 to add, 0 to remove, 0 to modify."} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output missing %q:\n%s", s, out)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"a\n", 1},
+		{"a\nb", 2},
+		{"a\n\n", 2},
+	}
+	for _, tt := range tests {
+		if got := splitLines([]byte(tt.in)); len(got) != tt.want {
+			t.Errorf("splitLines(%q) = %q, want %d lines", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/systemstart/many-templates/pkg/api"
+	"github.com/systemstart/many-templates/pkg/resolve"
+	"github.com/systemstart/many-templates/pkg/steps"
+)
+
+// CheckOptions selects what Check inspects besides the pipelines in InputDir.
+type CheckOptions struct {
+	InputDir    string
+	MaxDepth    int
+	Instances   string // optional instances file
+	ContextFile string // optional
+}
+
+// Check validates configuration without fetching remote sources or running
+// external tools: every discovered pipeline is loaded and validated, local
+// file sources and the context file must exist, templates must parse, and
+// instance inputs and include entries must name existing directories. Remote
+// base pipelines and macro libraries are the exception: a pipeline cannot be
+// validated without them, so they are fetched within ctx. It returns every
+// problem found rather than stopping at the first.
+func Check(ctx context.Context, opts CheckOptions) []error {
+	var errs []error
+
+	if opts.ContextFile != "" && !resolve.IsRemote(opts.ContextFile) {
+		if _, err := LoadContextFile(opts.ContextFile); err != nil {
+			errs = append(errs, fmt.Errorf("context file %s: %w", opts.ContextFile, err))
+		}
+	}
+
+	absRoot, err := filepath.Abs(opts.InputDir)
+	if err != nil {
+		return append(errs, fmt.Errorf("resolving input directory: %w", err))
+	}
+	paths, err := collectConfigPaths(absRoot, opts.MaxDepth)
+	if err != nil {
+		return append(errs, err)
+	}
+	for _, p := range paths {
+		errs = append(errs, checkPipelineFile(ctx, displayPath(opts.InputDir, absRoot, p))...)
+	}
+
+	if opts.Instances != "" {
+		errs = append(errs, checkInstancesFile(opts.Instances, opts.InputDir)...)
+	}
+	return errs
+}
+
+// displayPath shows p relative to the input directory as the user gave it.
+func displayPath(inputDir, absRoot, p string) string {
+	rel, err := filepath.Rel(absRoot, p)
+	if err != nil {
+		return p
+	}
+	return filepath.Join(inputDir, rel)
+}
+
+// checkPipelineFile loads and checks one pipeline. file is used as given in
+// messages, so callers pass it relative to what the user typed.
+func checkPipelineFile(ctx context.Context, file string) []error {
+	p, err := api.LoadPipeline(ctx, file)
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	known := make(map[string]string)
+
+	for i, entry := range p.Source {
+		if err := addLocalSource(known, entry, p.Dir); err != nil {
+			errs = append(errs, fmt.Errorf("%s: pipeline: source[%d]: %w", file, i, err))
+		}
+	}
+	for _, step := range p.Pipeline {
+		for i, entry := range step.Source {
+			if err := addLocalSource(known, entry, p.Dir); err != nil {
+				errs = append(errs, fmt.Errorf("%s: step %q: source[%d]: %w", file, step.Name, i, err))
+			}
+		}
+		for _, err := range steps.Check(step, known) {
+			errs = append(errs, fmt.Errorf("%s: step %q: %w", file, step.Name, err))
+		}
+	}
+	return errs
+}
+
+// addLocalSource checks that a file source exists and records the files it
+// overlays into the work dir in known. Other schemes are skipped.
+func addLocalSource(known map[string]string, entry api.SourceEntry, baseDir string) error {
+	if entry.File == "" {
+		return nil
+	}
+	src := entry.File
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(baseDir, src)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("file %q does not exist", entry.File)
+		}
+		return fmt.Errorf("file %q: %w", entry.File, err)
+	}
+
+	dest := filepath.ToSlash(entry.Path)
+	if !info.IsDir() {
+		known[path.Join(dest, info.Name())] = src
+		return nil
+	}
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error at %s: %w", p, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, relErr := filepath.Rel(src, p)
+		if relErr != nil {
+			return fmt.Errorf("computing relative path for %s: %w", p, relErr)
+		}
+		known[path.Join(dest, filepath.ToSlash(rel))] = p
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("file %q: %w", entry.File, err)
+	}
+	return nil
+}
+
+// checkInstancesFile validates the instances file and checks that local
+// instance inputs and their include entries are existing directories.
+func checkInstancesFile(file, inputDir string) []error {
+	cfg, err := api.ParseInstances(file)
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", file, err)}
+	}
+
+	var errs []error
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", file, err))
+	}
+
+	for _, inst := range cfg.Instances {
+		if inst.Input != "" && resolve.IsRemote(inst.Input) {
+			continue
+		}
+		dir := filepath.Join(inputDir, inst.Input)
+		if !isDir(dir) {
+			errs = append(errs, fmt.Errorf("%s: instance %q: input %s is not a directory", file, inst.Name, dir))
+			continue
+		}
+		for _, name := range inst.Include {
+			if !isDir(filepath.Join(dir, name)) {
+				errs = append(errs, fmt.Errorf("%s: instance %q: include %q is not a subdirectory of %s", file, inst.Name, name, dir))
+			}
+		}
+	}
+	return errs
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,148 @@
+package processing
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+func TestCheck_Valid(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), `
+pipeline:
+  - name: render
+    type: template
+    source:
+      file: "."
+    template:
+      files:
+        include: ["*.yaml"]
+`)
+	writeTestFile(t, filepath.Join(src, "app.yaml"), "name: {{ .name | default \"x\" }}")
+
+	if errs := Check(t.Context(), CheckOptions{InputDir: src, MaxDepth: -1}); len(errs) != 0 {
+		t.Fatalf("expected no problems, got %v", errs)
+	}
+}
+
+func TestCheck_ReportsAllProblems(t *testing.T) {
+	src := t.TempDir()
+	mkdirAll(t, filepath.Join(src, "app"))
+	mkdirAll(t, filepath.Join(src, "bad"))
+	writeTestFile(t, filepath.Join(src, "app", ".many.yaml"), `
+source:
+  file: ../missing
+pipeline:
+  - name: render
+    type: template
+    source:
+      - file: "."
+        path: sub/
+    template:
+      files:
+        include: ["sub/*.yaml"]
+        exclude: ["sub/.many.yaml"]
+  - name: gen
+    type: generate
+    generate:
+      output: out.yaml
+      template: "{{ if }}"
+`)
+	writeTestFile(t, filepath.Join(src, "app", "broken.yaml"), "{{ .name ")
+	writeTestFile(t, filepath.Join(src, "bad", ".many.yaml"), "pipeline:\n  - name: x\n    type: templte\n")
+	writeTestFile(t, filepath.Join(src, "instances.yaml"), `
+instances:
+  - name: a
+    output: a/
+    include: [app, nope]
+  - name: b
+    input: missing
+    output: b/
+`)
+
+	errs := Check(t.Context(), CheckOptions{
+		InputDir:    src,
+		MaxDepth:    -1,
+		Instances:   filepath.Join(src, "instances.yaml"),
+		ContextFile: filepath.Join(src, "context.yaml"),
+	})
+
+	want := []string{
+		"context file",
+		`pipeline: source[0]: file "../missing" does not exist`,
+		`step "render": sub/broken.yaml: template:`,
+		`step "gen": generate.template:`,
+		`unknown type "templte"`,
+		`include "nope" is not a subdirectory`,
+		`instance "b": input`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d problems, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i].Error(), w) {
+			t.Errorf("problem %d: %q does not contain %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestCheck_InvalidInstancesFile(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "instances.yaml"), "instances: []\n")
+
+	errs := Check(t.Context(), CheckOptions{InputDir: src, MaxDepth: -1, Instances: filepath.Join(src, "instances.yaml")})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "instances list is empty") {
+		t.Fatalf("expected empty-list problem, got %v", errs)
+	}
+}
+
+func TestCheck_OfflineRemoteBase(t *testing.T) {
+	var hits atomic.Int32
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/bases/render:v1"
+	pushTestImage(t, ref, ".many.yaml", "pipeline:\n  - name: render\n    type: template\n    template: {}\n")
+
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), "extends: oci://"+ref+"\n")
+	vendorDir := filepath.Join(t.TempDir(), "vendor")
+	t.Cleanup(func() { resolve.SetVendor(nil) })
+
+	resolve.SetVendor(&resolve.Vendor{Dir: vendorDir, Offline: true})
+	errs := Check(t.Context(), CheckOptions{InputDir: src, MaxDepth: -1})
+	if len(errs) != 1 || !errors.Is(errs[0], resolve.ErrNotVendored) {
+		t.Fatalf("expected the base to be reported as not vendored, got %v", errs)
+	}
+
+	v, err := resolve.OpenVendor(vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve.SetVendor(v)
+	if _, err := VendorSources(t.Context(), src, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	resolve.SetVendor(&resolve.Vendor{Dir: vendorDir, Offline: true})
+	hits.Store(0)
+	if errs := Check(t.Context(), CheckOptions{InputDir: src, MaxDepth: -1}); len(errs) != 0 {
+		t.Fatalf("expected no problems, got %v", errs)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("expected no registry requests offline, got %d", n)
+	}
+}
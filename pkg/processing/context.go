@@ -8,6 +8,7 @@ import (
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
+	"github.com/systemstart/many-templates/pkg/api"
 	"gopkg.in/yaml.v3"
 )
 
@@ -96,22 +97,34 @@ func renderString(s string, data map[string]any) (string, error) {
 	return buf.String(), nil
 }
 
-// MergeContext performs a deep merge of local context over global context.
-// For map values, merging is recursive. For all other types (including slices),
-// local values replace global values.
+// MergeContext performs a deep merge of local context over global context,
+// as api.MergeContext does.
 func MergeContext(global, local map[string]any) map[string]any {
-	merged := make(map[string]any, len(global)+len(local))
-	for k, v := range global {
-		merged[k] = v
+	return api.MergeContext(global, local)
+}
+
+// copyContext returns a deep copy of ctx. Nested maps and slices are copied so
+// that in-place interpolation of one pipeline's context cannot leak into the
+// (possibly shared) global or instance context of another.
+func copyContext(ctx map[string]any) map[string]any {
+	out := make(map[string]any, len(ctx))
+	for k, v := range ctx {
+		out[k] = copyContextValue(v)
 	}
-	for k, v := range local {
-		if localMap, ok := v.(map[string]any); ok {
-			if globalMap, ok := merged[k].(map[string]any); ok {
-				merged[k] = MergeContext(globalMap, localMap)
-				continue
-			}
+	return out
+}
+
+func copyContextValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		return copyContext(val)
+	case []any:
+		s := make([]any, len(val))
+		for i, item := range val {
+			s[i] = copyContextValue(item)
 		}
-		merged[k] = v
+		return s
+	default:
+		return v
 	}
-	return merged
 }
@@ -1,6 +1,7 @@
 package processing
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"path/filepath"
@@ -14,8 +15,9 @@ const configFilename = ".many.yaml"
 
 // DiscoverPipelines walks root looking for .many.yaml files up to maxDepth.
 // A maxDepth of -1 means unlimited. 0 means only root itself.
-// Results are sorted by path depth (parents before children).
-func DiscoverPipelines(root string, maxDepth int) ([]*api.Pipeline, error) {
+// Results are sorted by path depth (parents before children). Remote base
+// pipelines and macro libraries are fetched within ctx.
+func DiscoverPipelines(ctx context.Context, root string, maxDepth int) ([]*api.Pipeline, error) {
 	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		return nil, fmt.Errorf("resolving root path: %w", err)
@@ -30,7 +32,7 @@ func DiscoverPipelines(root string, maxDepth int) ([]*api.Pipeline, error) {
 		return pathDepth(a) - pathDepth(b)
 	})
 
-	return loadAll(paths)
+	return loadAll(ctx, paths)
 }
 
 func collectConfigPaths(absRoot string, maxDepth int) ([]string, error) {
@@ -61,10 +63,10 @@ func collectConfigPaths(absRoot string, maxDepth int) ([]string, error) {
 	return paths, nil
 }
 
-func loadAll(paths []string) ([]*api.Pipeline, error) {
+func loadAll(ctx context.Context, paths []string) ([]*api.Pipeline, error) {
 	pipelines := make([]*api.Pipeline, 0, len(paths))
 	for _, p := range paths {
-		pipeline, err := api.LoadPipeline(p)
+		pipeline, err := api.LoadPipeline(ctx, p)
 		if err != nil {
 			return nil, fmt.Errorf("loading %s: %w", p, err)
 		}
@@ -50,7 +50,7 @@ func setupDiscoverTree(t *testing.T) string {
 func TestDiscoverPipelines_Unlimited(t *testing.T) {
 	root := setupDiscoverTree(t)
 
-	pipelines, err := DiscoverPipelines(root, -1)
+	pipelines, err := DiscoverPipelines(t.Context(), root, -1)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -68,7 +68,7 @@ func TestDiscoverPipelines_Unlimited(t *testing.T) {
 func TestDiscoverPipelines_MaxDepth0(t *testing.T) {
 	root := setupDiscoverTree(t)
 
-	pipelines, err := DiscoverPipelines(root, 0)
+	pipelines, err := DiscoverPipelines(t.Context(), root, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -81,7 +81,7 @@ func TestDiscoverPipelines_MaxDepth0(t *testing.T) {
 func TestDiscoverPipelines_MaxDepth1(t *testing.T) {
 	root := setupDiscoverTree(t)
 
-	pipelines, err := DiscoverPipelines(root, 1)
+	pipelines, err := DiscoverPipelines(t.Context(), root, 1)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -94,7 +94,7 @@ func TestDiscoverPipelines_MaxDepth1(t *testing.T) {
 func TestDiscoverPipelines_NoPipelines(t *testing.T) {
 	root := t.TempDir()
 
-	pipelines, err := DiscoverPipelines(root, -1)
+	pipelines, err := DiscoverPipelines(t.Context(), root, -1)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -110,7 +110,7 @@ func TestDiscoverPipelines_InvalidPipeline(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err := DiscoverPipelines(root, -1)
+	_, err := DiscoverPipelines(t.Context(), root, -1)
 	if err == nil {
 		t.Fatal("expected error for invalid pipeline")
 	}
@@ -1,6 +1,8 @@
 package processing
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
@@ -8,6 +10,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/systemstart/many-templates/pkg/api"
@@ -17,6 +20,10 @@ import (
 
 const stagingDirName = ".many-tmp"
 
+// pipelineFileMu serialises sha256 write-back, since concurrently running
+// instances may load and update the same .many.yaml file.
+var pipelineFileMu sync.Mutex
+
 // cleanStagingDir removes a stale staging directory if it exists.
 // Best-effort, non-fatal.
 func cleanStagingDir(stagingDir string) {
@@ -28,55 +35,128 @@ func cleanStagingDir(stagingDir string) {
 	}
 }
 
-// promoteStaging moves all entries from stagingDir into targetDir, then removes
-// the now-empty staging directory.
+// keepStaging preserves the staging directory of a failed run for inspection,
+// unless the run was interrupted, in which case its partial contents are of no
+// use and it is removed.
+func keepStaging(ctx context.Context, stagingDir string, log *slog.Logger) {
+	if ctx.Err() != nil {
+		_ = os.RemoveAll(stagingDir)
+		return
+	}
+	log.Error("staging directory preserved for inspection", "path", stagingDir)
+}
+
+// promoteStaging reconciles targetDir with the contents of stagingDir: staged
+// files replace their counterparts, files recorded in targetDir's manifest
+// that were not produced again are deleted, and the manifest is rewritten.
+// Files in targetDir that many never wrote are left alone, and promotion
+// fails rather than replace them with a directory or a directory holding them
+// with a file. Finally the staging directory is removed.
+//
+// Promotion is atomic per file only: if it is interrupted, targetDir holds a
+// mix of old and new files. While files are moved the manifest lists both, so
+// the next successful run removes whatever it does not produce again.
 func promoteStaging(stagingDir, targetDir string) error {
-	entries, err := os.ReadDir(stagingDir)
+	produced, err := listOutputFiles(stagingDir)
+	if err != nil {
+		return err
+	}
+	owned, err := ReadManifest(targetDir)
 	if err != nil {
-		return fmt.Errorf("reading staging directory: %w", err)
+		return err
 	}
 
-	for _, e := range entries {
-		src := filepath.Join(stagingDir, e.Name())
-		dst := filepath.Join(targetDir, e.Name())
-		if err := os.Rename(src, dst); err != nil {
-			return fmt.Errorf("promoting %s: %w", e.Name(), err)
-		}
+	if err := checkReplacements(stagingDir, targetDir, "", owned); err != nil {
+		return err
+	}
+	if err := writeManifest(targetDir, ownedOrProduced(owned, produced)); err != nil {
+		return err
+	}
+	if err := moveEntries(stagingDir, targetDir); err != nil {
+		return err
+	}
+	pruneStale(targetDir, owned, produced)
+
+	// Written last, so that it only lists exactly the produced files once
+	// promotion has completed.
+	if err := writeManifest(targetDir, produced); err != nil {
+		return err
 	}
 
-	if err := os.Remove(stagingDir); err != nil {
+	if err := os.RemoveAll(stagingDir); err != nil {
 		return fmt.Errorf("removing staging directory: %w", err)
 	}
 	return nil
 }
 
-// RunPipeline executes a single pipeline's steps sequentially in workDir.
+// RunPipeline resolves the pipeline-level sources into workDir and then executes
+// the pipeline's steps sequentially in it.
 // File sources with relative paths are resolved relative to pipeline.Dir.
 // When updateSHA256 is true, HTTPS sources with empty sha256 fields will have
 // their computed hashes written back to the pipeline file.
-func RunPipeline(pipeline *api.Pipeline, globalContext map[string]any, workDir string, updateSHA256 bool) error {
-	ctx := MergeContext(globalContext, pipeline.Context)
-	if err := InterpolateContext(ctx); err != nil {
+// Cancelling ctx stops the pipeline before its next step and aborts source
+// downloads and external commands in progress.
+func RunPipeline(ctx context.Context, pipeline *api.Pipeline, globalContext map[string]any, workDir string, updateSHA256 bool) error {
+	return runPipeline(ctx, pipeline, globalContext, workDir, updateSHA256, slog.Default())
+}
+
+func runPipeline(ctx context.Context, pipeline *api.Pipeline, globalContext map[string]any, workDir string, updateSHA256 bool, log *slog.Logger) error {
+	data := copyContext(MergeContext(globalContext, pipeline.Context))
+	if err := InterpolateContext(data); err != nil {
 		return fmt.Errorf("interpolating context: %w", err)
 	}
 
+	if len(pipeline.Source) > 0 {
+		log.Info("resolving pipeline sources", "count", len(pipeline.Source))
+		cleanup, err := resolveSources(ctx, pipeline.Source, workDir, pipeline.Dir, writeBackPaths(pipeline, updateSHA256), log)
+		if err != nil {
+			return fmt.Errorf("resolving pipeline sources: %w", err)
+		}
+		if cleanup != nil {
+			defer cleanup()
+		}
+	}
+
+	var skipped []string
 	for _, stepCfg := range pipeline.Pipeline {
-		slog.Info("running step", "pipeline", pipeline.FilePath, "step", stepCfg.Name, "type", stepCfg.Type)
-		if err := runStep(stepCfg, pipeline, ctx, workDir, updateSHA256); err != nil {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("step %q: %w", stepCfg.Name, context.Cause(ctx))
+		}
+		enabled, err := stepCfg.Enabled(data)
+		if err != nil {
+			return fmt.Errorf("step %q: %w", stepCfg.Name, err)
+		}
+		if !enabled {
+			log.Info("skipping step", "step", stepCfg.Name, "when", stepCfg.When)
+			skipped = append(skipped, stepCfg.Name)
+			continue
+		}
+		log.Info("running step", "step", stepCfg.Name, "type", stepCfg.Type)
+		if err := runStep(ctx, stepCfg, pipeline, data, workDir, updateSHA256, log); err != nil {
 			return err
 		}
 	}
 
+	if len(skipped) > 0 {
+		log.Info("steps skipped by when condition", "count", len(skipped), "steps", skipped)
+	}
+
 	return nil
 }
 
-func runStep(stepCfg api.StepConfig, pipeline *api.Pipeline, ctx map[string]any, workDir string, updateSHA256 bool) error {
+// writeBackPaths returns the pipeline files that pinned source values should
+// be written back to: the pipeline's own and its local bases, which declare
+// the sources it inherits. It returns nil when write-back is disabled.
+func writeBackPaths(pipeline *api.Pipeline, updateSHA256 bool) []string {
+	if !updateSHA256 {
+		return nil
+	}
+	return pipeline.Files()
+}
+
+func runStep(ctx context.Context, stepCfg api.StepConfig, pipeline *api.Pipeline, data map[string]any, workDir string, updateSHA256 bool, log *slog.Logger) error {
 	if len(stepCfg.Source) > 0 {
-		pipelinePath := ""
-		if updateSHA256 {
-			pipelinePath = pipeline.FilePath
-		}
-		cleanup, err := resolveSources(stepCfg.Source, workDir, pipeline.Dir, pipelinePath)
+		cleanup, err := resolveSources(ctx, stepCfg.Source, workDir, pipeline.Dir, writeBackPaths(pipeline, updateSHA256), log.With("step", stepCfg.Name))
 		if err != nil {
 			return fmt.Errorf("step %q: resolving sources: %w", stepCfg.Name, err)
 		}
@@ -90,7 +170,9 @@ func runStep(stepCfg api.StepConfig, pipeline *api.Pipeline, ctx map[string]any,
 		return fmt.Errorf("creating step %q: %w", stepCfg.Name, err)
 	}
 
-	sctx := buildStepContext(workDir, pipeline.Dir, ctx)
+	sctx := buildStepContext(workDir, pipeline.Dir, data)
+	sctx.Log = log
+	sctx.Context = ctx
 
 	result, err := step.Run(sctx)
 	if err != nil {
@@ -98,11 +180,11 @@ func runStep(stepCfg api.StepConfig, pipeline *api.Pipeline, ctx map[string]any,
 	}
 
 	if result != nil {
-		removeBuildArtifacts(workDir, result.Cleanup)
+		removeBuildArtifacts(log, workDir, result.Cleanup)
 	}
 
 	if len(stepCfg.Exclude) > 0 {
-		if err := applyExcludes(workDir, stepCfg.Exclude); err != nil {
+		if err := applyExcludes(log, workDir, stepCfg.Exclude); err != nil {
 			return fmt.Errorf("step %q: applying excludes: %w", stepCfg.Name, err)
 		}
 	}
@@ -110,34 +192,34 @@ func runStep(stepCfg api.StepConfig, pipeline *api.Pipeline, ctx map[string]any,
 	return nil
 }
 
-func buildStepContext(workDir string, sourceDir string, ctx map[string]any) steps.StepContext {
+func buildStepContext(workDir string, sourceDir string, data map[string]any) steps.StepContext {
 	return steps.StepContext{
 		WorkDir:      workDir,
 		SourceDir:    sourceDir,
-		TemplateData: ctx,
+		TemplateData: data,
 	}
 }
 
-func removeBuildArtifacts(dir string, relativePaths []string) {
+func removeBuildArtifacts(log *slog.Logger, dir string, relativePaths []string) {
 	for _, rel := range relativePaths {
 		p := filepath.Join(dir, rel)
-		slog.Info("cleaning up build artifact", "path", p)
+		log.Info("cleaning up build artifact", "path", p)
 		if err := os.RemoveAll(p); err != nil {
-			slog.Warn("failed to remove build artifact", "path", p, "error", err)
+			log.Warn("failed to remove build artifact", "path", p, "error", err)
 		}
 	}
 }
 
 // applyExcludes walks workDir, matches files against glob patterns, and deletes
 // matching files. Empty directories are cleaned up bottom-up afterwards.
-func applyExcludes(workDir string, patterns []string) error {
+func applyExcludes(log *slog.Logger, workDir string, patterns []string) error {
 	toRemove, err := collectExcludedFiles(workDir, patterns)
 	if err != nil {
 		return err
 	}
 
 	for _, p := range toRemove {
-		slog.Debug("excluding file", "path", p)
+		log.Debug("excluding file", "path", p)
 		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("removing excluded file %s: %w", p, err)
 		}
@@ -260,7 +342,8 @@ func filterByInclude(pipelines []*api.Pipeline, include []string, baseDir string
 
 // RunAll discovers pipelines in inputDir, executes each in a fresh temp directory,
 // copies results to a staging directory, and promotes to outputDir on success.
-func RunAll(inputDir, outputDir string, globalContext map[string]any, maxDepth int, updateSHA256 bool) error {
+// At most parallelism pipelines run concurrently (values below 1 mean GOMAXPROCS).
+func RunAll(ctx context.Context, inputDir, outputDir string, globalContext map[string]any, maxDepth int, updateSHA256 bool, parallelism int) error {
 	absInputDir, err := filepath.Abs(inputDir)
 	if err != nil {
 		return fmt.Errorf("resolving input directory: %w", err)
@@ -272,8 +355,9 @@ func RunAll(inputDir, outputDir string, globalContext map[string]any, maxDepth i
 	if err := os.MkdirAll(stagingDir, 0o750); err != nil {
 		return fmt.Errorf("creating staging directory: %w", err)
 	}
+	defer trackDir(stagingDir)()
 
-	pipelines, err := DiscoverPipelines(absInputDir, maxDepth)
+	pipelines, err := DiscoverPipelines(ctx, absInputDir, maxDepth)
 	if err != nil {
 		return fmt.Errorf("discovering pipelines: %w", err)
 	}
@@ -283,51 +367,91 @@ func RunAll(inputDir, outputDir string, globalContext map[string]any, maxDepth i
 		return promoteStaging(stagingDir, outputDir)
 	}
 
-	slog.Info("discovered pipelines", "count", len(pipelines))
+	lim := newLimiter(parallelism)
+	slog.Info("discovered pipelines", "count", len(pipelines), "parallelism", cap(lim))
 
-	var failed []string
-	for _, p := range pipelines {
-		if err := executePipelineToStaging(p, globalContext, absInputDir, stagingDir, updateSHA256); err != nil {
-			slog.Error("pipeline failed", "path", p.FilePath, "error", err)
-			failed = append(failed, p.FilePath)
-		}
-	}
+	failed := executePipelines(ctx, pipelines, globalContext, absInputDir, stagingDir, updateSHA256, lim, slog.Default())
 
 	if err := removeConfigFiles(stagingDir); err != nil {
 		slog.Error("failed to clean up .many.yaml files", "error", err)
 	}
 
 	if len(failed) > 0 {
-		slog.Error("staging directory preserved for inspection", "path", stagingDir)
+		keepStaging(ctx, stagingDir, slog.Default())
 		return fmt.Errorf("%d pipeline(s) failed: %v", len(failed), failed)
 	}
 
 	return promoteStaging(stagingDir, outputDir)
 }
 
-// executePipelineToStaging runs a pipeline in a fresh temp dir and copies
-// the results to the appropriate location in stagingDir.
-func executePipelineToStaging(p *api.Pipeline, ctx map[string]any, baseDir, stagingDir string, updateSHA256 bool) error {
-	slog.Info("executing pipeline", "path", p.FilePath)
-
-	workDir, err := os.MkdirTemp("", "many-*")
-	if err != nil {
-		return fmt.Errorf("creating temp dir: %w", err)
+// executePipelines runs pipelines concurrently, with at most cap(lim) of them
+// executing at a time, and copies each result into stagingDir in discovery
+// order so that child pipelines still overwrite files produced by their
+// parents. It returns the file paths of failed pipelines in discovery order.
+func executePipelines(ctx context.Context, pipelines []*api.Pipeline, data map[string]any, baseDir, stagingDir string, updateSHA256 bool, lim limiter, log *slog.Logger) []string {
+	committed := make([]chan struct{}, len(pipelines))
+	for i := range committed {
+		committed[i] = make(chan struct{})
 	}
-	defer func() { _ = os.RemoveAll(workDir) }()
 
-	if err := RunPipeline(p, ctx, workDir, updateSHA256); err != nil {
-		return err
+	errs := forEach(len(pipelines), func(i int) error {
+		defer close(committed[i])
+		p := pipelines[i]
+
+		rel, err := filepath.Rel(baseDir, p.Dir)
+		if err != nil {
+			return fmt.Errorf("computing relative path for pipeline: %w", err)
+		}
+		plog := log.With("pipeline", filepath.ToSlash(rel))
+
+		lim.acquire()
+		workDir, cleanup, runErr := executePipeline(ctx, p, data, updateSHA256, plog)
+		lim.release()
+		if cleanup != nil {
+			defer cleanup()
+		}
+
+		// Wait for the previous pipeline to land in staging before our turn.
+		if i > 0 {
+			<-committed[i-1]
+		}
+		if runErr != nil {
+			return runErr
+		}
+		return copyToStaging(workDir, filepath.Join(stagingDir, rel))
+	})
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			log.Error("pipeline failed", "path", pipelines[i].FilePath, "error", err)
+			failed = append(failed, pipelines[i].FilePath)
+		}
 	}
+	return failed
+}
 
-	slog.Info("pipeline succeeded", "path", p.FilePath)
+// executePipeline runs a pipeline in a fresh temp dir and returns that dir.
+// The caller must call the returned cleanup to remove it, even when an error
+// is returned.
+func executePipeline(ctx context.Context, p *api.Pipeline, data map[string]any, updateSHA256 bool, log *slog.Logger) (string, func(), error) {
+	log.Info("executing pipeline", "path", p.FilePath)
 
-	rel, err := filepath.Rel(baseDir, p.Dir)
+	workDir, cleanup, err := mkdirTemp("", "many-*")
 	if err != nil {
-		return fmt.Errorf("computing relative path for pipeline: %w", err)
+		return "", nil, err
 	}
 
-	destDir := filepath.Join(stagingDir, rel)
+	if err := runPipeline(ctx, p, data, workDir, updateSHA256, log); err != nil {
+		return workDir, cleanup, err
+	}
+
+	log.Info("pipeline succeeded", "path", p.FilePath)
+	return workDir, cleanup, nil
+}
+
+// copyToStaging copies a finished work dir to destDir within the staging directory.
+func copyToStaging(workDir, destDir string) error {
 	if err := os.MkdirAll(destDir, 0o750); err != nil {
 		return fmt.Errorf("creating destination directory: %w", err)
 	}
@@ -336,8 +460,8 @@ func executePipelineToStaging(p *api.Pipeline, ctx map[string]any, baseDir, stag
 
 // RunSingle loads a pipeline directly, runs it in a temp directory, and promotes
 // results to outputDir.
-func RunSingle(pipelineFile, inputDir, outputDir string, globalContext map[string]any, updateSHA256 bool) error {
-	pipeline, err := api.LoadPipeline(pipelineFile)
+func RunSingle(ctx context.Context, pipelineFile, inputDir, outputDir string, globalContext map[string]any, updateSHA256 bool) error {
+	pipeline, err := api.LoadPipeline(ctx, pipelineFile)
 	if err != nil {
 		return fmt.Errorf("loading pipeline: %w", err)
 	}
@@ -354,15 +478,17 @@ func RunSingle(pipelineFile, inputDir, outputDir string, globalContext map[strin
 		return fmt.Errorf("creating staging directory: %w", err)
 	}
 
-	workDir, err := os.MkdirTemp("", "many-*")
+	defer trackDir(stagingDir)()
+
+	workDir, cleanup, err := mkdirTemp("", "many-*")
 	if err != nil {
-		return fmt.Errorf("creating temp dir: %w", err)
+		return err
 	}
-	defer func() { _ = os.RemoveAll(workDir) }()
+	defer cleanup()
 
 	slog.Info("executing single pipeline", "path", pipeline.FilePath)
-	if pErr := RunPipeline(pipeline, globalContext, workDir, updateSHA256); pErr != nil {
-		slog.Error("staging directory preserved for inspection", "path", stagingDir)
+	if pErr := RunPipeline(ctx, pipeline, globalContext, workDir, updateSHA256); pErr != nil {
+		keepStaging(ctx, stagingDir, slog.Default())
 		return fmt.Errorf("pipeline failed: %w", pErr)
 	}
 
@@ -383,15 +509,27 @@ func RunSingle(pipelineFile, inputDir, outputDir string, globalContext map[strin
 }
 
 // RunInstances processes each instance: pipeline discovery, temp-dir execution, promotion.
-func RunInstances(cfg *api.InstancesConfig, inputDir, outputDir string, globalContext map[string]any, maxDepth int, updateSHA256 bool) error {
-	var failed []string
-
-	for _, inst := range cfg.Instances {
-		slog.Info("processing instance", "name", inst.Name)
+// Instances are processed concurrently; at most parallelism pipelines run, or
+// remote inputs are fetched, at a time across all instances (values below 1
+// mean GOMAXPROCS).
+func RunInstances(ctx context.Context, cfg *api.InstancesConfig, inputDir, outputDir string, globalContext map[string]any, maxDepth int, updateSHA256 bool, parallelism int) error {
+	lim := newLimiter(parallelism)
+
+	// Instance goroutines only coordinate; input downloads and pipelines
+	// acquire slots of lim.
+	errs := forEach(len(cfg.Instances), func(i int) error {
+		inst := cfg.Instances[i]
+		log := slog.With("instance", inst.Name)
+		log.Info("processing instance", "name", inst.Name)
+		return runInstance(ctx, inst, inputDir, outputDir, globalContext, maxDepth, updateSHA256, lim, log)
+	})
 
-		if err := runInstance(inst, inputDir, outputDir, globalContext, maxDepth, updateSHA256); err != nil {
-			slog.Error("instance failed", "name", inst.Name, "error", err)
-			failed = append(failed, inst.Name)
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			name := cfg.Instances[i].Name
+			slog.Error("instance failed", "name", name, "error", err)
+			failed = append(failed, name)
 		}
 	}
 
@@ -402,8 +540,11 @@ func RunInstances(cfg *api.InstancesConfig, inputDir, outputDir string, globalCo
 	return nil
 }
 
-func runInstance(inst api.Instance, inputDir, outputDir string, globalContext map[string]any, maxDepth int, updateSHA256 bool) error {
-	instInputDir, cleanup, err := resolveInstanceInput(inst.Input, inputDir)
+func runInstance(ctx context.Context, inst api.Instance, inputDir, outputDir string, globalContext map[string]any, maxDepth int, updateSHA256 bool, lim limiter, log *slog.Logger) error {
+	// Fetching a remote input takes a slot of lim, like running a pipeline.
+	lim.acquire()
+	instInputDir, cleanup, err := resolveInstanceInput(ctx, inst.Input, inputDir)
+	lim.release()
 	if err != nil {
 		return err
 	}
@@ -418,8 +559,9 @@ func runInstance(inst api.Instance, inputDir, outputDir string, globalContext ma
 	if err != nil {
 		return err
 	}
+	defer trackDir(stagingDir)()
 
-	pipelines, err := DiscoverPipelines(instInputDir, maxDepth)
+	pipelines, err := DiscoverPipelines(ctx, instInputDir, maxDepth)
 	if err != nil {
 		return fmt.Errorf("discovering pipelines: %w", err)
 	}
@@ -427,25 +569,19 @@ func runInstance(inst api.Instance, inputDir, outputDir string, globalContext ma
 	pipelines = filterByInclude(pipelines, inst.Include, instInputDir)
 
 	if len(pipelines) == 0 {
-		slog.Warn("no .many.yaml files found for instance", "name", inst.Name)
+		log.Warn("no .many.yaml files found for instance", "name", inst.Name)
 	}
 
-	slog.Info("discovered pipelines for instance", "name", inst.Name, "count", len(pipelines))
+	log.Info("discovered pipelines for instance", "name", inst.Name, "count", len(pipelines))
 
-	var pipelineFailed bool
-	for _, p := range pipelines {
-		if err := executePipelineToStaging(p, instContext, instInputDir, stagingDir, updateSHA256); err != nil {
-			slog.Error("pipeline failed", "instance", inst.Name, "path", p.FilePath, "error", err)
-			pipelineFailed = true
-		}
-	}
+	failed := executePipelines(ctx, pipelines, instContext, instInputDir, stagingDir, updateSHA256, lim, log)
 
 	if err := removeConfigFiles(stagingDir); err != nil {
-		slog.Error("failed to clean up .many.yaml files", "instance", inst.Name, "error", err)
+		log.Error("failed to clean up .many.yaml files", "instance", inst.Name, "error", err)
 	}
 
-	if pipelineFailed {
-		slog.Error("staging directory preserved for inspection", "path", stagingDir)
+	if len(failed) > 0 {
+		keepStaging(ctx, stagingDir, log)
 		return fmt.Errorf("one or more pipelines failed")
 	}
 
@@ -467,7 +603,7 @@ func prepareStagingDir(outputDir string) (string, error) {
 
 // resolveInstanceInput determines the effective input directory for an instance.
 // The returned path is always absolute.
-func resolveInstanceInput(input, inputDir string) (string, func(), error) {
+func resolveInstanceInput(ctx context.Context, input, inputDir string) (string, func(), error) {
 	var dir string
 	var cleanup func()
 
@@ -475,7 +611,7 @@ func resolveInstanceInput(input, inputDir string) (string, func(), error) {
 	case input == "":
 		dir = inputDir
 	case resolve.IsRemote(input):
-		resolved, c, _, err := resolve.Resolve(input, "")
+		resolved, c, _, err := resolve.Resolve(ctx, input, "")
 		if err != nil {
 			return "", nil, fmt.Errorf("resolving remote input %q: %w", input, err)
 		}
@@ -555,18 +691,26 @@ func relativeToInput(file, inputDir string) (string, bool) {
 
 // resolveSources fetches all source entries and overlays them into targetDir.
 // File sources with relative paths are resolved relative to baseDir.
-// If pipelineFilePath is non-empty, any HTTPS sources with empty sha256 fields
-// will have their computed hashes written back to the pipeline file.
-func resolveSources(sources api.Sources, targetDir, baseDir, pipelineFilePath string) (cleanup func(), err error) {
-	cleanups, updates, err := resolveAllEntries(sources, targetDir, baseDir)
+// Any HTTPS sources with empty sha256 fields, Git sources with empty commit
+// fields and OCI sources without a digest will have their computed values
+// written back to whichever of pipelineFiles declares them.
+// The source each overlaid file came from is logged to log at debug level.
+func resolveSources(ctx context.Context, sources api.Sources, targetDir, baseDir string, pipelineFiles []string, log *slog.Logger) (cleanup func(), err error) {
+	origins := make(map[string]string)
+	cleanups, pins, err := resolveAllEntries(ctx, sources, targetDir, baseDir, origins, log)
 	if err != nil {
 		return nil, err
 	}
+	logOrigins(log, targetDir, origins)
 
-	if len(updates) > 0 && pipelineFilePath != "" {
-		if err := api.UpdateSourceSHA256(pipelineFilePath, updates); err != nil {
-			slog.Warn("failed to write back computed sha256", "file", pipelineFilePath, "error", err)
+	if len(pins) > 0 {
+		pipelineFileMu.Lock()
+		for _, file := range pipelineFiles {
+			if err := api.UpdateSourcePins(file, pins); err != nil {
+				log.Warn("failed to write back pinned source values", "file", file, "error", err)
+			}
 		}
+		pipelineFileMu.Unlock()
 	}
 
 	if len(cleanups) == 0 {
@@ -579,12 +723,12 @@ func resolveSources(sources api.Sources, targetDir, baseDir, pipelineFilePath st
 	}, nil
 }
 
-func resolveAllEntries(sources api.Sources, targetDir, baseDir string) ([]func(), map[string]string, error) {
+func resolveAllEntries(ctx context.Context, sources api.Sources, targetDir, baseDir string, origins map[string]string, log *slog.Logger) ([]func(), []api.SourcePin, error) {
 	var cleanups []func()
-	var updates map[string]string
+	var pins []api.SourcePin
 
 	for i, entry := range sources {
-		entryCleanup, update, err := resolveAndOverlay(entry, targetDir, baseDir)
+		entryCleanup, pin, err := resolveAndOverlay(ctx, entry, targetDir, baseDir, origins, log)
 		if err != nil {
 			for j := len(cleanups) - 1; j >= 0; j-- {
 				cleanups[j]()
@@ -594,28 +738,21 @@ func resolveAllEntries(sources api.Sources, targetDir, baseDir string) ([]func()
 		if entryCleanup != nil {
 			cleanups = append(cleanups, entryCleanup)
 		}
-		if update != nil {
-			if updates == nil {
-				updates = make(map[string]string)
-			}
-			updates[update.url] = update.sha256
+		if pin != nil {
+			pins = append(pins, *pin)
 		}
 	}
 
-	return cleanups, updates, nil
-}
-
-// sha256Update records a computed sha256 for an HTTPS source URL.
-type sha256Update struct {
-	url    string
-	sha256 string
+	return cleanups, pins, nil
 }
 
 // resolveAndOverlay resolves a single source entry and overlays it into targetDir.
 // File sources with relative paths are resolved relative to baseDir.
-// If the entry is an HTTPS source with an empty sha256 and a hash was computed,
-// it is returned as a sha256Update.
-func resolveAndOverlay(entry api.SourceEntry, targetDir, baseDir string) (func(), *sha256Update, error) {
+// If the entry is an unpinned HTTPS, Git or OCI source, the computed sha256,
+// commit or digest is returned as a pin to write back. The source of every
+// file written is recorded in origins, keyed by target path, and conflicts
+// with existing files are logged to log.
+func resolveAndOverlay(ctx context.Context, entry api.SourceEntry, targetDir, baseDir string, origins map[string]string, log *slog.Logger) (func(), *api.SourcePin, error) {
 	uri := entry.URI()
 	if uri == "" {
 		return nil, nil, nil
@@ -626,9 +763,10 @@ func resolveAndOverlay(entry api.SourceEntry, targetDir, baseDir string) (func()
 		uri = filepath.Join(baseDir, uri)
 	}
 
-	localPath, cleanup, computed, err := resolveEntry(entry, uri)
+	display := resolve.RedactURL(uri)
+	localPath, cleanup, computed, err := fetchSource(ctx, entry, uri)
 	if err != nil {
-		return nil, nil, fmt.Errorf("resolving %q: %w", uri, err)
+		return nil, nil, fmt.Errorf("resolving %q: %w", display, err)
 	}
 
 	dest := targetDir
@@ -636,63 +774,277 @@ func resolveAndOverlay(entry api.SourceEntry, targetDir, baseDir string) (func()
 		dest = filepath.Join(targetDir, entry.Path)
 	}
 
-	if overlayErr := overlaySource(localPath, dest); overlayErr != nil {
+	filter := sourceFilter{include: entry.Include, exclude: entry.Exclude}
+	policy := overlayPolicy{source: resolve.RedactURL(entry.URI()), onConflict: entry.OnConflict, origins: origins, log: log}
+	root, rootErr := sourceRoot(localPath, entry.Subdir)
+	if rootErr == nil {
+		rootErr = overlaySource(root, dest, filter, policy)
+	}
+	if rootErr != nil {
 		if cleanup != nil {
 			cleanup()
 		}
-		return nil, nil, fmt.Errorf("overlaying %q: %w", uri, overlayErr)
+		return nil, nil, fmt.Errorf("overlaying %q: %w", display, rootErr)
 	}
 
-	update := buildSHA256Update(entry, computed)
-	return cleanup, update, nil
+	return cleanup, buildSourcePin(entry, computed), nil
 }
 
-func buildSHA256Update(entry api.SourceEntry, computed string) *sha256Update {
-	if entry.HTTPS != "" && entry.SHA256 == "" && computed != "" {
-		return &sha256Update{url: entry.HTTPS, sha256: computed}
+// fetchSource resolves entry within its timeout and checks the result against
+// the lock file in use, if any.
+func fetchSource(ctx context.Context, entry api.SourceEntry, uri string) (string, func(), string, error) {
+	timeout, err := entry.TimeoutDuration()
+	if err != nil {
+		return "", nil, "", err //nolint:wrapcheck // already describes the field
+	}
+	rctx, cancel := resolve.WithTimeout(ctx, timeout)
+	path, cleanup, computed, err := resolveEntry(rctx, entry, uri)
+	cancel()
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return "", nil, "", fmt.Errorf("timed out: %w", err)
+		}
+		return "", nil, "", err
+	}
+
+	if err := checkLock(entry, uri, path, computed); err != nil {
+		if cleanup != nil {
+			cleanup()
+		}
+		return "", nil, "", err
+	}
+	return path, cleanup, computed, nil
+}
+
+func buildSourcePin(entry api.SourceEntry, computed string) *api.SourcePin {
+	if computed == "" {
+		return nil
+	}
+	switch {
+	case entry.HTTPS != "" && entry.SHA256 == "":
+		return &api.SourcePin{Scheme: "https", URI: entry.HTTPS, Field: "sha256", Value: computed}
+	case entry.OCI != "" && entry.Digest == "" && !strings.Contains(entry.OCI, "@"):
+		return &api.SourcePin{Scheme: "oci", URI: entry.OCI, Field: "digest", Value: computed}
+	case entry.Git != "" && entry.Commit == "":
+		return &api.SourcePin{
+			Scheme: "git",
+			URI:    entry.Git,
+			Match:  map[string]string{"ref": entry.Ref, "subdir": entry.Subdir},
+			Field:  "commit",
+			Value:  computed,
+		}
 	}
 	return nil
 }
 
-func resolveEntry(entry api.SourceEntry, uri string) (string, func(), string, error) {
+func resolveEntry(ctx context.Context, entry api.SourceEntry, uri string) (string, func(), string, error) {
 	if entry.Recursive && entry.OCM != "" {
-		path, cleanup, err := resolve.ResolveOCMRecursive(entry.OCM)
+		path, cleanup, err := resolve.ResolveOCMRecursive(ctx, entry.OCM)
 		if err != nil {
 			return "", nil, "", fmt.Errorf("resolving OCM recursive: %w", err)
 		}
 		return path, cleanup, "", nil
 	}
+	if entry.Git != "" {
+		path, cleanup, commit, err := resolve.ResolveGit(ctx, entry.Git, entry.Ref, entry.Commit)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("resolving git source: %w", err)
+		}
+		return path, cleanup, commit, nil
+	}
+	if entry.OCI != "" {
+		path, cleanup, digest, err := resolve.ResolveOCI(ctx, entry.OCI, entry.Digest)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("resolving oci source: %w", err)
+		}
+		return path, cleanup, digest, nil
+	}
+	if entry.HTTPS != "" {
+		path, cleanup, computed, err := resolve.ResolveHTTPS(ctx, entry.HTTPS, entry.SHA256, entry.Archive, entry.Headers)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("resolving https source: %w", err)
+		}
+		return path, cleanup, computed, nil
+	}
 	if entry.Helm != "" {
-		path, cleanup, err := resolve.ResolveHelm(entry.Helm, entry.Repo, entry.Version)
+		path, cleanup, err := resolve.ResolveHelm(ctx, entry.Helm, entry.Repo, entry.Version)
 		if err != nil {
 			return "", nil, "", fmt.Errorf("resolving helm chart: %w", err)
 		}
 		return path, cleanup, "", nil
 	}
-	path, cleanup, computed, err := resolve.Resolve(uri, entry.SHA256)
+	path, cleanup, computed, err := resolve.Resolve(ctx, uri, entry.SHA256)
 	if err != nil {
 		return "", nil, "", fmt.Errorf("resolving source: %w", err)
 	}
 	return path, cleanup, computed, nil
 }
 
-// overlaySource copies resolved content into dest.
+// sourceFilter selects the files of a source that are overlaid, by glob
+// patterns matched against paths relative to the source root.
+type sourceFilter struct {
+	include []string // if set, only matching files are overlaid
+	exclude []string // matching files are never overlaid
+}
+
+func (f sourceFilter) empty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+// selects reports whether the file at rel (slash-separated) passes the filter.
+func (f sourceFilter) selects(rel string) (bool, error) {
+	if len(f.include) > 0 {
+		included, err := matchesAnyPattern(rel, f.include)
+		if err != nil || !included {
+			return false, err
+		}
+	}
+	excluded, err := matchesAnyPattern(rel, f.exclude)
+	return !excluded, err
+}
+
+// sourceRoot returns the directory subdir within a resolved source, or
+// resolvedPath itself when subdir is empty.
+func sourceRoot(resolvedPath, subdir string) (string, error) {
+	if subdir == "" {
+		return resolvedPath, nil
+	}
+	if st, err := os.Stat(resolvedPath); err != nil || !st.IsDir() {
+		return "", fmt.Errorf("subdir %q requires a directory source", subdir)
+	}
+	root := filepath.Join(resolvedPath, subdir)
+	if st, err := os.Stat(root); err != nil || !st.IsDir() {
+		return "", fmt.Errorf("subdir %q not found in source", subdir)
+	}
+	return root, nil
+}
+
+// overlayPolicy decides how source files are written over files that already
+// exist in the work dir, and records where each written file came from.
+type overlayPolicy struct {
+	source     string            // URI of the source being overlaid
+	onConflict string            // one of the api.OnConflict values; "" overwrites
+	origins    map[string]string // target path -> source URI; may be nil
+	log        *slog.Logger      // receives conflict messages; nil means slog.Default
+}
+
+func (p overlayPolicy) logger() *slog.Logger {
+	if p.log != nil {
+		return p.log
+	}
+	return slog.Default()
+}
+
+// place copies the file at srcPath to target, applying the conflict policy
+// when target already exists.
+func (p overlayPolicy) place(srcPath, target string, mode fs.FileMode) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", srcPath, err)
+	}
+
+	origin := p.source
+	if _, statErr := os.Lstat(target); statErr == nil {
+		previous := p.origins[target]
+		switch p.onConflict {
+		case api.OnConflictSkip:
+			p.logger().Debug("keeping existing file", "path", target, "source", p.source, "existing", previous)
+			return nil
+		case api.OnConflictError:
+			if previous != "" {
+				return fmt.Errorf("%s already exists (from %s)", target, previous)
+			}
+			return fmt.Errorf("%s already exists", target)
+		case api.OnConflictMergeYAML:
+			if data, err = mergeExisting(target, data); err != nil {
+				return err
+			}
+			if previous != "" {
+				origin = previous + ", " + p.source
+			}
+			p.logger().Debug("merged into existing file", "path", target, "source", p.source, "existing", previous)
+		default:
+			p.logger().Debug("overwriting existing file", "path", target, "source", p.source, "existing", previous)
+		}
+	}
+
+	if err := os.WriteFile(target, data, mode); err != nil {
+		return fmt.Errorf("writing %s: %w", target, err)
+	}
+	if p.origins != nil {
+		p.origins[target] = origin
+	}
+	return nil
+}
+
+// mergeExisting deep-merges data into the YAML file at target and returns
+// the merged content.
+func mergeExisting(target string, data []byte) ([]byte, error) {
+	if !isYAMLFile(target) {
+		return nil, fmt.Errorf("%s already exists and merge-yaml only merges .yaml and .yml files", target)
+	}
+	existing, err := os.ReadFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", target, err)
+	}
+	merged, err := mergeYAML(existing, data)
+	if err != nil {
+		return nil, fmt.Errorf("merging into %s: %w", target, err)
+	}
+	return merged, nil
+}
+
+// logOrigins logs the source of every overlaid file, relative to targetDir.
+func logOrigins(log *slog.Logger, targetDir string, origins map[string]string) {
+	paths := make([]string, 0, len(origins))
+	for path := range origins {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		rel, err := filepath.Rel(targetDir, path)
+		if err != nil {
+			rel = path
+		}
+		log.Debug("work dir file origin", "path", filepath.ToSlash(rel), "source", origins[path])
+	}
+}
+
+// overlaySource copies the resolved content selected by filter into dest,
+// resolving clashes with existing files by policy.
 // If resolvedPath is a directory, its contents are copied recursively.
-// If resolvedPath is a file, it is copied into dest/.
-func overlaySource(resolvedPath, dest string) error {
+// If resolvedPath is a file, it is copied into dest/ and filtered by its name.
+// An include filter that selects nothing is an error.
+func overlaySource(resolvedPath, dest string, filter sourceFilter, policy overlayPolicy) error {
 	info, err := os.Stat(resolvedPath)
 	if err != nil {
 		return fmt.Errorf("stat %s: %w", resolvedPath, err)
 	}
 
+	copied := 0
 	if info.IsDir() {
-		return overlayDir(resolvedPath, dest)
+		copied, err = overlayDir(resolvedPath, dest, filter, policy)
+	} else {
+		var ok bool
+		if ok, err = filter.selects(filepath.Base(resolvedPath)); ok {
+			err = overlaySingleFile(resolvedPath, dest, info, policy)
+			copied = 1
+		}
 	}
-
-	return overlaySingleFile(resolvedPath, dest, info)
+	if err != nil {
+		return err
+	}
+	if copied == 0 && len(filter.include) > 0 {
+		return fmt.Errorf("include patterns %v matched no files", filter.include)
+	}
+	return nil
 }
 
-func overlayDir(src, dest string) error {
+// overlayDir copies the files below src selected by filter into dest and
+// returns how many were copied. Directories are only recreated as such when
+// nothing is filtered; otherwise they exist only as parents of copied files.
+func overlayDir(src, dest string, filter sourceFilter, policy overlayPolicy) (int, error) {
+	copied := 0
 	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("walk error at %s: %w", path, err)
@@ -703,51 +1055,41 @@ func overlayDir(src, dest string) error {
 		}
 		target := filepath.Join(dest, rel)
 		if d.IsDir() {
+			if !filter.empty() {
+				return nil
+			}
 			if mkErr := os.MkdirAll(target, 0o750); mkErr != nil {
 				return fmt.Errorf("creating directory %s: %w", target, mkErr)
 			}
 			return nil
 		}
-		_, copyErr := copyFileEntry(path, target, d)
-		if copyErr != nil {
-			return copyErr
+		if ok, matchErr := filter.selects(filepath.ToSlash(rel)); matchErr != nil || !ok {
+			return matchErr
+		}
+		if mkErr := os.MkdirAll(filepath.Dir(target), 0o750); mkErr != nil {
+			return fmt.Errorf("creating directory %s: %w", filepath.Dir(target), mkErr)
 		}
+		info, infoErr := d.Info()
+		if infoErr != nil {
+			return fmt.Errorf("stat %s: %w", path, infoErr)
+		}
+		if placeErr := policy.place(path, target, info.Mode()); placeErr != nil {
+			return placeErr
+		}
+		copied++
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("copying tree: %w", err)
+		return copied, fmt.Errorf("copying tree: %w", err)
 	}
-	return nil
+	return copied, nil
 }
 
-func copyFileEntry(srcPath, target string, d fs.DirEntry) (string, error) {
-	data, err := os.ReadFile(srcPath)
-	if err != nil {
-		return "", fmt.Errorf("reading %s: %w", srcPath, err)
-	}
-	info, err := d.Info()
-	if err != nil {
-		return "", fmt.Errorf("stat %s: %w", srcPath, err)
-	}
-	if err := os.WriteFile(target, data, info.Mode()); err != nil {
-		return "", fmt.Errorf("writing %s: %w", target, err)
-	}
-	return target, nil
-}
-
-func overlaySingleFile(resolvedPath, dest string, info os.FileInfo) error {
+func overlaySingleFile(resolvedPath, dest string, info os.FileInfo, policy overlayPolicy) error {
 	if err := os.MkdirAll(dest, 0o750); err != nil {
 		return fmt.Errorf("creating directory %s: %w", dest, err)
 	}
-	target := filepath.Join(dest, filepath.Base(resolvedPath))
-	data, err := os.ReadFile(resolvedPath)
-	if err != nil {
-		return fmt.Errorf("reading %s: %w", resolvedPath, err)
-	}
-	if err := os.WriteFile(target, data, info.Mode()); err != nil {
-		return fmt.Errorf("writing %s: %w", target, err)
-	}
-	return nil
+	return policy.place(resolvedPath, filepath.Join(dest, filepath.Base(resolvedPath)), info.Mode())
 }
 
 func removeConfigFiles(root string) error {
@@ -755,7 +1097,7 @@ func removeConfigFiles(root string) error {
 		if err != nil {
 			return fmt.Errorf("walk error at %s: %w", path, err)
 		}
-		if !d.IsDir() && d.Name() == configFilename {
+		if !d.IsDir() && (d.Name() == configFilename || d.Name() == api.LockFileName) {
 			slog.Debug("removing config file from output", "path", path)
 			if rmErr := os.Remove(path); rmErr != nil {
 				return fmt.Errorf("removing %s: %w", path, rmErr)
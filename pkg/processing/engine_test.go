@@ -1,11 +1,30 @@
 package processing
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
-
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/systemstart/many-templates/pkg/api"
 )
 
@@ -33,7 +52,7 @@ func TestRunPipeline_ContextMerge(t *testing.T) {
 
 	globalCtx := map[string]any{"global": "G", "local": "overridden"}
 
-	if err := RunPipeline(pipeline, globalCtx, workDir, true); err != nil {
+	if err := RunPipeline(t.Context(), pipeline, globalCtx, workDir, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -137,7 +156,7 @@ pipeline:
 		t.Fatal(err)
 	}
 
-	if err := RunAll(src, dst, nil, -1, true); err != nil {
+	if err := RunAll(t.Context(), src, dst, nil, -1, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -165,7 +184,7 @@ func TestRunAll_NoPipelines(t *testing.T) {
 	}
 
 	// No pipelines => empty output (nothing promoted)
-	if err := RunAll(src, dst, nil, -1, true); err != nil {
+	if err := RunAll(t.Context(), src, dst, nil, -1, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -200,7 +219,7 @@ func TestRemoveBuildArtifacts(t *testing.T) {
 	writeFile("manifests/deploy.yaml", "apiVersion: apps/v1")
 
 	// Run cleanup
-	removeBuildArtifacts(dir, []string{
+	removeBuildArtifacts(slog.Default(), dir, []string{
 		"kustomization.yaml",
 		"charts",
 		"values.yaml",
@@ -244,7 +263,7 @@ pipeline:
 	}
 
 	pipelineFile := filepath.Join(src, ".many.yaml")
-	if err := RunSingle(pipelineFile, src, dst, nil, true); err != nil {
+	if err := RunSingle(t.Context(), pipelineFile, src, dst, nil, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -337,7 +356,7 @@ pipeline:
 	writeTestFile(t, filepath.Join(sub, "deep.txt"), "{{ .val }}")
 
 	// maxDepth=0 should only process root pipeline
-	if err := RunAll(src, dst, nil, 0, true); err != nil {
+	if err := RunAll(t.Context(), src, dst, nil, 0, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -411,7 +430,7 @@ func TestRunInstances_Integration(t *testing.T) {
 		},
 	}
 
-	if err := RunInstances(cfg, src, dst, nil, -1, true); err != nil {
+	if err := RunInstances(t.Context(), cfg, src, dst, nil, -1, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -453,7 +472,7 @@ func TestRunInstances_IncludeFilter(t *testing.T) {
 		},
 	}
 
-	if err := RunInstances(cfg, src, dst, nil, -1, true); err != nil {
+	if err := RunInstances(t.Context(), cfg, src, dst, nil, -1, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -490,7 +509,7 @@ pipeline:
 		},
 	}
 
-	err := RunInstances(cfg, src, dst, nil, -1, true)
+	err := RunInstances(t.Context(), cfg, src, dst, nil, -1, true, 0)
 	if err == nil {
 		t.Fatal("expected error for failed instance")
 	}
@@ -509,7 +528,7 @@ func TestRunSingle_NonexistentPipelineFile(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err := RunSingle(filepath.Join(src, ".many.yaml"), src, dst, nil, true)
+	err := RunSingle(t.Context(), filepath.Join(src, ".many.yaml"), src, dst, nil, true)
 	if err == nil {
 		t.Fatal("expected error for nonexistent pipeline file")
 	}
@@ -532,7 +551,7 @@ pipeline:
 `)
 	writeTestFile(t, filepath.Join(src, "file.txt"), "content")
 
-	err := RunSingle(pipelineFile, src, dst, nil, true)
+	err := RunSingle(t.Context(), pipelineFile, src, dst, nil, true)
 	if err == nil {
 		t.Fatal("expected error for pipeline file outside input dir")
 	}
@@ -567,13 +586,79 @@ pipeline:
 		},
 	}
 
-	if err := RunInstances(cfg, src, dst, nil, -1, true); err != nil {
+	if err := RunInstances(t.Context(), cfg, src, dst, nil, -1, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	assertFileContent(t, filepath.Join(dst, "out", "greeting.txt"), "Hello World!")
 }
 
+// pushTestImage pushes an image to ref whose single layer holds the file
+// path with content.
+func pushTestImage(t *testing.T, ref, path, content string) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: path, Mode: 0o644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(parsed, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunInstances_RemoteInputsShareParallelism(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for m := maxInFlight.Load(); n > m && !maxInFlight.CompareAndSwap(m, n); m = maxInFlight.Load() {
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/input:v1"
+	pushTestImage(t, ref, ".many.yaml", "pipeline:\n  - name: render\n    type: template\n    template: {}\n")
+	maxInFlight.Store(0)
+
+	cfg := &api.InstancesConfig{}
+	for _, inst := range []string{"a", "b", "c", "d"} {
+		cfg.Instances = append(cfg.Instances, api.Instance{Name: inst, Input: "oci://" + ref, Output: inst})
+	}
+	if err := RunInstances(t.Context(), cfg, t.TempDir(), t.TempDir(), nil, -1, false, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := maxInFlight.Load(); got != 1 {
+		t.Errorf("expected inputs to be fetched one at a time, got %d concurrent requests", got)
+	}
+}
+
 func TestRunInstances_EmptyInput(t *testing.T) {
 	src := setupInstancesSource(t)
 	dst := filepath.Join(t.TempDir(), "output")
@@ -584,7 +669,7 @@ func TestRunInstances_EmptyInput(t *testing.T) {
 		},
 	}
 
-	if err := RunInstances(cfg, src, dst, nil, -1, true); err != nil {
+	if err := RunInstances(t.Context(), cfg, src, dst, nil, -1, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -612,7 +697,7 @@ func TestRunPipeline_WithStepSourceBasic(t *testing.T) {
 		},
 	}
 
-	if err := RunPipeline(pipeline, nil, workDir, true); err != nil {
+	if err := RunPipeline(t.Context(), pipeline, nil, workDir, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -644,7 +729,7 @@ func TestRunPipeline_WithSourcePath(t *testing.T) {
 		},
 	}
 
-	if err := RunPipeline(pipeline, nil, workDir, true); err != nil {
+	if err := RunPipeline(t.Context(), pipeline, nil, workDir, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -673,7 +758,7 @@ func TestRunPipeline_WithStepSource(t *testing.T) {
 		},
 	}
 
-	if err := RunPipeline(pipeline, nil, workDir, true); err != nil {
+	if err := RunPipeline(t.Context(), pipeline, nil, workDir, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -690,7 +775,7 @@ func TestOverlaySource_Directory(t *testing.T) {
 
 	// Overlay into a new destination
 	dst := filepath.Join(t.TempDir(), "dest")
-	if err := overlaySource(src, dst); err != nil {
+	if err := overlaySource(src, dst, sourceFilter{}, overlayPolicy{}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -705,13 +790,212 @@ func TestOverlaySource_SingleFile(t *testing.T) {
 
 	// Overlay the single file into a destination directory
 	dst := filepath.Join(t.TempDir(), "dest")
-	if err := overlaySource(filepath.Join(src, "single.yaml"), dst); err != nil {
+	if err := overlaySource(filepath.Join(src, "single.yaml"), dst, sourceFilter{}, overlayPolicy{}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	assertFileContent(t, filepath.Join(dst, "single.yaml"), "content: here")
 }
 
+func TestOverlaySource_Filter(t *testing.T) {
+	src := t.TempDir()
+	mkdirAll(t, filepath.Join(src, "manifests", "tests"))
+	mkdirAll(t, filepath.Join(src, "docs"))
+	writeTestFile(t, filepath.Join(src, "manifests", "app.yaml"), "app")
+	writeTestFile(t, filepath.Join(src, "manifests", "tests", "check.yaml"), "test")
+	writeTestFile(t, filepath.Join(src, "manifests", "README.md"), "readme")
+	writeTestFile(t, filepath.Join(src, "docs", "index.md"), "docs")
+
+	dst := filepath.Join(t.TempDir(), "dest")
+	filter := sourceFilter{include: []string{"manifests/**/*.yaml"}, exclude: []string{"**/tests/**"}}
+	if err := overlaySource(src, dst, filter, overlayPolicy{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "manifests", "app.yaml"), "app")
+	assertNotExists(t, filepath.Join(dst, "manifests", "tests"))
+	assertNotExists(t, filepath.Join(dst, "manifests", "README.md"))
+	assertNotExists(t, filepath.Join(dst, "docs"))
+}
+
+func TestOverlaySource_IncludeMatchesNothing(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha")
+
+	err := overlaySource(src, t.TempDir(), sourceFilter{include: []string{"*.yaml"}}, overlayPolicy{})
+	if err == nil || !strings.Contains(err.Error(), "matched no files") {
+		t.Fatalf("expected no match error, got %v", err)
+	}
+}
+
+func TestOverlaySource_FilterSingleFile(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "single.yaml"), "content")
+
+	dst := filepath.Join(t.TempDir(), "dest")
+	if err := overlaySource(filepath.Join(src, "single.yaml"), dst, sourceFilter{exclude: []string{"*.yaml"}}, overlayPolicy{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertNotExists(t, filepath.Join(dst, "single.yaml"))
+}
+
+func TestSourceRoot(t *testing.T) {
+	src := t.TempDir()
+	mkdirAll(t, filepath.Join(src, "deploy", "manifests"))
+	writeTestFile(t, filepath.Join(src, "file.yaml"), "x")
+
+	root, err := sourceRoot(src, "deploy/manifests")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if root != filepath.Join(src, "deploy", "manifests") {
+		t.Errorf("root = %s", root)
+	}
+
+	if _, err := sourceRoot(src, "nope"); err == nil || !strings.Contains(err.Error(), `subdir "nope" not found`) {
+		t.Errorf("expected missing subdir error, got %v", err)
+	}
+	if _, err := sourceRoot(filepath.Join(src, "file.yaml"), "deploy"); err == nil || !strings.Contains(err.Error(), "requires a directory source") {
+		t.Errorf("expected directory source error, got %v", err)
+	}
+}
+
+func TestRunPipeline_SourceSubdirAndFilter(t *testing.T) {
+	sourceDir := t.TempDir()
+	mkdirAll(t, filepath.Join(sourceDir, "repo", "deploy", "manifests"))
+	writeTestFile(t, filepath.Join(sourceDir, "repo", "deploy", "manifests", "app.yaml"), "name: {{ .name }}")
+	writeTestFile(t, filepath.Join(sourceDir, "repo", "deploy", "manifests", "notes.txt"), "notes")
+	writeTestFile(t, filepath.Join(sourceDir, "repo", "go.mod"), "module x")
+
+	workDir := t.TempDir()
+	writeTestFile(t, filepath.Join(workDir, "keep.yaml"), "keep")
+
+	pipeline := &api.Pipeline{
+		Dir: sourceDir,
+		Pipeline: []api.StepConfig{
+			{
+				Name: "render",
+				Type: api.StepTypeTemplate,
+				Source: api.Sources{{
+					File:    "repo",
+					Subdir:  "deploy/manifests",
+					Include: []string{"*.yaml"},
+				}},
+				Template: &api.TemplateConfig{Files: api.FileFilter{Include: []string{"app.yaml"}}},
+			},
+		},
+	}
+
+	if err := RunPipeline(t.Context(), pipeline, map[string]any{"name": "web"}, workDir, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(workDir, "app.yaml"), "name: web")
+	assertFileContent(t, filepath.Join(workDir, "keep.yaml"), "keep")
+	assertNotExists(t, filepath.Join(workDir, "notes.txt"))
+	assertNotExists(t, filepath.Join(workDir, "go.mod"))
+}
+
+func TestResolveSources_OnConflict(t *testing.T) {
+	baseDir := t.TempDir()
+	mkdirAll(t, filepath.Join(baseDir, "a"))
+	mkdirAll(t, filepath.Join(baseDir, "b"))
+	writeTestFile(t, filepath.Join(baseDir, "a", "values.yaml"), "image:\n  repo: app\n  tag: v1\nreplicas: 1\n")
+	writeTestFile(t, filepath.Join(baseDir, "a", "README"), "a")
+	writeTestFile(t, filepath.Join(baseDir, "b", "values.yaml"), "image:\n  tag: v2\n")
+	writeTestFile(t, filepath.Join(baseDir, "b", "README"), "b")
+
+	tests := []struct {
+		name       string
+		onConflict string
+		include    []string
+		wantValues string
+		wantReadme string
+		wantErr    string
+	}{
+		{"default overwrites", "", nil, "image:\n  tag: v2\n", "b", ""},
+		{"overwrite", api.OnConflictOverwrite, nil, "image:\n  tag: v2\n", "b", ""},
+		{"skip", api.OnConflictSkip, nil, "image:\n  repo: app\n  tag: v1\nreplicas: 1\n", "a", ""},
+		{"error", api.OnConflictError, nil, "", "", "already exists (from a)"},
+		{"merge-yaml", api.OnConflictMergeYAML, []string{"*.yaml"}, "image:\n  repo: app\n  tag: v2\nreplicas: 1\n", "a", ""},
+		{"merge-yaml non-yaml", api.OnConflictMergeYAML, nil, "", "", "merge-yaml only merges .yaml and .yml files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			sources := api.Sources{
+				{File: "a"},
+				{File: "b", OnConflict: tt.onConflict, Include: tt.include},
+			}
+			cleanup, err := resolveSources(t.Context(), sources, workDir, baseDir, nil, slog.Default())
+			if cleanup != nil {
+				defer cleanup()
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertFileContent(t, filepath.Join(workDir, "values.yaml"), tt.wantValues)
+			assertFileContent(t, filepath.Join(workDir, "README"), tt.wantReadme)
+		})
+	}
+}
+
+func TestOverlayPolicy_RecordsOrigins(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "x.yaml"), "a: 1\n")
+	dst := t.TempDir()
+
+	origins := make(map[string]string)
+	first := overlayPolicy{source: "first", origins: origins}
+	second := overlayPolicy{source: "second", onConflict: api.OnConflictMergeYAML, origins: origins}
+	third := overlayPolicy{source: "third", onConflict: api.OnConflictSkip, origins: origins}
+	for _, p := range []overlayPolicy{first, second, third} {
+		if err := overlaySource(src, dst, sourceFilter{}, p); err != nil {
+			t.Fatalf("%s: %v", p.source, err)
+		}
+	}
+
+	if got := origins[filepath.Join(dst, "x.yaml")]; got != "first, second" {
+		t.Errorf("origin = %q, want %q", got, "first, second")
+	}
+}
+
+func TestRunPipeline_LogsOriginsWithStepLogger(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestFile(t, filepath.Join(sourceDir, "app.txt"), "{{ .name }}")
+	pipeline := &api.Pipeline{
+		Dir: sourceDir,
+		Pipeline: []api.StepConfig{
+			{
+				Name:     "render",
+				Type:     api.StepTypeTemplate,
+				Source:   api.Sources{{File: "app.txt"}, {File: "app.txt"}},
+				Template: &api.TemplateConfig{},
+			},
+		},
+	}
+
+	var logs bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})).With("pipeline", "app")
+	if err := runPipeline(t.Context(), pipeline, map[string]any{"name": "x"}, t.TempDir(), false, log); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`msg="overwriting existing file" pipeline=app step=render`,
+		`msg="work dir file origin" pipeline=app step=render path=app.txt`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected %q in the logs, got:\n%s", want, logs.String())
+		}
+	}
+}
+
 func TestRunAll_FailedPipeline(t *testing.T) {
 	src := t.TempDir()
 	dst := filepath.Join(t.TempDir(), "output")
@@ -733,7 +1017,7 @@ pipeline:
 		t.Fatal(err)
 	}
 
-	err := RunAll(src, dst, nil, -1, true)
+	err := RunAll(t.Context(), src, dst, nil, -1, true, 0)
 	if err == nil {
 		t.Fatal("expected error for failed pipeline")
 	}
@@ -766,7 +1050,7 @@ pipeline:
 `)
 	writeTestFile(t, filepath.Join(src, "hello.txt"), "Hello {{ .name }}!")
 
-	if err := RunAll(src, dst, nil, -1, true); err != nil {
+	if err := RunAll(t.Context(), src, dst, nil, -1, true, 0); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -794,7 +1078,7 @@ pipeline:
 	writeTestFile(t, filepath.Join(src, "bad.txt"), "{{ .missing | fail }}")
 
 	pipelineFile := filepath.Join(src, ".many.yaml")
-	err := RunSingle(pipelineFile, src, dst, nil, true)
+	err := RunSingle(t.Context(), pipelineFile, src, dst, nil, true)
 	if err == nil {
 		t.Fatal("expected error for failed pipeline")
 	}
@@ -806,6 +1090,25 @@ pipeline:
 	}
 }
 
+func TestRunAll_Interrupted_RemovesStagingDir(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "output")
+
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), `
+pipeline:
+  - name: render
+    type: template
+    template: {}
+`)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := RunAll(ctx, src, dst, nil, -1, false, 0); err == nil {
+		t.Fatal("expected error for interrupted run")
+	}
+	assertNotExists(t, filepath.Join(dst, ".many-tmp"))
+}
+
 func TestRunInstances_PartialFailure_IndependentStaging(t *testing.T) {
 	src := t.TempDir()
 	dst := filepath.Join(t.TempDir(), "output")
@@ -834,7 +1137,7 @@ pipeline:
 		},
 	}
 
-	err := RunInstances(cfg, src, dst, nil, -1, true)
+	err := RunInstances(t.Context(), cfg, src, dst, nil, -1, true, 0)
 	if err == nil {
 		t.Fatal("expected error for failed instance")
 	}
@@ -888,7 +1191,7 @@ func TestApplyExcludes(t *testing.T) {
 	writeTestFile(t, filepath.Join(dir, "remove.tmp"), "remove")
 	writeTestFile(t, filepath.Join(dir, "also-keep.txt"), "keep")
 
-	if err := applyExcludes(dir, []string{"*.tmp"}); err != nil {
+	if err := applyExcludes(slog.Default(), dir, []string{"*.tmp"}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -905,7 +1208,7 @@ func TestApplyExcludes_DoublestarPattern(t *testing.T) {
 	writeTestFile(t, filepath.Join(dir, "sub", "deep", "bottom.tmp"), "remove")
 	writeTestFile(t, filepath.Join(dir, "sub", "keep.yaml"), "keep")
 
-	if err := applyExcludes(dir, []string{"**/*.tmp"}); err != nil {
+	if err := applyExcludes(slog.Default(), dir, []string{"**/*.tmp"}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -921,7 +1224,7 @@ func TestApplyExcludes_CleansEmptyDirs(t *testing.T) {
 	writeTestFile(t, filepath.Join(dir, "empty-after", "nested", "file.tmp"), "remove")
 	writeTestFile(t, filepath.Join(dir, "keep.yaml"), "keep")
 
-	if err := applyExcludes(dir, []string{"**/*.tmp"}); err != nil {
+	if err := applyExcludes(slog.Default(), dir, []string{"**/*.tmp"}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -999,7 +1302,7 @@ func TestRunStep_WithExclude(t *testing.T) {
 		},
 	}
 
-	if err := RunPipeline(pipeline, nil, workDir, true); err != nil {
+	if err := RunPipeline(t.Context(), pipeline, nil, workDir, true); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -1009,3 +1312,422 @@ func TestRunStep_WithExclude(t *testing.T) {
 	assertNotExists(t, filepath.Join(workDir, "build.tmp"))
 	assertNotExists(t, filepath.Join(workDir, "secret.env"))
 }
+
+func TestRunAll_ParallelChildOverridesParent(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "output")
+
+	pipelineYAML := `
+pipeline:
+  - name: render
+    type: template
+    source:
+      file: "."
+    template:
+      files:
+        include: ["**/*.txt"]
+`
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), pipelineYAML)
+	writeTestFile(t, filepath.Join(src, "root.txt"), "{{ .who }}")
+	for _, name := range []string{"a", "b", "c"} {
+		dir := filepath.Join(src, name)
+		mkdirAll(t, dir)
+		writeTestFile(t, filepath.Join(dir, ".many.yaml"), `
+context:
+  who: child-`+name+`
+`+pipelineYAML)
+		writeTestFile(t, filepath.Join(dir, "child.txt"), "{{ .who }}")
+	}
+
+	if err := RunAll(t.Context(), src, dst, map[string]any{"who": "parent"}, -1, true, 4); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "root.txt"), "parent")
+	for _, name := range []string{"a", "b", "c"} {
+		// The parent pipeline also renders child.txt, but the child's output must win.
+		assertFileContent(t, filepath.Join(dst, name, "child.txt"), "child-"+name)
+	}
+}
+
+func TestRunInstances_ParallelDoesNotShareContext(t *testing.T) {
+	src := setupMultiAppSource(t, []string{"app1", "app2", "app3"})
+	for _, app := range []string{"app1", "app2", "app3"} {
+		writeTestFile(t, filepath.Join(src, app, "data.txt"), "{{ .nested.v }}")
+	}
+	dst := filepath.Join(t.TempDir(), "output")
+
+	global := map[string]any{"nested": map[string]any{"v": "{{ .name }}"}}
+	cfg := &api.InstancesConfig{
+		Instances: []api.Instance{
+			{Name: "one", Output: "one", Context: map[string]any{"name": "one"}},
+			{Name: "two", Output: "two", Context: map[string]any{"name": "two"}},
+		},
+	}
+
+	if err := RunInstances(t.Context(), cfg, src, dst, global, -1, true, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := global["nested"].(map[string]any)["v"]; got != "{{ .name }}" {
+		t.Errorf("global context was mutated: %v", got)
+	}
+	for _, app := range []string{"app1", "app2", "app3"} {
+		assertFileContent(t, filepath.Join(dst, "one", app, "data.txt"), "one")
+		assertFileContent(t, filepath.Join(dst, "two", app, "data.txt"), "two")
+	}
+}
+
+func TestRunPipeline_GitSourceWritesBackCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not in PATH")
+	}
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "repo.git")
+	work := filepath.Join(root, "work")
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git(root, "init", "-q", "--bare", "-b", "main", bare)
+	git(root, "init", "-q", "-b", "main", work)
+	mkdirAll(t, filepath.Join(work, "deploy"))
+	writeTestFile(t, filepath.Join(work, "deploy", "app.txt"), "Hello {{ .name }}")
+	git(work, "add", ".")
+	git(work, "commit", "-q", "-m", "init")
+	commit := git(work, "rev-parse", "HEAD")
+	git(work, "push", "-q", bare, "main")
+
+	src := t.TempDir()
+	pipelineFile := filepath.Join(src, ".many.yaml")
+	writeTestFile(t, pipelineFile, `pipeline:
+  - name: render
+    type: template
+    source:
+      git: "file://`+bare+`"
+      ref: main
+      subdir: deploy
+    template:
+      files:
+        include: ["*.txt"]
+`)
+	pipeline, err := api.LoadPipeline(t.Context(), pipelineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	if err := RunPipeline(t.Context(), pipeline, map[string]any{"name": "git"}, workDir, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(workDir, "app.txt"), "Hello git")
+	data, err := os.ReadFile(pipelineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `commit: "`+commit+`"`) {
+		t.Errorf("expected commit to be written back, got:\n%s", data)
+	}
+}
+
+func TestRunPipeline_OCISourceWritesBackDigest(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	content := "Hello {{ .name }}"
+	if err := tw.WriteHeader(&tar.Header{Name: "app.txt", Mode: 0o644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/manifests:v1"
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(parsed, img); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	pipelineFile := filepath.Join(src, ".many.yaml")
+	writeTestFile(t, pipelineFile, `pipeline:
+  - name: render
+    type: template
+    source:
+      oci: `+ref+`
+    template:
+      files:
+        include: ["*.txt"]
+`)
+	pipeline, err := api.LoadPipeline(t.Context(), pipelineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	if err := RunPipeline(t.Context(), pipeline, map[string]any{"name": "oci"}, workDir, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(workDir, "app.txt"), "Hello oci")
+	data, err := os.ReadFile(pipelineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `digest: "`+digest.String()+`"`) {
+		t.Errorf("expected digest to be written back, got:\n%s", data)
+	}
+}
+
+func TestRunPipeline_HTTPSSourceArchiveOverride(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("bundle/app.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("Hello {{ .name }}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	pipeline := &api.Pipeline{
+		Dir: t.TempDir(),
+		Pipeline: []api.StepConfig{
+			{
+				Name:     "render",
+				Type:     api.StepTypeTemplate,
+				Source:   api.Sources{{HTTPS: srv.URL + "/download?format=zip", Archive: api.ArchiveZip}},
+				Template: &api.TemplateConfig{Files: api.FileFilter{Include: []string{"*.txt"}}},
+			},
+		},
+	}
+
+	workDir := t.TempDir()
+	if err := RunPipeline(t.Context(), pipeline, map[string]any{"name": "zip"}, workDir, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(workDir, "app.txt"), "Hello zip")
+}
+
+func TestRunPipeline_SourceTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	pipeline := &api.Pipeline{
+		Dir: t.TempDir(),
+		Pipeline: []api.StepConfig{
+			{
+				Name:     "render",
+				Type:     api.StepTypeTemplate,
+				Source:   api.Sources{{HTTPS: srv.URL + "/app.txt", Timeout: "50ms"}},
+				Template: &api.TemplateConfig{},
+			},
+		},
+	}
+
+	err := RunPipeline(t.Context(), pipeline, nil, t.TempDir(), false)
+	if err == nil || !strings.Contains(err.Error(), "timed out") || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected source timeout, got %v", err)
+	}
+}
+
+func TestRunPipeline_CancelledBeforeStep(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestFile(t, filepath.Join(sourceDir, "app.txt"), "{{ .name }}")
+
+	pipeline := &api.Pipeline{
+		Dir: sourceDir,
+		Pipeline: []api.StepConfig{
+			{Name: "render", Type: api.StepTypeTemplate, Source: api.Sources{{File: "."}}, Template: &api.TemplateConfig{}},
+		},
+	}
+
+	ctx, cancel := context.WithCancelCause(t.Context())
+	cancel(errors.New("received interrupt"))
+
+	workDir := t.TempDir()
+	err := RunPipeline(ctx, pipeline, map[string]any{"name": "x"}, workDir, false)
+	if err == nil || !strings.Contains(err.Error(), `step "render": received interrupt`) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	assertNotExists(t, filepath.Join(workDir, "app.txt"))
+}
+
+func TestRunAll_PrunesFilesNoLongerProduced(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "output")
+
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), `
+pipeline:
+  - name: render
+    type: template
+    source:
+      file: "."
+    template:
+      files:
+        include: ["*.txt"]
+`)
+	writeTestFile(t, filepath.Join(src, "keep.txt"), "keep")
+	writeTestFile(t, filepath.Join(src, "old.txt"), "old")
+
+	if err := RunAll(t.Context(), src, dst, nil, -1, false, 0); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dst, "old.txt"), "old")
+	writeTestFile(t, filepath.Join(dst, "unowned.txt"), "mine")
+
+	if err := os.Remove(filepath.Join(src, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunAll(t.Context(), src, dst, nil, -1, false, 0); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dst, "keep.txt"), "keep")
+	assertNotExists(t, filepath.Join(dst, "old.txt"))
+	assertFileContent(t, filepath.Join(dst, "unowned.txt"), "mine")
+}
+
+func TestRunPipeline_PipelineSourceResolvedBeforeFirstStep(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestFile(t, filepath.Join(sourceDir, "base.yaml"), "name: {{ .name }}")
+
+	workDir := t.TempDir()
+
+	pipeline := &api.Pipeline{
+		Dir:     sourceDir,
+		Context: map[string]any{"name": "test-value"},
+		Source:  api.Sources{{File: "."}},
+		Pipeline: []api.StepConfig{
+			{
+				Name:     "render",
+				Type:     api.StepTypeTemplate,
+				Template: &api.TemplateConfig{Files: api.FileFilter{Include: []string{"*.yaml"}}},
+			},
+		},
+	}
+
+	if err := RunPipeline(t.Context(), pipeline, nil, workDir, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(workDir, "base.yaml"), "name: test-value")
+}
+
+func TestRunPipeline_PipelineSourceError(t *testing.T) {
+	pipeline := &api.Pipeline{
+		Dir:    t.TempDir(),
+		Source: api.Sources{{File: "missing"}},
+		Pipeline: []api.StepConfig{
+			{Name: "render", Type: api.StepTypeTemplate, Template: &api.TemplateConfig{}},
+		},
+	}
+
+	err := RunPipeline(t.Context(), pipeline, nil, t.TempDir(), false)
+	if err == nil || !strings.Contains(err.Error(), "resolving pipeline sources") {
+		t.Fatalf("expected pipeline source error, got %v", err)
+	}
+}
+
+func TestRunPipeline_WhenSkipsStep(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestFile(t, filepath.Join(sourceDir, "base.yaml"), "name: {{ .name }}")
+
+	workDir := t.TempDir()
+
+	pipeline := &api.Pipeline{
+		Dir:     sourceDir,
+		Context: map[string]any{"name": "svc", "eso": map[string]any{"enabled": false}},
+		Source:  api.Sources{{File: "."}},
+		Pipeline: []api.StepConfig{
+			{
+				Name:     "render",
+				Type:     api.StepTypeTemplate,
+				Template: &api.TemplateConfig{Files: api.FileFilter{Include: []string{"*.yaml"}}},
+			},
+			{
+				Name:     "external-secret",
+				Type:     api.StepTypeGenerate,
+				When:     ".eso.enabled",
+				Generate: &api.GenerateConfig{Output: "external-secret.yaml", Template: "kind: ExternalSecret"},
+			},
+			{
+				Name:     "prod-only",
+				Type:     api.StepTypeGenerate,
+				When:     `eq .name "svc"`,
+				Generate: &api.GenerateConfig{Output: "prod.yaml", Template: "name: {{ .name }}"},
+			},
+		},
+	}
+
+	if err := RunPipeline(t.Context(), pipeline, nil, workDir, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(workDir, "base.yaml"), "name: svc")
+	assertFileContent(t, filepath.Join(workDir, "prod.yaml"), "name: svc")
+	if _, err := os.Stat(filepath.Join(workDir, "external-secret.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected skipped step to produce no output, stat error: %v", err)
+	}
+}
+
+func TestRunPipeline_WhenEvaluationError(t *testing.T) {
+	pipeline := &api.Pipeline{
+		Dir: t.TempDir(),
+		Pipeline: []api.StepConfig{
+			{
+				Name:     "gen",
+				Type:     api.StepTypeGenerate,
+				When:     `fail "unsupported environment"`,
+				Generate: &api.GenerateConfig{Output: "out.yaml", Template: "x"},
+			},
+		},
+	}
+
+	err := RunPipeline(t.Context(), pipeline, nil, t.TempDir(), false)
+	if err == nil || !strings.Contains(err.Error(), "unsupported environment") {
+		t.Fatalf("expected when evaluation error, got %v", err)
+	}
+}
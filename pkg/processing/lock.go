@@ -0,0 +1,254 @@
+package processing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/systemstart/many-templates/pkg/api"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+// ErrLockMismatch is returned in locked mode for a source that is missing
+// from many.lock or resolved to different content than recorded there.
+var ErrLockMismatch = errors.New("source does not match " + api.LockFileName)
+
+// lockSession checks resolved sources against a lock, or records them.
+type lockSession struct {
+	root   string // absolute input directory; file source keys are relative to it
+	lock   *api.Lock
+	strict bool // fail on missing or differing sources instead of warning
+	record bool // record every source instead of checking it
+
+	mu sync.Mutex
+}
+
+var (
+	lockMu     sync.RWMutex
+	activeLock *lockSession
+)
+
+func setLockSession(s *lockSession) {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	activeLock = s
+}
+
+func currentLockSession() *lockSession {
+	lockMu.RLock()
+	defer lockMu.RUnlock()
+	return activeLock
+}
+
+// UseLock checks every source resolved from now on against inputDir/many.lock.
+// When locked is set the lock file must exist, and a source missing from it
+// or resolving to different content fails its pipeline. Otherwise differences
+// are only logged, and a missing lock file disables checking.
+func UseLock(inputDir string, locked bool) error {
+	root, err := filepath.Abs(inputDir)
+	if err != nil {
+		return fmt.Errorf("resolving input directory: %w", err)
+	}
+	path := filepath.Join(root, api.LockFileName)
+
+	lock, err := api.LoadLock(path)
+	if err != nil {
+		if !locked && errors.Is(err, fs.ErrNotExist) {
+			setLockSession(nil)
+			return nil
+		}
+		return err //nolint:wrapcheck // already wrapped by api
+	}
+	setLockSession(&lockSession{root: root, lock: lock, strict: locked})
+	slog.Debug("checking sources against lock file", "file", path, "sources", len(lock.Sources), "locked", locked)
+	return nil
+}
+
+// UpdateLock resolves every source of every pipeline discovered in inputDir,
+// including file sources, and rewrites inputDir/many.lock with the result.
+// Nothing is written if any source fails. It returns the number of sources
+// recorded.
+func UpdateLock(ctx context.Context, inputDir string, maxDepth int) (int, error) {
+	root, err := filepath.Abs(inputDir)
+	if err != nil {
+		return 0, fmt.Errorf("resolving input directory: %w", err)
+	}
+
+	session := &lockSession{root: root, lock: api.NewLock(), record: true}
+	setLockSession(session)
+	defer setLockSession(nil)
+
+	if _, err := resolveEverySource(ctx, root, maxDepth, true); err != nil {
+		return 0, err
+	}
+	if err := session.lock.Save(filepath.Join(root, api.LockFileName)); err != nil {
+		return 0, err //nolint:wrapcheck // already wrapped by api
+	}
+	return len(session.lock.Sources), nil
+}
+
+// checkLock compares a resolved source with the active lock, or records it.
+func checkLock(entry api.SourceEntry, uri, path, computed string) error {
+	s := currentLockSession()
+	if s == nil {
+		return nil
+	}
+	key := lockKey(entry, uri, s.root)
+	if key == "" {
+		return nil
+	}
+	digest, err := contentDigest(path)
+	if err != nil {
+		return fmt.Errorf("computing content digest: %w", err)
+	}
+	return s.check(key, api.LockEntry{Digest: digest, Resolved: computed})
+}
+
+func (s *lockSession) check(key string, got api.LockEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.record {
+		s.lock.Sources[key] = got
+		return nil
+	}
+
+	var err error
+	want, ok := s.lock.Sources[key]
+	switch {
+	case !ok:
+		err = fmt.Errorf("%w: %s is not recorded (run many lock update)", ErrLockMismatch, key)
+	case want.Resolved != "" && got.Resolved != "" && want.Resolved != got.Resolved:
+		err = fmt.Errorf("%w: %s resolved to %s, locked %s", ErrLockMismatch, key, got.Resolved, want.Resolved)
+	case want.Digest != got.Digest:
+		err = fmt.Errorf("%w: %s has digest %s, locked %s", ErrLockMismatch, key, got.Digest, want.Digest)
+	default:
+		return nil
+	}
+	if s.strict {
+		return err
+	}
+	slog.Warn("source differs from lock file", "error", err)
+	return nil
+}
+
+// lockKey identifies a source in the lock file by what the pipeline asks for,
+// not by the pins written back to it: the scheme URI with the fields that
+// select a version (Git ref, Helm repo and version, HTTPS archive format, OCM
+// recursion). File sources are keyed by their path relative to root; those
+// outside it are not recorded. Passwords in URLs are redacted.
+func lockKey(entry api.SourceEntry, uri, root string) string {
+	var key string
+	switch {
+	case entry.File != "":
+		rel, err := filepath.Rel(root, uri)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return ""
+		}
+		return "file:" + filepath.ToSlash(rel)
+	case entry.Helm != "":
+		key = "helm://" + entry.Helm + "?repo=" + entry.Repo
+		if entry.Version != "" {
+			key += "&version=" + entry.Version
+		}
+	case entry.Git != "":
+		key = "git+" + entry.Git
+		if entry.Ref != "" {
+			key += "#" + entry.Ref
+		}
+	case entry.HTTPS != "":
+		key = entry.HTTPS
+		if entry.Archive != "" && entry.Archive != api.ArchiveAuto {
+			key += "#archive=" + entry.Archive
+		}
+	case entry.OCM != "" && entry.Recursive:
+		key = "ocm://" + entry.OCM + "?recursive"
+	default:
+		key = entry.URI()
+	}
+	return resolve.RedactURL(key)
+}
+
+// contentDigest hashes a resolved source: a single file by its content, a
+// directory by the path, executable bit and content hash of every file below
+// it. Pipeline and lock files are skipped, since write-back and lock updates
+// change them without changing what the source provides.
+func contentDigest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("stat %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return "", err
+		}
+		return "sha256:" + sum, nil
+	}
+
+	h := sha256.New()
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error at %s: %w", p, err)
+		}
+		if d.IsDir() || d.Name() == configFilename || d.Name() == api.LockFileName {
+			return nil
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return fmt.Errorf("computing relative path for %s: %w", p, err)
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return fmt.Errorf("reading link %s: %w", p, err)
+			}
+			_, _ = fmt.Fprintf(h, "%s\x00link\x00%s\n", rel, filepath.ToSlash(target))
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", p, err)
+		}
+		kind := "file"
+		if info.Mode()&0o111 != 0 {
+			kind = "exec"
+		}
+		sum, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(h, "%s\x00%s\x00%s\n", rel, kind, sum)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
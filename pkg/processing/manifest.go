@@ -0,0 +1,261 @@
+package processing
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestFileName is the ownership record written to the root of every output
+// directory. It lists the files produced by the last successful run, so that a
+// later run can delete the ones it no longer produces without touching files
+// that many never wrote.
+const ManifestFileName = ".many-manifest"
+
+const manifestHeader = "# Files written by many. Do not edit; stale entries are pruned on the next run.\n"
+
+// ReadManifest returns the set of slash-separated paths recorded in dir's
+// manifest. A missing manifest yields an empty set. Entries that are not local
+// paths are ignored so a tampered manifest cannot delete outside dir.
+func ReadManifest(dir string) (map[string]bool, error) {
+	owned := make(map[string]bool)
+
+	f, err := os.Open(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return owned, nil
+		}
+		return nil, fmt.Errorf("opening manifest: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(line)) {
+			slog.Warn("ignoring non-local manifest entry", "entry", line)
+			continue
+		}
+		owned[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	return owned, nil
+}
+
+// writeManifest atomically replaces dir's manifest with files.
+func writeManifest(dir string, files []string) error {
+	var b strings.Builder
+	b.WriteString(manifestHeader)
+	for _, f := range files {
+		b.WriteString(f)
+		b.WriteByte('\n')
+	}
+
+	tmp := filepath.Join(dir, ManifestFileName+".tmp")
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, ManifestFileName)); err != nil {
+		return fmt.Errorf("committing manifest: %w", err)
+	}
+	return nil
+}
+
+// listOutputFiles returns the sorted, slash-separated paths of all files under
+// root, excluding a top-level manifest.
+func listOutputFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error at %s: %w", path, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, relErr := filepath.Rel(root, path)
+		if relErr != nil {
+			return fmt.Errorf("computing relative path for %s: %w", path, relErr)
+		}
+		if rel != ManifestFileName {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing output files: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ownedOrProduced returns the sorted union of owned and produced.
+func ownedOrProduced(owned map[string]bool, produced []string) []string {
+	files := make([]string, 0, len(owned)+len(produced))
+	for f := range owned {
+		files = append(files, f)
+	}
+	for _, f := range produced {
+		if !owned[f] {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// checkReplacements reports the first entry of src that would replace a file
+// or directory in dst that many does not own. rel is the slash-separated path
+// of dst relative to the directory owned describes. A staged file may replace
+// a directory, and a staged directory a file, only if everything replaced is
+// listed in owned, the previous manifest of dst.
+func checkReplacements(src, dst, rel string, owned map[string]bool) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", src, err)
+	}
+
+	for _, e := range entries {
+		to := filepath.Join(dst, e.Name())
+		toRel := path.Join(rel, e.Name())
+
+		info, statErr := os.Lstat(to)
+		switch {
+		case os.IsNotExist(statErr):
+		case statErr != nil:
+			return fmt.Errorf("stat %s: %w", to, statErr)
+		case e.IsDir() && info.IsDir():
+			if err := checkReplacements(filepath.Join(src, e.Name()), to, toRel, owned); err != nil {
+				return err
+			}
+		case info.IsDir():
+			unowned, err := firstUnowned(to, toRel, owned)
+			if err != nil {
+				return err
+			}
+			if unowned != "" {
+				return fmt.Errorf("promoting %s: a file replaces a directory holding %s, which was not written by many", to, unowned)
+			}
+		case e.IsDir() && !owned[toRel]:
+			return fmt.Errorf("promoting %s: a directory replaces a file that was not written by many", to)
+		}
+	}
+	return nil
+}
+
+// firstUnowned returns the path of the first file below dir, relative to the
+// directory owned describes, that is not listed in owned, or "" if there is
+// none.
+func firstUnowned(dir, rel string, owned map[string]bool) (string, error) {
+	var unowned string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error at %s: %w", p, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		sub, relErr := filepath.Rel(dir, p)
+		if relErr != nil {
+			return fmt.Errorf("computing relative path for %s: %w", p, relErr)
+		}
+		if r := path.Join(rel, filepath.ToSlash(sub)); !owned[r] {
+			unowned = r
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("listing %s: %w", dir, err)
+	}
+	return unowned, nil
+}
+
+// moveEntries moves every entry of src into dst, replacing what is already
+// there; the replacements must have been checked with checkReplacements.
+// Directories missing in dst are moved in a single rename; existing ones are
+// merged recursively so unrelated files in dst survive. Each file replacement
+// is an atomic rename, but the move as a whole is not.
+func moveEntries(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", src, err)
+	}
+
+	for _, e := range entries {
+		from := filepath.Join(src, e.Name())
+		to := filepath.Join(dst, e.Name())
+
+		info, statErr := os.Lstat(to)
+		switch {
+		case os.IsNotExist(statErr):
+		case statErr != nil:
+			return fmt.Errorf("stat %s: %w", to, statErr)
+		case e.IsDir() && info.IsDir():
+			if err := moveEntries(from, to); err != nil {
+				return err
+			}
+			continue
+		case info.IsDir():
+			// A file replaces a directory of owned files.
+			if err := os.RemoveAll(to); err != nil {
+				return fmt.Errorf("removing %s: %w", to, err)
+			}
+		case e.IsDir():
+			// A directory replaces an owned file, which rename cannot do.
+			if err := os.Remove(to); err != nil {
+				return fmt.Errorf("removing %s: %w", to, err)
+			}
+		}
+
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("promoting %s: %w", to, err)
+		}
+	}
+	return nil
+}
+
+// pruneStale deletes files listed in owned that are not in produced, along
+// with any directories left empty by the deletion.
+func pruneStale(targetDir string, owned map[string]bool, produced []string) {
+	keep := make(map[string]bool, len(produced))
+	for _, f := range produced {
+		keep[f] = true
+	}
+
+	for rel := range owned {
+		if keep[rel] {
+			continue
+		}
+		path := filepath.Join(targetDir, filepath.FromSlash(rel))
+		if err := os.Remove(path); err != nil {
+			if !os.IsNotExist(err) {
+				slog.Warn("failed to remove stale output file", "path", path, "error", err)
+			}
+			continue
+		}
+		slog.Info("removed stale output file", "path", path)
+		removeEmptyParents(targetDir, filepath.Dir(path))
+	}
+}
+
+// removeEmptyParents removes dir and its ancestors up to (excluding) root for
+// as long as they are empty.
+func removeEmptyParents(root, dir string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return // not empty, or already gone
+		}
+		dir = filepath.Dir(dir)
+	}
+}
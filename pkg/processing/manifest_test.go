@@ -0,0 +1,211 @@
+package processing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPromoteStaging_PrunesStaleOwnedFiles(t *testing.T) {
+	target := t.TempDir()
+	writeNestedFile(t, filepath.Join(target, "manifests", "deployment-old.yaml"), "old")
+	writeNestedFile(t, filepath.Join(target, "manifests", "service.yaml"), "old service")
+	writeNestedFile(t, filepath.Join(target, "gone", "only.yaml"), "old")
+	writeNestedFile(t, filepath.Join(target, "README.md"), "hand-written")
+	if err := writeManifest(target, []string{"gone/only.yaml", "manifests/deployment-old.yaml", "manifests/service.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	staging := filepath.Join(target, stagingDirName)
+	writeNestedFile(t, filepath.Join(staging, "manifests", "service.yaml"), "new service")
+	writeNestedFile(t, filepath.Join(staging, "manifests", "deployment.yaml"), "new")
+
+	if err := promoteStaging(staging, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(target, "manifests", "service.yaml"), "new service")
+	assertFileContent(t, filepath.Join(target, "manifests", "deployment.yaml"), "new")
+	assertFileContent(t, filepath.Join(target, "README.md"), "hand-written")
+	assertNotExists(t, filepath.Join(target, "manifests", "deployment-old.yaml"))
+	assertNotExists(t, filepath.Join(target, "gone"))
+	assertNotExists(t, staging)
+
+	owned, err := ReadManifest(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned) != 2 || !owned["manifests/service.yaml"] || !owned["manifests/deployment.yaml"] {
+		t.Errorf("unexpected manifest: %v", owned)
+	}
+}
+
+func TestPromoteStaging_WithoutManifestKeepsExistingFiles(t *testing.T) {
+	target := t.TempDir()
+	writeNestedFile(t, filepath.Join(target, "sub", "legacy.yaml"), "legacy")
+
+	staging := filepath.Join(target, stagingDirName)
+	writeNestedFile(t, filepath.Join(staging, "sub", "new.yaml"), "new")
+
+	if err := promoteStaging(staging, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(target, "sub", "legacy.yaml"), "legacy")
+	assertFileContent(t, filepath.Join(target, "sub", "new.yaml"), "new")
+}
+
+func TestPromoteStaging_FileReplacesDirectory(t *testing.T) {
+	target := t.TempDir()
+	writeNestedFile(t, filepath.Join(target, "app", "x.yaml"), "x")
+	if err := writeManifest(target, []string{"app/x.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	staging := filepath.Join(target, stagingDirName)
+	writeNestedFile(t, filepath.Join(staging, "app"), "now a file")
+
+	if err := promoteStaging(staging, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(target, "app"), "now a file")
+}
+
+func TestPromoteStaging_FileDoesNotReplaceUnownedDirectory(t *testing.T) {
+	target := t.TempDir()
+	writeNestedFile(t, filepath.Join(target, "app", "x.yaml"), "x")
+	writeNestedFile(t, filepath.Join(target, "app", "notes.md"), "hand-written")
+	if err := writeManifest(target, []string{"app/x.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	staging := filepath.Join(target, stagingDirName)
+	writeNestedFile(t, filepath.Join(staging, "a.yaml"), "new")
+	writeNestedFile(t, filepath.Join(staging, "app"), "now a file")
+
+	err := promoteStaging(staging, target)
+	if err == nil || !strings.Contains(err.Error(), "app/notes.md, which was not written by many") {
+		t.Fatalf("expected the unowned file to be reported, got %v", err)
+	}
+	assertFileContent(t, filepath.Join(target, "app", "notes.md"), "hand-written")
+	assertFileContent(t, filepath.Join(target, "app", "x.yaml"), "x")
+	assertNotExists(t, filepath.Join(target, "a.yaml"))
+}
+
+func TestPromoteStaging_DirectoryReplacesFile(t *testing.T) {
+	target := t.TempDir()
+	writeNestedFile(t, filepath.Join(target, "app"), "a file")
+	if err := writeManifest(target, []string{"app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	staging := filepath.Join(target, stagingDirName)
+	writeNestedFile(t, filepath.Join(staging, "app", "x.yaml"), "x")
+
+	if err := promoteStaging(staging, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(target, "app", "x.yaml"), "x")
+}
+
+func TestPromoteStaging_DirectoryDoesNotReplaceUnownedFile(t *testing.T) {
+	target := t.TempDir()
+	writeNestedFile(t, filepath.Join(target, "app"), "hand-written")
+
+	staging := filepath.Join(target, stagingDirName)
+	writeNestedFile(t, filepath.Join(staging, "app", "x.yaml"), "x")
+
+	err := promoteStaging(staging, target)
+	if err == nil || !strings.Contains(err.Error(), "a directory replaces a file that was not written by many") {
+		t.Fatalf("expected the unowned file to be reported, got %v", err)
+	}
+	assertFileContent(t, filepath.Join(target, "app"), "hand-written")
+	assertNotExists(t, filepath.Join(target, ManifestFileName))
+}
+
+func TestPromoteStaging_RecoversInterruptedPromotion(t *testing.T) {
+	target := t.TempDir()
+	staging := filepath.Join(target, stagingDirName)
+	writeNestedFile(t, filepath.Join(staging, "a.yaml"), "a1")
+	writeNestedFile(t, filepath.Join(staging, "b.yaml"), "b1")
+	if err := promoteStaging(staging, target); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run, producing a.yaml and c.yaml, is killed after moving
+	// c.yaml into place.
+	owned, err := ReadManifest(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(target, ownedOrProduced(owned, []string{"a.yaml", "c.yaml"})); err != nil {
+		t.Fatal(err)
+	}
+	writeNestedFile(t, filepath.Join(target, "c.yaml"), "c2")
+
+	// The third run only produces a.yaml and removes everything else.
+	writeNestedFile(t, filepath.Join(staging, "a.yaml"), "a3")
+	if err := promoteStaging(staging, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(target, "a.yaml"), "a3")
+	assertNotExists(t, filepath.Join(target, "b.yaml"))
+	assertNotExists(t, filepath.Join(target, "c.yaml"))
+	if owned, err := ReadManifest(target); err != nil || len(owned) != 1 || !owned["a.yaml"] {
+		t.Errorf("unexpected manifest: %v (%v)", owned, err)
+	}
+}
+
+func TestReadManifest_IgnoresNonLocalEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeNestedFile(t, filepath.Join(dir, ManifestFileName), "# comment\n\na.yaml\n../escape.yaml\n/abs.yaml\n")
+
+	owned, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned) != 1 || !owned["a.yaml"] {
+		t.Errorf("expected only a.yaml, got %v", owned)
+	}
+}
+
+func TestReadManifest_Missing(t *testing.T) {
+	owned, err := ReadManifest(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned) != 0 {
+		t.Errorf("expected empty set, got %v", owned)
+	}
+}
+
+func TestWriteManifest_Sorted(t *testing.T) {
+	dir := t.TempDir()
+	staging := filepath.Join(dir, "staging")
+	writeNestedFile(t, filepath.Join(staging, "b.yaml"), "")
+	writeNestedFile(t, filepath.Join(staging, "a", "c.yaml"), "")
+	writeNestedFile(t, filepath.Join(staging, ManifestFileName), "ignored")
+
+	files, err := listOutputFiles(staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(dir, files); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "a/c.yaml\nb.yaml\n") {
+		t.Errorf("unexpected manifest content:\n%s", data)
+	}
+}
+
+func writeNestedFile(t *testing.T, path, content string) {
+	t.Helper()
+	mkdirAll(t, filepath.Dir(path))
+	writeTestFile(t, path, content)
+}
@@ -0,0 +1,106 @@
+package processing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isYAMLFile reports whether path has a .yaml or .yml extension.
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// mergeYAML deep-merges the YAML documents in overlay into those in base and
+// returns the encoded result. Documents are paired by position; extra overlay
+// documents are appended. Within a document, mappings are merged key by key,
+// keeping the key order of base, while scalars and sequences from overlay
+// replace those in base.
+func mergeYAML(base, overlay []byte) ([]byte, error) {
+	baseDocs, err := decodeYAMLDocs(base)
+	if err != nil {
+		return nil, fmt.Errorf("parsing existing file: %w", err)
+	}
+	overlayDocs, err := decodeYAMLDocs(overlay)
+	if err != nil {
+		return nil, fmt.Errorf("parsing source file: %w", err)
+	}
+
+	for i, doc := range overlayDocs {
+		if i < len(baseDocs) {
+			baseDocs[i] = mergeNodes(baseDocs[i], doc)
+		} else {
+			baseDocs = append(baseDocs, doc)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range baseDocs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("encoding merged YAML: %w", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding merged YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeYAMLDocs parses every document in data. Empty documents are dropped.
+func decodeYAMLDocs(data []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding YAML: %w", err)
+		}
+		if len(doc.Content) > 0 {
+			docs = append(docs, &doc)
+		}
+	}
+}
+
+// mergeNodes merges overlay into base and returns the result. Only mappings
+// are merged; any other overlay node replaces base.
+func mergeNodes(base, overlay *yaml.Node) *yaml.Node {
+	if base.Kind == yaml.DocumentNode && overlay.Kind == yaml.DocumentNode {
+		base.Content[0] = mergeNodes(base.Content[0], overlay.Content[0])
+		return base
+	}
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		if j := mappingIndex(base, key.Value); j >= 0 {
+			base.Content[j+1] = mergeNodes(base.Content[j+1], value)
+		} else {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+	return base
+}
+
+// mappingIndex returns the index of key in the mapping node m, or -1.
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,86 @@
+package processing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		overlay string
+		want    string
+	}{
+		{
+			name:    "nested maps",
+			base:    "a: 1\nb:\n  c: 2\n  d: 3\n",
+			overlay: "b:\n  d: 4\n  e: 5\nf: 6\n",
+			want:    "a: 1\nb:\n  c: 2\n  d: 4\n  e: 5\nf: 6\n",
+		},
+		{
+			name:    "sequences are replaced",
+			base:    "items:\n  - a\n  - b\n",
+			overlay: "items:\n  - c\n",
+			want:    "items:\n  - c\n",
+		},
+		{
+			name:    "scalar replaces map",
+			base:    "a:\n  b: 1\n",
+			overlay: "a: off\n",
+			want:    "a: off\n",
+		},
+		{
+			name:    "documents by position",
+			base:    "kind: A\nx: 1\n---\nkind: B\n",
+			overlay: "x: 2\n---\ny: 3\n---\nkind: C\n",
+			want:    "kind: A\nx: 2\n---\nkind: B\ny: 3\n---\nkind: C\n",
+		},
+		{
+			name:    "empty overlay",
+			base:    "a: 1\n",
+			overlay: "",
+			want:    "a: 1\n",
+		},
+		{
+			name:    "comments are kept",
+			base:    "# base\na: 1 # one\n",
+			overlay: "b: 2\n",
+			want:    "# base\na: 1 # one\nb: 2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeYAML([]byte(tt.base), []byte(tt.overlay))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeYAML_InvalidInput(t *testing.T) {
+	if _, err := mergeYAML([]byte("a: [\n"), []byte("b: 1\n")); err == nil || !strings.Contains(err.Error(), "parsing existing file") {
+		t.Errorf("expected existing file parse error, got %v", err)
+	}
+	if _, err := mergeYAML([]byte("a: 1\n"), []byte("b: [\n")); err == nil || !strings.Contains(err.Error(), "parsing source file") {
+		t.Errorf("expected source file parse error, got %v", err)
+	}
+}
+
+func TestIsYAMLFile(t *testing.T) {
+	for path, want := range map[string]bool{
+		"a.yaml":       true,
+		"dir/b.YML":    true,
+		"c.json":       false,
+		"yaml":         false,
+		"values.yaml~": false,
+	} {
+		if got := isYAMLFile(path); got != want {
+			t.Errorf("isYAMLFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package processing
+
+import (
+	"runtime"
+	"sync"
+)
+
+// limiter bounds the number of pipelines executing at the same time.
+type limiter chan struct{}
+
+// newLimiter returns a limiter allowing n concurrent holders.
+// Values below 1 default to GOMAXPROCS.
+func newLimiter(n int) limiter {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return make(limiter, n)
+}
+
+func (l limiter) acquire() { l <- struct{}{} }
+
+func (l limiter) release() { <-l }
+
+// forEach calls fn for every index in [0, n) concurrently and returns the
+// resulting errors in index order. Callers bound the actual work with a limiter.
+func forEach(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() { errs[i] = fn(i) })
+	}
+	wg.Wait()
+	return errs
+}
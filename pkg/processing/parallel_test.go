@@ -0,0 +1,58 @@
+package processing
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewLimiter_DefaultsToGOMAXPROCS(t *testing.T) {
+	if got := cap(newLimiter(0)); got < 1 {
+		t.Errorf("expected positive capacity, got %d", got)
+	}
+	if got := cap(newLimiter(3)); got != 3 {
+		t.Errorf("expected capacity 3, got %d", got)
+	}
+}
+
+func TestForEach_ErrorsInIndexOrder(t *testing.T) {
+	errs := forEach(4, func(i int) error {
+		if i%2 == 1 {
+			return errors.New("odd")
+		}
+		return nil
+	})
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(errs))
+	}
+	for i, err := range errs {
+		if (err != nil) != (i%2 == 1) {
+			t.Errorf("index %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestLimiter_BoundsConcurrency(t *testing.T) {
+	lim := newLimiter(2)
+	var running, peak atomic.Int32
+
+	forEach(8, func(int) error {
+		lim.acquire()
+		defer lim.release()
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	})
+
+	if got := peak.Load(); got > 2 {
+		t.Errorf("expected at most 2 concurrent calls, got %d", got)
+	}
+}
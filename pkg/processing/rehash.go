@@ -0,0 +1,118 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/systemstart/many-templates/pkg/api"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+// RehashOptions selects the sources RehashSources checks and whether it
+// rewrites them.
+type RehashOptions struct {
+	InputDir       string
+	MaxDepth       int
+	OnlyMismatched bool // skip sources without a sha256, and omit matching ones from the result
+	Check          bool // report only, do not modify pipeline files
+}
+
+// Rehash is the outcome of downloading one HTTPS source again.
+type Rehash struct {
+	File string // pipeline file, below the input directory as given
+	URL  string
+	Old  string // recorded sha256, "" if none
+	New  string // sha256 of the download
+}
+
+// Changed reports whether the recorded sha256 is missing or differs from the
+// download.
+func (r Rehash) Changed() bool {
+	return r.Old != r.New
+}
+
+// RehashSources downloads every HTTPS source of every pipeline discovered in
+// opts.InputDir, bypassing the cache, and compares it with its recorded
+// sha256. Missing and differing checksums are written back to the pipeline
+// files unless opts.Check is set. It returns one result per source and file,
+// along with the errors of sources that could not be downloaded.
+func RehashSources(ctx context.Context, opts RehashOptions) ([]Rehash, error) {
+	absRoot, err := filepath.Abs(opts.InputDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving input directory: %w", err)
+	}
+	pipelines, err := DiscoverPipelines(ctx, absRoot, opts.MaxDepth)
+	if err != nil {
+		return nil, fmt.Errorf("discovering pipelines: %w", err)
+	}
+
+	hashes := make(map[string]string) // URL -> sha256, each downloaded once
+	var results []Rehash
+	var errs []error
+	for _, p := range pipelines {
+		file := displayPath(opts.InputDir, absRoot, p.FilePath)
+		seen := make(map[string]bool)
+		updates := make(map[string]string)
+		rehash := func(entry api.SourceEntry, where string) {
+			if entry.HTTPS == "" || (opts.OnlyMismatched && entry.SHA256 == "") || seen[entry.HTTPS] {
+				return
+			}
+			seen[entry.HTTPS] = true
+			sum, ok := hashes[entry.HTTPS]
+			if !ok {
+				var err error
+				if sum, err = hashSource(ctx, entry); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", where, err))
+					return
+				}
+				hashes[entry.HTTPS] = sum
+			}
+
+			r := Rehash{File: file, URL: entry.HTTPS, Old: entry.SHA256, New: sum}
+			if r.Changed() {
+				updates[entry.HTTPS] = sum
+			}
+			if r.Changed() || !opts.OnlyMismatched {
+				results = append(results, r)
+			}
+		}
+		for i, entry := range p.Source {
+			rehash(entry, fmt.Sprintf("%s: pipeline: source[%d]", file, i))
+		}
+		for _, step := range p.Pipeline {
+			for i, entry := range step.Source {
+				rehash(entry, fmt.Sprintf("%s: step %q: source[%d]", file, step.Name, i))
+			}
+		}
+		if opts.Check {
+			continue
+		}
+		for _, file := range p.Files() {
+			if err := api.UpdateSourceSHA256(file, updates); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// hashSource downloads an HTTPS source within its timeout and returns its
+// sha256.
+func hashSource(ctx context.Context, entry api.SourceEntry) (string, error) {
+	timeout, err := entry.TimeoutDuration()
+	if err != nil {
+		return "", err //nolint:wrapcheck // already describes the field
+	}
+	rctx, cancel := resolve.WithTimeout(ctx, timeout)
+	defer cancel()
+	sum, err := resolve.HashHTTPS(rctx, entry.HTTPS, entry.Headers)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return "", fmt.Errorf("timed out: %w", err)
+		}
+		return "", err //nolint:wrapcheck // already wrapped by resolve
+	}
+	return sum, nil
+}
@@ -0,0 +1,103 @@
+package processing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// setupRehash writes a pipeline with a stale, a current and a missing sha256
+// and returns the input directory and server URL.
+func setupRehash(t *testing.T) (string, string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), `source:
+  - https: `+srv.URL+`/stale.txt # bumped
+    sha256: "`+strings.Repeat("0", 64)+`"
+  - https: `+srv.URL+`/current.txt
+    sha256: "`+sha256Hex("content of /current.txt")+`"
+pipeline:
+  - name: render
+    type: template
+    source:
+      - https: `+srv.URL+`/missing.txt
+    template: {}
+`)
+	return src, srv.URL
+}
+
+func TestRehashSources(t *testing.T) {
+	src, url := setupRehash(t)
+
+	results, err := RehashSources(t.Context(), RehashOptions{InputDir: src, MaxDepth: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+	changed := 0
+	for _, r := range results {
+		if want := filepath.Join(src, ".many.yaml"); r.File != want {
+			t.Errorf("File = %q, want %q", r.File, want)
+		}
+		if r.Changed() {
+			changed++
+		}
+	}
+	if changed != 2 {
+		t.Errorf("expected 2 changed sources, got %d", changed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(src, ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"stale", "current", "missing"} {
+		if !strings.Contains(string(data), `sha256: "`+sha256Hex("content of /"+name+".txt")+`"`) {
+			t.Errorf("expected sha256 of %s.txt to be written, got:\n%s", name, data)
+		}
+	}
+	if !strings.Contains(string(data), url+"/stale.txt # bumped") {
+		t.Errorf("expected comment to be preserved, got:\n%s", data)
+	}
+}
+
+func TestRehashSources_CheckOnlyMismatched(t *testing.T) {
+	src, url := setupRehash(t)
+	before, err := os.ReadFile(filepath.Join(src, ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := RehashSources(t.Context(), RehashOptions{InputDir: src, MaxDepth: -1, OnlyMismatched: true, Check: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].URL != url+"/stale.txt" || results[0].New != sha256Hex("content of /stale.txt") {
+		t.Fatalf("expected only the stale source, got %+v", results)
+	}
+
+	after, err := os.ReadFile(filepath.Join(src, ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected -check to leave the pipeline file alone, got:\n%s", after)
+	}
+}
@@ -0,0 +1,58 @@
+package processing
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	tempDirsMu sync.Mutex
+	tempDirs   = make(map[string]struct{})
+)
+
+// trackDir registers path for removal by RemoveTempDirs until the returned
+// function is called. The function does not remove path itself.
+func trackDir(path string) func() {
+	tempDirsMu.Lock()
+	tempDirs[path] = struct{}{}
+	tempDirsMu.Unlock()
+
+	return func() {
+		tempDirsMu.Lock()
+		delete(tempDirs, path)
+		tempDirsMu.Unlock()
+	}
+}
+
+// mkdirTemp creates a temp directory like os.MkdirTemp and tracks it until
+// the returned cleanup removes it, so RemoveTempDirs can remove it if the
+// process is interrupted first.
+func mkdirTemp(dir, pattern string) (string, func(), error) {
+	path, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+	untrack := trackDir(path)
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			_ = os.RemoveAll(path)
+			untrack()
+		})
+	}
+	return path, cleanup, nil
+}
+
+// RemoveTempDirs removes the pipeline work directories and staging
+// directories of runs that are still in progress. It is meant to run when the
+// process is interrupted and exits without waiting for those runs.
+func RemoveTempDirs() {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	for path := range tempDirs {
+		_ = os.RemoveAll(path)
+		delete(tempDirs, path)
+	}
+}
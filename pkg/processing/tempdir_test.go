@@ -0,0 +1,86 @@
+package processing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+func TestRemoveTempDirs(t *testing.T) {
+	kept, keptCleanup, err := mkdirTemp(t.TempDir(), "kept-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaked, _, err := mkdirTemp(t.TempDir(), "leaked-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	untracked := t.TempDir()
+	trackDir(untracked)()
+
+	keptCleanup()
+	assertNotExists(t, kept)
+
+	RemoveTempDirs()
+	assertNotExists(t, leaked)
+	if _, err := os.Stat(untracked); err != nil {
+		t.Errorf("RemoveTempDirs removed an untracked directory: %v", err)
+	}
+	keptCleanup() // a second call is a no-op
+}
+
+// TestRunAll_RemoveTempDirsWhileRunning removes the temp directories while a
+// pipeline downloads a source, as a second interrupt does before exiting, and
+// expects nothing of the run to be left behind.
+func TestRunAll_RemoveTempDirsWhileRunning(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "output")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var called bool
+	var left []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		RemoveTempDirs()
+		resolve.RemoveTempDirs()
+		entries, err := os.ReadDir(tmp)
+		if err != nil {
+			t.Error(err)
+		}
+		for _, e := range entries {
+			left = append(left, filepath.Join(tmp, e.Name()))
+		}
+		if _, err := os.Stat(filepath.Join(dst, stagingDirName)); err == nil {
+			left = append(left, filepath.Join(dst, stagingDirName))
+		}
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), `pipeline:
+  - name: render
+    type: template
+    source:
+      https: `+srv.URL+`/app.txt
+    template: {}
+`)
+
+	if err := RunAll(ctx, src, dst, nil, -1, false, 0); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	if !called {
+		t.Fatal("expected the source to be downloaded")
+	}
+	for _, path := range left {
+		t.Errorf("%s was left behind", path)
+	}
+}
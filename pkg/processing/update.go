@@ -0,0 +1,206 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/systemstart/many-templates/pkg/api"
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+// SourceUpdate is a newer version found for a source by UpdateSources.
+type SourceUpdate struct {
+	File string // pipeline file declaring the source
+	From string // Helm chart version, OCI reference or release URL before
+	To   string // and after the update
+}
+
+// sourceBump is the outcome of looking for a newer version of one source.
+type sourceBump struct {
+	from, to string
+	pins     []api.SourcePin // applied in order
+	err      error
+}
+
+// UpdateSources looks for newer versions of the Helm, OCI and GitHub release
+// sources of every pipeline discovered in inputDir and rewrites the pipeline
+// files to use them, with a fresh sha256 or digest where one applies. Helm
+// charts are bumped to the newest version in their repository, OCI references
+// to the newest semver tag, and release downloads to the newest release that
+// has the same asset. Sources without a semantic version are left alone. If
+// name is set, only sources of that name are considered (see
+// matchesSourceName). Updates found are written even if other sources fail;
+// it returns them along with those errors.
+func UpdateSources(ctx context.Context, inputDir string, maxDepth int, name string) ([]SourceUpdate, error) {
+	pipelines, err := DiscoverPipelines(ctx, inputDir, maxDepth)
+	if err != nil {
+		return nil, fmt.Errorf("discovering pipelines: %w", err)
+	}
+
+	bumps := make(map[string]*sourceBump)
+	var updates []SourceUpdate
+	var errs []error
+	for _, p := range pipelines {
+		var pins []api.SourcePin
+		check := func(entry api.SourceEntry, where string) {
+			if !matchesSourceName(entry, name) {
+				return
+			}
+			b := bumpOnce(ctx, entry, bumps)
+			switch {
+			case errors.Is(b.err, resolve.ErrNotSemver):
+				slog.Debug("skipping source without a semantic version", "source", where, "error", b.err)
+			case b.err != nil:
+				errs = append(errs, fmt.Errorf("%s: %w", where, b.err))
+			case b.to != "":
+				pins = append(pins, b.pins...)
+				updates = append(updates, SourceUpdate{File: p.FilePath, From: b.from, To: b.to})
+			}
+		}
+		for i, entry := range p.Source {
+			check(entry, fmt.Sprintf("%s: pipeline: source[%d]", p.FilePath, i))
+		}
+		for _, step := range p.Pipeline {
+			for i, entry := range step.Source {
+				check(entry, fmt.Sprintf("%s: step %q: source[%d]", p.FilePath, step.Name, i))
+			}
+		}
+		for _, file := range p.Files() {
+			if err := api.UpdateSourcePins(file, pins); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// bumpOnce looks for a newer version of entry unless an identical source was
+// looked at before.
+func bumpOnce(ctx context.Context, entry api.SourceEntry, bumps map[string]*sourceBump) *sourceBump {
+	key := strings.Join([]string{entry.URI(), entry.Repo, entry.Version, entry.Archive}, "\x00")
+	if b, ok := bumps[key]; ok {
+		return b
+	}
+	b := bumpSource(ctx, entry)
+	bumps[key] = b
+	return b
+}
+
+// bumpSource finds a newer version of a Helm, OCI or GitHub release source
+// and the pins that rewrite the entry to use it.
+func bumpSource(ctx context.Context, entry api.SourceEntry) *sourceBump {
+	timeout, err := entry.TimeoutDuration()
+	if err != nil {
+		return &sourceBump{err: err}
+	}
+	rctx, cancel := resolve.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case entry.Helm != "" && entry.Version != "":
+		version, err := resolve.LatestHelmVersion(rctx, entry.Helm, entry.Repo, entry.Version)
+		if err != nil || version == "" {
+			return &sourceBump{err: err}
+		}
+		return &sourceBump{
+			from: entry.Helm + " " + entry.Version,
+			to:   entry.Helm + " " + version,
+			pins: []api.SourcePin{{
+				Scheme: "helm",
+				URI:    entry.Helm,
+				Match:  map[string]string{"repo": entry.Repo, "version": entry.Version},
+				Field:  "version",
+				Value:  version,
+			}},
+		}
+	case entry.OCI != "" && !strings.Contains(entry.OCI, "@"):
+		ref, digest, err := resolve.LatestOCI(rctx, entry.OCI)
+		if err != nil || ref == "" {
+			return &sourceBump{err: err}
+		}
+		return &sourceBump{
+			from: entry.OCI,
+			to:   ref,
+			pins: []api.SourcePin{
+				{Scheme: "oci", URI: entry.OCI, Field: "digest", Value: digest},
+				{Scheme: "oci", URI: entry.OCI, Field: "oci", Value: ref},
+			},
+		}
+	case entry.HTTPS != "":
+		return bumpRelease(rctx, entry)
+	}
+	return &sourceBump{}
+}
+
+// bumpRelease moves a GitHub release download to the newest release and
+// downloads it to compute its sha256.
+func bumpRelease(ctx context.Context, entry api.SourceEntry) *sourceBump {
+	newURL, ok, err := resolve.LatestGitHubRelease(ctx, entry.HTTPS)
+	if !ok || err != nil || newURL == "" {
+		return &sourceBump{err: err}
+	}
+
+	next := entry
+	next.HTTPS, next.SHA256 = newURL, ""
+	_, cleanup, sum, err := resolveEntry(ctx, next, newURL)
+	if err != nil {
+		return &sourceBump{err: err}
+	}
+	if cleanup != nil {
+		cleanup()
+	}
+
+	return &sourceBump{
+		from: resolve.RedactURL(entry.HTTPS),
+		to:   resolve.RedactURL(newURL),
+		pins: []api.SourcePin{
+			{Scheme: "https", URI: entry.HTTPS, Field: "sha256", Value: sum},
+			{Scheme: "https", URI: entry.HTTPS, Field: "https", Value: newURL},
+		},
+	}
+}
+
+// matchesSourceName reports whether entry is selected by name: a Helm chart
+// name, or the repository of an OCI reference ("ghcr.io/org/app") or GitHub
+// release download ("org/app"), in full or by its last path element ("app").
+// An empty name selects every source.
+func matchesSourceName(entry api.SourceEntry, name string) bool {
+	if name == "" {
+		return true
+	}
+	var repo string
+	switch {
+	case entry.Helm != "":
+		return entry.Helm == name
+	case entry.OCI != "":
+		repo = ociRepository(entry.OCI)
+	case entry.HTTPS != "":
+		u, err := url.Parse(entry.HTTPS)
+		if err != nil {
+			return false
+		}
+		owner, rest, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+		r, _, _ := strings.Cut(rest, "/")
+		if !strings.Contains(u.Path, "/releases/download/") || r == "" {
+			return false
+		}
+		repo = owner + "/" + r
+	default:
+		return false
+	}
+	return repo == name || path.Base(repo) == name
+}
+
+// ociRepository strips the tag or digest from an OCI reference.
+func ociRepository(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
@@ -0,0 +1,125 @@
+package processing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveUpdates serves a Helm repository index listing mychart 1.0.0 and
+// 1.1.0, and GitHub releases v1.0.0 and v1.1.0 of org/tool with their
+// assets. It returns the server and the sha256 of the v1.1.0 asset.
+func serveUpdates(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	asset := []byte("tool 1.1.0\n")
+	sum := sha256.Sum256(asset)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/charts/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nentries:\n  mychart:\n    - version: 1.1.0\n    - version: 1.0.0\n"))
+	})
+	mux.HandleFunc("/api/v3/repos/org/tool/releases", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"tag_name": "v1.1.0", "assets": [{"name": "tool-1.1.0.txt"}]},
+			{"tag_name": "v1.0.0", "assets": [{"name": "tool-1.0.0.txt"}]}]`))
+	})
+	mux.HandleFunc("/org/tool/releases/download/v1.1.0/tool-1.1.0.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(asset)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, hex.EncodeToString(sum[:])
+}
+
+func TestUpdateSources(t *testing.T) {
+	srv, sum := serveUpdates(t)
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), `source:
+  # the tool
+  - https: `+srv.URL+`/org/tool/releases/download/v1.0.0/tool-1.0.0.txt
+    sha256: "`+strings.Repeat("0", 64)+`"
+pipeline:
+  - name: chart
+    type: template
+    source:
+      - helm: mychart
+        repo: `+srv.URL+`/charts
+        version: 1.0.0 # pinned
+      - helm: mychart
+        repo: `+srv.URL+`/charts
+        version: ^1.0.0
+    template: {}
+`)
+
+	updates, err := UpdateSources(t.Context(), src, -1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %+v", updates)
+	}
+
+	data, err := os.ReadFile(filepath.Join(src, ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `source:
+  # the tool
+  - https: ` + srv.URL + `/org/tool/releases/download/v1.1.0/tool-1.1.0.txt
+    sha256: "` + sum + `"
+pipeline:
+  - name: chart
+    type: template
+    source:
+      - helm: mychart
+        repo: ` + srv.URL + `/charts
+        version: "1.1.0" # pinned
+      - helm: mychart
+        repo: ` + srv.URL + `/charts
+        version: ^1.0.0
+    template: {}
+`
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+
+	updates, err = UpdateSources(t.Context(), src, -1, "")
+	if err != nil || len(updates) != 0 {
+		t.Errorf("expected sources to be up to date, got %+v, %v", updates, err)
+	}
+}
+
+func TestUpdateSources_SourceName(t *testing.T) {
+	srv, _ := serveUpdates(t)
+	src := t.TempDir()
+	pipeline := `source:
+  - https: ` + srv.URL + `/org/tool/releases/download/v1.0.0/tool-1.0.0.txt
+  - helm: mychart
+    repo: ` + srv.URL + `/charts
+    version: 1.0.0
+pipeline:
+  - name: render
+    type: template
+    template: {}
+`
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), pipeline)
+
+	updates, err := UpdateSources(t.Context(), src, -1, "mychart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].To != "mychart 1.1.0" {
+		t.Fatalf("expected only mychart to be updated, got %+v", updates)
+	}
+
+	updates, err = UpdateSources(t.Context(), src, -1, "org/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].To != srv.URL+"/org/tool/releases/download/v1.1.0/tool-1.1.0.txt" {
+		t.Fatalf("expected only the release to be updated, got %+v", updates)
+	}
+}
@@ -0,0 +1,78 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/systemstart/many-templates/pkg/api"
+)
+
+// VendorSources resolves every remote source of every pipeline discovered in
+// inputDir, whether or not its step would run, so that each is copied into
+// the vendor directory installed via resolve.SetVendor. File sources are part
+// of the input tree and are skipped. No step runs and pipeline files are not
+// modified. It returns the number of sources resolved and the errors of those
+// that failed.
+func VendorSources(ctx context.Context, inputDir string, maxDepth int) (int, error) {
+	return resolveEverySource(ctx, inputDir, maxDepth, false)
+}
+
+// resolveEverySource resolves each distinct source of every pipeline
+// discovered in inputDir once, skipping file sources unless files is set, and
+// returns how many it resolved.
+func resolveEverySource(ctx context.Context, inputDir string, maxDepth int, files bool) (int, error) {
+	pipelines, err := DiscoverPipelines(ctx, inputDir, maxDepth)
+	if err != nil {
+		return 0, fmt.Errorf("discovering pipelines: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var errs []error
+	for _, p := range pipelines {
+		for i, entry := range p.Source {
+			where := fmt.Sprintf("%s: pipeline: source[%d]", p.FilePath, i)
+			errs = append(errs, resolveOnce(ctx, entry, p.Dir, files, seen, where))
+		}
+		for _, step := range p.Pipeline {
+			for i, entry := range step.Source {
+				where := fmt.Sprintf("%s: step %q: source[%d]", p.FilePath, step.Name, i)
+				errs = append(errs, resolveOnce(ctx, entry, p.Dir, files, seen, where))
+			}
+		}
+	}
+	return len(seen), errors.Join(errs...)
+}
+
+// resolveOnce resolves entry unless an identical source was resolved before.
+func resolveOnce(ctx context.Context, entry api.SourceEntry, baseDir string, files bool, seen map[string]bool, where string) error {
+	uri := entry.URI()
+	if uri == "" || (entry.File != "" && !files) {
+		return nil
+	}
+	if entry.File != "" && !filepath.IsAbs(uri) {
+		uri = filepath.Join(baseDir, uri)
+	}
+	key := strings.Join([]string{
+		uri, entry.Repo, entry.Version, entry.Ref, entry.Commit,
+		entry.SHA256, entry.Digest, entry.Archive, strconv.FormatBool(entry.Recursive),
+	}, "\x00")
+	if seen[key] {
+		return nil
+	}
+	seen[key] = true
+
+	slog.Debug("resolving source", "source", where)
+	_, cleanup, _, err := fetchSource(ctx, entry, uri)
+	if err != nil {
+		return fmt.Errorf("%s: %w", where, err)
+	}
+	if cleanup != nil {
+		cleanup()
+	}
+	return nil
+}
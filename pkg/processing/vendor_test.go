@@ -0,0 +1,93 @@
+package processing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/systemstart/many-templates/pkg/resolve"
+)
+
+func TestVendorSources_RenderOffline(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write([]byte("Hello {{ .name }}"))
+	}))
+	defer srv.Close()
+
+	src := t.TempDir()
+	pipeline := `context:
+  name: offline
+pipeline:
+  - name: render
+    type: template
+    source:
+      - file: local
+      - https: ` + srv.URL + `/app.txt
+    template:
+      files:
+        include: ["*.txt"]
+`
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), pipeline)
+	mkdirAll(t, filepath.Join(src, "local"))
+	mkdirAll(t, filepath.Join(src, "child"))
+	writeTestFile(t, filepath.Join(src, "child", ".many.yaml"), strings.Replace(pipeline, "- file: local\n      ", "", 1))
+
+	vendorDir := filepath.Join(t.TempDir(), "vendor")
+	v, err := resolve.OpenVendor(vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve.SetVendor(v)
+	t.Cleanup(func() { resolve.SetVendor(nil) })
+
+	n, err := VendorSources(t.Context(), src, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || hits.Load() != 1 {
+		t.Fatalf("expected 1 source fetched once, got %d sources and %d downloads", n, hits.Load())
+	}
+
+	resolve.SetVendor(&resolve.Vendor{Dir: vendorDir, Offline: true})
+	srv.Close()
+	// The second run finds the sources by the sha256 the first wrote back.
+	for i := range 2 {
+		dst := filepath.Join(t.TempDir(), "output")
+		if err := RunAll(t.Context(), src, dst, nil, -1, true, 0); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		assertFileContent(t, filepath.Join(dst, "child", "app.txt"), "Hello offline")
+	}
+	data, err := os.ReadFile(filepath.Join(src, "child", ".many.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "sha256: ") {
+		t.Errorf("expected sha256 to be written back, got:\n%s", data)
+	}
+}
+
+func TestVendorSources_ReportsFailures(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, ".many.yaml"), `pipeline:
+  - name: render
+    type: template
+    source:
+      https: http://127.0.0.1:1/missing.tgz
+    template: {}
+`)
+	resolve.SetVendor(&resolve.Vendor{Dir: t.TempDir(), Offline: true})
+	t.Cleanup(func() { resolve.SetVendor(nil) })
+
+	_, err := VendorSources(t.Context(), src, -1)
+	if !errors.Is(err, resolve.ErrNotVendored) || !strings.Contains(err.Error(), `step "render": source[0]`) {
+		t.Fatalf("expected source error, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package resolve
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Archive formats accepted by the archive option of HTTPS sources.
+const (
+	archiveNone   = "none"
+	archiveAuto   = "auto"
+	archiveZip    = "zip"
+	archiveTar    = "tar"
+	archiveTarGz  = "tar.gz"
+	archiveTarXz  = "tar.xz"
+	archiveTarZst = "tar.zst"
+	archiveTarBz2 = "tar.bz2"
+)
+
+// archiveExtensions maps file name suffixes to archive formats.
+var archiveExtensions = []struct {
+	suffix string
+	format string
+}{
+	{".tar.gz", archiveTarGz},
+	{".tgz", archiveTarGz},
+	{".tar.xz", archiveTarXz},
+	{".txz", archiveTarXz},
+	{".tar.zst", archiveTarZst},
+	{".tzst", archiveTarZst},
+	{".tar.bz2", archiveTarBz2},
+	{".tbz2", archiveTarBz2},
+	{".tbz", archiveTarBz2},
+	{".tar", archiveTar},
+	{".zip", archiveZip},
+}
+
+// compressionMagic maps the leading bytes of compressed streams to the tar
+// format they are assumed to wrap.
+var compressionMagic = []struct {
+	magic  []byte
+	format string
+}{
+	{[]byte{0x1f, 0x8b}, archiveTarGz},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, archiveTarXz},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, archiveTarZst},
+	{[]byte("BZh"), archiveTarBz2},
+}
+
+var zipMagic = []byte("PK\x03\x04")
+
+// tarMagicOffset is where the "ustar" magic lives in a tar header block.
+const tarMagicOffset = 257
+
+// archiveFromName returns the archive format implied by the extension of
+// name, or "" if the extension is not a known archive extension.
+func archiveFromName(name string) string {
+	lower := strings.ToLower(name)
+	for _, e := range archiveExtensions {
+		if strings.HasSuffix(lower, e.suffix) {
+			return e.format
+		}
+	}
+	return ""
+}
+
+// sniffArchive detects the archive format of the file at path from its
+// magic bytes, or returns "" if it is not an archive. Compressed files only
+// count as archives if they decompress to a tar stream, so a gzipped single
+// file stays a file.
+func sniffArchive(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(tarMagicOffset + 5)
+
+	if bytes.HasPrefix(head, zipMagic) {
+		return archiveZip, nil
+	}
+	if isTarHeader(head) {
+		return archiveTar, nil
+	}
+	for _, m := range compressionMagic {
+		if !bytes.HasPrefix(head, m.magic) {
+			continue
+		}
+		r, closeFn, err := decompress(m.format, br)
+		if err != nil {
+			return "", nil //nolint:nilerr // not a valid stream; keep the file
+		}
+		defer closeFn()
+		inner, _ := bufio.NewReader(r).Peek(tarMagicOffset + 5)
+		if isTarHeader(inner) {
+			return m.format, nil
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+func isTarHeader(block []byte) bool {
+	return len(block) >= tarMagicOffset+5 && string(block[tarMagicOffset:tarMagicOffset+5]) == "ustar"
+}
+
+// decompress wraps r in the decompressor for the tar format. The returned
+// function releases the decompressor.
+func decompress(format string, r io.Reader) (io.Reader, func(), error) {
+	noop := func() {}
+	switch format {
+	case archiveTar:
+		return r, noop, nil
+	case archiveTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gzip decompress: %w", err)
+		}
+		return gz, func() { _ = gz.Close() }, nil
+	case archiveTarXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xz decompress: %w", err)
+		}
+		return xr, noop, nil
+	case archiveTarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("zstd decompress: %w", err)
+		}
+		return zr, zr.Close, nil
+	case archiveTarBz2:
+		return bzip2.NewReader(r), noop, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// extractArchive extracts the archive at path into destDir. Entries go
+// through the same path checks and size limit as tar extraction.
+func extractArchive(path, format, destDir string) error {
+	if format == archiveZip {
+		return extractZip(path, destDir)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if format == archiveTarGz {
+		return extractTarGz(f, destDir)
+	}
+	r, closeFn, err := decompress(format, f)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	return extractTar(r, destDir)
+}
+
+// extractZip extracts a zip archive into destDir. Like extractTar it rejects
+// entries escaping destDir and skips symlinks.
+func extractZip(path, destDir string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("reading zip: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	for _, zf := range zr.File {
+		clean, err := sanitizeTarPath(zf.Name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destDir, clean)
+
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0o750); err != nil {
+				return fmt.Errorf("creating directory %s: %w", clean, err)
+			}
+		case mode.IsRegular():
+			if err := extractZipFile(zf, target, clean); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func extractZipFile(zf *zip.File, target, clean string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return fmt.Errorf("creating parent directory for %s: %w", clean, err)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", clean, err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	perm := zf.Mode().Perm()
+	if perm == 0 {
+		perm = 0o600 // archives written on Windows carry no permissions
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("creating file %s: %w", clean, err)
+	}
+	if _, err := io.Copy(f, io.LimitReader(rc, maxFileSize)); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing file %s: %w", clean, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing file %s: %w", clean, err)
+	}
+	return nil
+}
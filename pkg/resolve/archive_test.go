@@ -0,0 +1,275 @@
+package resolve
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// bzip2TarBase64 is a tar.bz2 holding project/config.yaml ("key: value");
+// the standard library has no bzip2 writer.
+const bzip2TarBase64 = "QlpoOTFBWSZTWYNfGvsAAHj9gMqAAEBAAf8QAAJrv98gCAggAHUQppoA0BppoDTDKCSkNATGgBDAB5+lHkIL4EIQ7aqMdNJEgQwGFmXDmiawRegQRksMFMYmopgJF7Vk76D3xOUQn9lBJKScjdobREQ9F3JFOFCQg18a+w=="
+
+var archiveTestEntries = []tarEntry{
+	{name: "project/", isDir: true},
+	{name: "project/config.yaml", content: "key: value"},
+}
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarXz(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(buildTar(t, entries).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarZst(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(buildTar(t, entries).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func archiveFixtures(t *testing.T) map[string][]byte {
+	t.Helper()
+	bz2, err := base64.StdEncoding.DecodeString(bzip2TarBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string][]byte{
+		archiveZip:    buildZip(t, map[string]string{"project/config.yaml": "key: value"}),
+		archiveTar:    buildTar(t, archiveTestEntries).Bytes(),
+		archiveTarGz:  buildTarGz(t, archiveTestEntries).Bytes(),
+		archiveTarXz:  buildTarXz(t, archiveTestEntries),
+		archiveTarZst: buildTarZst(t, archiveTestEntries),
+		archiveTarBz2: bz2,
+	}
+}
+
+func serveBytes(t *testing.T, data []byte) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func assertConfigExtracted(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(path, "config.yaml"))
+	if err != nil {
+		t.Fatalf("expected extracted config.yaml: %v", err)
+	}
+	if string(data) != "key: value" {
+		t.Errorf("got %q, want %q", data, "key: value")
+	}
+}
+
+func TestResolveHTTPS_ArchiveFormats(t *testing.T) {
+	for format, data := range archiveFixtures(t) {
+		base := serveBytes(t, data)
+
+		t.Run(format+" by extension", func(t *testing.T) {
+			path, cleanup, _, err := resolveHTTPS(t.Context(), base+"/release."+format, "", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			assertConfigExtracted(t, path)
+		})
+
+		t.Run(format+" by magic bytes", func(t *testing.T) {
+			path, cleanup, _, err := resolveHTTPS(t.Context(), base+"/download", "", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			assertConfigExtracted(t, path)
+		})
+
+		t.Run(format+" by override", func(t *testing.T) {
+			path, cleanup, _, err := resolveHTTPS(t.Context(), base+"/release.bin", "", format, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			assertConfigExtracted(t, path)
+		})
+	}
+}
+
+func TestResolveHTTPS_ArchiveNone(t *testing.T) {
+	data := buildTarGz(t, archiveTestEntries).Bytes()
+	base := serveBytes(t, data)
+
+	path, cleanup, _, err := resolveHTTPS(t.Context(), base+"/release.tar.gz", "", archiveNone, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if filepath.Base(path) != "release.tar.gz" {
+		t.Errorf("expected the download to be kept as release.tar.gz, got %s", path)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded file differs from served content")
+	}
+}
+
+func TestResolveHTTPS_ArchiveOverrideMismatch(t *testing.T) {
+	base := serveBytes(t, []byte("not a zip"))
+
+	_, _, _, err := resolveHTTPS(t.Context(), base+"/release", "", archiveZip, nil)
+	if err == nil || !strings.Contains(err.Error(), "extracting zip archive") {
+		t.Fatalf("expected zip extraction error, got %v", err)
+	}
+}
+
+func TestSniffArchive_GzippedFileIsNotAnArchive(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte("kind: ConfigMap\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "download")
+	if err := os.WriteFile(p, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	format, err := sniffArchive(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "" {
+		t.Errorf("sniffArchive = %q, want no archive", format)
+	}
+}
+
+func TestSniffArchive_PlainFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "download")
+	if err := os.WriteFile(p, []byte("key: value\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	format, err := sniffArchive(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "" {
+		t.Errorf("sniffArchive = %q, want no archive", format)
+	}
+}
+
+func TestExtractZip_PathTraversal(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "evil.zip")
+	if err := os.WriteFile(p, buildZip(t, map[string]string{"../escape.txt": "x"}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	err := extractArchive(p, archiveZip, dest)
+	if err == nil || !strings.Contains(err.Error(), "invalid path") {
+		t.Fatalf("expected invalid path error, got %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(filepath.Dir(dest), "escape.txt")); !os.IsNotExist(statErr) {
+		t.Error("file escaped the destination directory")
+	}
+}
+
+func TestExtractArchive_UnsupportedFormat(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(p, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := extractArchive(p, "rar", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "unsupported archive format") {
+		t.Fatalf("expected unsupported format error, got %v", err)
+	}
+}
+
+func TestResolveHTTPS_ArchiveCacheKey(t *testing.T) {
+	useTestCache(t)
+
+	data := buildTarGz(t, archiveTestEntries).Bytes()
+	base := serveBytes(t, data)
+	digest := sha256.Sum256(data)
+	sum := hex.EncodeToString(digest[:])
+
+	extracted, cleanup, _, err := ResolveHTTPS(t.Context(), base+"/release.tar.gz", sum, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	assertConfigExtracted(t, extracted)
+
+	// The same URL and checksum with a different archive setting must not
+	// be served the extracted tree from the cache.
+	kept, cleanup2, _, err := ResolveHTTPS(t.Context(), base+"/release.tar.gz", sum, archiveNone, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleanup2 != nil {
+		defer cleanup2()
+	}
+	if st, err := os.Stat(kept); err != nil || st.IsDir() {
+		t.Errorf("expected a single file for archive: none, got %s (%v)", kept, err)
+	}
+}
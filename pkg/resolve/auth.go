@@ -0,0 +1,332 @@
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxRedirects matches the limit of net/http's default redirect policy.
+const maxRedirects = 10
+
+// HTTPCredentials configures authentication for HTTPS downloads per host.
+type HTTPCredentials struct {
+	Hosts map[string]HostCredentials `yaml:"hosts"`
+}
+
+// HostCredentials authenticate requests to one host. Token takes precedence
+// over Username and Password.
+type HostCredentials struct {
+	Token    string            `yaml:"token,omitempty"`    // sent as "Authorization: Bearer <token>"
+	Username string            `yaml:"username,omitempty"` // basic auth user
+	Password string            `yaml:"password,omitempty"` // basic auth password
+	Headers  map[string]string `yaml:"headers,omitempty"`  // extra request headers
+}
+
+var (
+	credentialsMu   sync.RWMutex
+	httpCredentials *HTTPCredentials
+)
+
+// SetHTTPCredentials installs the per-host credentials used for HTTPS
+// sources. A nil value removes them; ~/.netrc is still consulted.
+func SetHTTPCredentials(c *HTTPCredentials) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	httpCredentials = c
+}
+
+// DefaultHTTPCredentialsFile returns the default credentials file location,
+// $XDG_CONFIG_HOME/many/credentials.yaml (or the platform equivalent).
+func DefaultHTTPCredentialsFile() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("determining user config directory: %w", err)
+	}
+	return filepath.Join(base, "many", "credentials.yaml"), nil
+}
+
+// LoadHTTPCredentials reads a credentials file. ${VAR} references in values
+// are replaced with the environment variable's value; a reference to an unset
+// variable is an error, so a missing secret is not silently sent as "".
+func LoadHTTPCredentials(path string) (*HTTPCredentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading credentials file: %w", err)
+	}
+
+	var creds HTTPCredentials
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&creds); err != nil {
+		return nil, fmt.Errorf("parsing credentials file %s: %w", path, err)
+	}
+
+	for host, hc := range creds.Hosts {
+		if hc.Token, err = expandEnv(hc.Token); err == nil {
+			if hc.Username, err = expandEnv(hc.Username); err == nil {
+				hc.Password, err = expandEnv(hc.Password)
+			}
+		}
+		if err == nil {
+			hc.Headers, err = expandHeaders(hc.Headers)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("credentials for %s: %w", host, err)
+		}
+		creds.Hosts[host] = hc
+	}
+	return &creds, nil
+}
+
+// lookup returns the credentials configured for the host of u, matching
+// host:port before the bare host name.
+func (c *HTTPCredentials) lookup(u *url.URL) (HostCredentials, bool) {
+	if c == nil {
+		return HostCredentials{}, false
+	}
+	if hc, ok := c.Hosts[u.Host]; ok {
+		return hc, true
+	}
+	hc, ok := c.Hosts[u.Hostname()]
+	return hc, ok
+}
+
+// expandEnv replaces ${VAR} and $VAR references in s with environment values.
+// Unset variables are reported by name; their values never appear in errors.
+func expandEnv(s string) (string, error) {
+	var missing []string
+	out := os.Expand(s, func(name string) string {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func expandHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return headers, nil
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		v, err := expandEnv(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+// newDownloadRequest builds a GET request for rawURL carrying the credentials
+// for its host and the source's headers, whose values may reference
+// environment variables.
+func newDownloadRequest(ctx context.Context, rawURL string, headers map[string]string) (*http.Request, error) {
+	expanded, err := expandHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request for %s: %w", RedactURL(rawURL), err)
+	}
+	authorize(req)
+	for name, value := range expanded {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// authorize adds the credentials for the request's host: the configured
+// credentials if any, otherwise a matching ~/.netrc entry. Credentials in the
+// URL itself take precedence over netrc.
+func authorize(req *http.Request) {
+	credentialsMu.RLock()
+	hc, ok := httpCredentials.lookup(req.URL)
+	credentialsMu.RUnlock()
+
+	if !ok {
+		if req.URL.User != nil {
+			return
+		}
+		login, password, found := netrcLookup(req.URL.Hostname())
+		if !found {
+			return
+		}
+		hc = HostCredentials{Username: login, Password: password}
+	}
+
+	switch {
+	case hc.Token != "":
+		req.Header.Set("Authorization", "Bearer "+hc.Token)
+	case hc.Username != "" || hc.Password != "":
+		req.SetBasicAuth(hc.Username, hc.Password)
+	}
+	for name, value := range hc.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// redirectPolicy keeps credentials on the host they were meant for: when a
+// redirect leaves the original host, the source's headers and any
+// Authorization header are dropped and the new host's credentials applied.
+func redirectPolicy(origin *url.URL, headers map[string]string) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if req.URL.Host == origin.Host {
+			return nil
+		}
+		for name := range headers {
+			req.Header.Del(name)
+		}
+		credentialsMu.RLock()
+		if hc, ok := httpCredentials.lookup(origin); ok {
+			for name := range hc.Headers {
+				req.Header.Del(name)
+			}
+		}
+		credentialsMu.RUnlock()
+		req.Header.Del("Authorization")
+		authorize(req)
+		return nil
+	}
+}
+
+// netrcLookup returns the login and password for host from the netrc file
+// ($NETRC, or ~/.netrc), falling back to its default entry.
+func netrcLookup(host string) (login, password string, found bool) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+	return parseNetrc(string(data), host)
+}
+
+// parseNetrc finds the entry for host in netrc data. A default entry
+// matches any host that has no machine entry.
+func parseNetrc(data, host string) (login, password string, found bool) {
+	type entry struct{ login, password string }
+	var def, match, current *entry
+
+	tokens := netrcTokens(data)
+	for i := 0; i < len(tokens); i++ {
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		switch tokens[i] {
+		case "machine":
+			if match != nil {
+				return match.login, match.password, true
+			}
+			current = &entry{}
+			if next == host {
+				match = current
+			}
+			i++
+		case "default":
+			if match != nil {
+				return match.login, match.password, true
+			}
+			current = &entry{}
+			def = current
+		case "login":
+			if current != nil {
+				current.login = next
+			}
+			i++
+		case "password":
+			if current != nil {
+				current.password = next
+			}
+			i++
+		case "account":
+			i++
+		}
+	}
+	switch {
+	case match != nil:
+		return match.login, match.password, true
+	case def != nil:
+		return def.login, def.password, true
+	}
+	return "", "", false
+}
+
+// netrcTokens splits netrc data into tokens, dropping comments and macdef
+// bodies (which run until the next empty line).
+func netrcTokens(data string) []string {
+	var tokens []string
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		for _, tok := range strings.Fields(lines[i]) {
+			if strings.HasPrefix(tok, "#") {
+				break
+			}
+			tokens = append(tokens, tok)
+			if tok == "macdef" {
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				break
+			}
+		}
+	}
+	return tokens
+}
+
+// secretQueryParam matches the names of query parameters that commonly carry
+// credentials, such as token, access_token, api_key or X-Amz-Signature.
+var secretQueryParam = regexp.MustCompile(`(?i)token|key|secret|passw|sig|credential|auth`)
+
+// RedactURL returns rawURL with any password in its user info and the values
+// of credential-like query parameters replaced, for use in logs, output and
+// files such as cache metadata.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		if strings.ContainsAny(rawURL, "@?") {
+			return "<redacted URL>"
+		}
+		return rawURL
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		redacted := false
+		for name := range q {
+			if secretQueryParam.MatchString(name) {
+				q[name] = []string{"xxxxx"}
+				redacted = true
+			}
+		}
+		if redacted {
+			u.RawQuery = q.Encode()
+		}
+	}
+	return u.Redacted()
+}
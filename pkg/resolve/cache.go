@@ -0,0 +1,395 @@
+package resolve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheMetaFile   = "meta.json"
+	cacheContentDir = "content"
+	cacheTmpPrefix  = ".tmp-"
+
+	// cacheTmpGrace is how long Prune keeps the staging dir of a store, which
+	// another process may still be writing, regardless of maxAge.
+	cacheTmpGrace = 24 * time.Hour
+)
+
+// Cache is a persistent, content-addressed store of resolved sources.
+// Only pinned sources (an HTTPS sha256, an OCI digest, a Helm chart version,
+// an OCM component version) are cached, since only those are immutable.
+type Cache struct {
+	Dir string
+}
+
+// CacheEntry describes a single cached source.
+type CacheEntry struct {
+	Key      string    `json:"-"`
+	URI      string    `json:"uri"` // with credentials redacted
+	Pin      string    `json:"pin"`
+	File     string    `json:"file,omitempty"`     // base name if the source is a single file
+	Resolved string    `json:"resolved,omitempty"` // value computed while fetching (HTTPS sha256, git commit)
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"-"`
+	Size     int64     `json:"-"`
+}
+
+var (
+	cacheMu     sync.RWMutex
+	sourceCache *Cache
+)
+
+// SetCache installs the cache used by Resolve, ResolveHelm and
+// ResolveOCMRecursive. A nil cache disables caching.
+func SetCache(c *Cache) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	sourceCache = c
+}
+
+func activeCache() *Cache {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+	return sourceCache
+}
+
+// DefaultCacheDir returns the default cache location, $XDG_CACHE_HOME/many
+// (or the platform equivalent).
+func DefaultCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("determining user cache directory: %w", err)
+	}
+	return filepath.Join(base, "many"), nil
+}
+
+// OpenCache creates the cache directory if needed and returns a Cache for it.
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	return &Cache{Dir: dir}, nil
+}
+
+// cacheKey derives the content address of a source from its URI and pin.
+func cacheKey(uri, pin string) string {
+	sum := sha256.Sum256([]byte(uri + "\x00" + pin))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns a private copy of a cached entry, or ok=false on a miss.
+func (c *Cache) lookup(uri, pin string) (path string, cleanup func(), entry *CacheEntry, ok bool) {
+	key := cacheKey(uri, pin)
+	entryDir := filepath.Join(c.Dir, key)
+
+	entry, err := readCacheMeta(entryDir)
+	if err != nil {
+		return "", nil, nil, false
+	}
+
+	tmp, cleanup, err := mkdirTemp("", "many-cache-*")
+	if err != nil {
+		return "", nil, nil, false
+	}
+
+	if err := copyPath(filepath.Join(entryDir, cacheContentDir), tmp); err != nil {
+		slog.Warn("failed to read cached source, refetching", "uri", RedactURL(uri), "error", err)
+		cleanup()
+		return "", nil, nil, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(entryDir, cacheMetaFile), now, now)
+
+	path = tmp
+	if entry.File != "" {
+		path = filepath.Join(tmp, entry.File)
+	}
+	return path, cleanup, entry, true
+}
+
+// store copies a resolved source into the cache. Concurrent stores of the same
+// key are safe: the first rename wins and later ones are discarded.
+func (c *Cache) store(uri, pin, resolvedPath, computed string) error {
+	info, err := os.Stat(resolvedPath)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", resolvedPath, err)
+	}
+
+	tmp, cleanup, err := mkdirTemp(c.Dir, cacheTmpPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("creating cache staging dir: %w", err)
+	}
+	defer cleanup()
+
+	entry := CacheEntry{URI: RedactURL(uri), Pin: pin, Resolved: computed, Created: time.Now().UTC()}
+	content := filepath.Join(tmp, cacheContentDir)
+	if info.IsDir() {
+		err = copyPath(resolvedPath, content)
+	} else {
+		entry.File = filepath.Base(resolvedPath)
+		err = copyPath(resolvedPath, filepath.Join(content, entry.File))
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cache metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, cacheMetaFile), data, 0o600); err != nil {
+		return fmt.Errorf("writing cache metadata: %w", err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(c.Dir, cacheKey(uri, pin))); err != nil {
+		if _, statErr := os.Stat(filepath.Join(c.Dir, cacheKey(uri, pin), cacheMetaFile)); statErr == nil {
+			return nil // stored concurrently by someone else
+		}
+		return fmt.Errorf("committing cache entry: %w", err)
+	}
+	return nil
+}
+
+// List returns all cache entries, most recently used first.
+func (c *Cache) List() ([]CacheEntry, error) {
+	dirents, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading cache directory: %w", err)
+	}
+
+	var entries []CacheEntry
+	for _, d := range dirents {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), cacheTmpPrefix) {
+			continue
+		}
+		entryDir := filepath.Join(c.Dir, d.Name())
+		entry, err := readCacheMeta(entryDir)
+		if err != nil {
+			continue
+		}
+		entry.Key = d.Name()
+		entry.Size = treeSize(entryDir)
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Prune removes entries not used within maxAge, as well as leftovers of
+// interrupted stores and entries with unreadable metadata. Stores younger than
+// cacheTmpGrace may still be in progress and are kept. It returns the number
+// of removed entries.
+func (c *Cache) Prune(maxAge time.Duration) (int, error) {
+	dirents, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("reading cache directory: %w", err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, d := range dirents {
+		entryDir := filepath.Join(c.Dir, d.Name())
+		if recentlyUsed(entryDir, d, cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(entryDir); err != nil {
+			return removed, fmt.Errorf("removing %s: %w", entryDir, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Clear removes every cache entry.
+func (c *Cache) Clear() error {
+	dirents, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading cache directory: %w", err)
+	}
+	for _, d := range dirents {
+		if err := os.RemoveAll(filepath.Join(c.Dir, d.Name())); err != nil {
+			return fmt.Errorf("removing %s: %w", d.Name(), err)
+		}
+	}
+	return nil
+}
+
+// recentlyUsed reports whether a cache directory entry should survive pruning.
+// Staging dirs of in-flight stores are kept until they are older than both
+// cutoff and cacheTmpGrace.
+func recentlyUsed(entryDir string, d fs.DirEntry, cutoff time.Time) bool {
+	if strings.HasPrefix(d.Name(), cacheTmpPrefix) {
+		info, err := d.Info()
+		if err != nil {
+			return false
+		}
+		return info.ModTime().After(cutoff) || time.Since(info.ModTime()) < cacheTmpGrace
+	}
+	entry, err := readCacheMeta(entryDir)
+	return err == nil && entry.LastUsed.After(cutoff)
+}
+
+func readCacheMeta(entryDir string) (*CacheEntry, error) {
+	metaPath := filepath.Join(entryDir, cacheMetaFile)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading cache metadata: %w", err)
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("parsing cache metadata: %w", err)
+	}
+	if info, err := os.Stat(metaPath); err == nil {
+		entry.LastUsed = info.ModTime()
+	}
+	return &entry, nil
+}
+
+func treeSize(root string) int64 {
+	var size int64
+	_ = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // best-effort
+		}
+		if info, infoErr := d.Info(); infoErr == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// copyPath copies a file or directory tree from src to dst.
+func copyPath(src, dst string) error {
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error at %s: %w", path, err)
+		}
+		rel, relErr := filepath.Rel(src, path)
+		if relErr != nil {
+			return fmt.Errorf("computing relative path for %s: %w", path, relErr)
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			if mkErr := os.MkdirAll(target, 0o750); mkErr != nil {
+				return fmt.Errorf("creating directory %s: %w", target, mkErr)
+			}
+			return nil
+		}
+		return copyFile(path, target, d)
+	})
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", src, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", src, err)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", src, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return fmt.Errorf("creating directory for %s: %w", dst, err)
+	}
+	if err := os.WriteFile(dst, data, info.Mode()); err != nil {
+		return fmt.Errorf("writing %s: %w", dst, err)
+	}
+	return nil
+}
+
+// pinFunc returns the URI and pin a source is known by once it is pinned to
+// the value computed while resolving it (a sha256, commit or digest).
+type pinFunc func(computed string) (uri, pin string)
+
+// withCache serves a pinned source from the active cache, or calls fetch and
+// stores its result. An empty pin marks the source as mutable and bypasses
+// the cache entirely; uri must then identify it completely. When a vendor
+// directory is installed it takes over, see Vendor.
+func withCache(uri, pin string, pinned pinFunc, fetch func() (string, func(), string, error)) (string, func(), string, error) {
+	if v := activeVendor(); v != nil {
+		return v.resolve(uri, pin, pinned, fetch)
+	}
+	return fromCache(uri, pin, fetch)
+}
+
+func fromCache(uri, pin string, fetch func() (string, func(), string, error)) (string, func(), string, error) {
+	c := activeCache()
+	if c == nil || pin == "" {
+		return fetch()
+	}
+
+	if path, cleanup, entry, ok := c.lookup(uri, pin); ok {
+		slog.Debug("source cache hit", "uri", RedactURL(uri), "pin", pin)
+		return path, cleanup, entry.Resolved, nil
+	}
+
+	path, cleanup, computed, err := fetch()
+	if err != nil {
+		return "", nil, "", err
+	}
+	if storeErr := c.store(uri, pin, path, computed); storeErr != nil {
+		slog.Warn("failed to store source in cache", "uri", RedactURL(uri), "error", storeErr)
+	}
+	return path, cleanup, computed, nil
+}
+
+// ociPin returns the digest of a digest-pinned OCI reference, or "".
+func ociPin(ref string) string {
+	if i := strings.Index(ref, "@sha256:"); i >= 0 {
+		return ref[i+1:]
+	}
+	return ""
+}
+
+// ocmPin returns the component version of an OCM reference, or "".
+// References have the form [repo//]component:version. Only a colon in the
+// last path segment of the component starts a version, so a registry port
+// is not mistaken for one.
+func ocmPin(ref string) string {
+	component := ref
+	if i := strings.Index(ref, "//"); i >= 0 {
+		component = ref[i+2:]
+	}
+	name := component[strings.LastIndex(component, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// helmPin returns version if it names a single chart version, or "" for
+// empty versions and semver constraints, which may resolve differently later.
+func helmPin(version string) string {
+	if version == "" || strings.ContainsAny(version, "^~<>=*|, xX") {
+		return ""
+	}
+	return version
+}
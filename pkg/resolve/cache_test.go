@@ -0,0 +1,266 @@
+package resolve
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func useTestCache(t *testing.T) *Cache {
+	t.Helper()
+	c, err := OpenCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCache(c)
+	t.Cleanup(func() { SetCache(nil) })
+	return c
+}
+
+func countingServer(t *testing.T, body []byte) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	orig := httpClient
+	httpClient = srv.Client()
+	t.Cleanup(func() { httpClient = orig })
+	return srv, &hits
+}
+
+func TestResolve_CachesPinnedHTTPS(t *testing.T) {
+	c := useTestCache(t)
+	content := []byte("kind: ConfigMap\n")
+	sum := sha256.Sum256(content)
+	pin := hex.EncodeToString(sum[:])
+	srv, hits := countingServer(t, content)
+	url := srv.URL + "/config.yaml"
+
+	for i := range 2 {
+		path, cleanup, computed, err := Resolve(t.Context(), url, pin)
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if filepath.Base(path) != "config.yaml" {
+			t.Errorf("run %d: expected file name to be preserved, got %s", i, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(content) {
+			t.Errorf("run %d: got %q", i, data)
+		}
+		if computed != pin {
+			t.Errorf("run %d: expected computed sha256 %s, got %s", i, pin, computed)
+		}
+		cleanup()
+	}
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("expected 1 download, got %d", got)
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].URI != url || entries[0].Pin != pin {
+		t.Errorf("unexpected cache entries: %+v", entries)
+	}
+}
+
+func TestResolve_SkipsCacheForUnpinnedHTTPS(t *testing.T) {
+	c := useTestCache(t)
+	srv, hits := countingServer(t, []byte("data"))
+
+	for range 2 {
+		_, cleanup, _, err := Resolve(t.Context(), srv.URL+"/file.txt", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleanup()
+	}
+
+	if got := hits.Load(); got != 2 {
+		t.Errorf("expected 2 downloads, got %d", got)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Errorf("expected empty cache, got %d entries", len(entries))
+	}
+}
+
+func TestResolve_CachesPinnedTarball(t *testing.T) {
+	useTestCache(t)
+	archive := buildTarGz(t, []tarEntry{
+		{name: "root/", isDir: true},
+		{name: "root/a.yaml", content: "a"},
+		{name: "root/sub/b.yaml", content: "b"},
+	})
+	sum := sha256.Sum256(archive.Bytes())
+	pin := hex.EncodeToString(sum[:])
+	srv, hits := countingServer(t, archive.Bytes())
+
+	for range 2 {
+		path, cleanup, _, err := Resolve(t.Context(), srv.URL+"/repo.tar.gz", pin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(path, "sub", "b.yaml"))
+		if err != nil || string(data) != "b" {
+			t.Errorf("unexpected content %q (%v)", data, err)
+		}
+		cleanup()
+	}
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("expected 1 download, got %d", got)
+	}
+}
+
+func TestCache_PruneAndClear(t *testing.T) {
+	c := useTestCache(t)
+	src := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(src, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, pin := range []string{"v1", "v2"} {
+		if err := c.store("helm://chart", pin, src, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Age the v1 entry.
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(c.Dir, cacheKey("helm://chart", "v1"), cacheMetaFile), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 pruned entry, got %d", n)
+	}
+	entries, _ := c.List()
+	if len(entries) != 1 || entries[0].Pin != "v2" {
+		t.Errorf("unexpected entries after prune: %+v", entries)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Errorf("expected empty cache after clear, got %d entries", len(entries))
+	}
+}
+
+func TestCache_PruneKeepsInFlightStores(t *testing.T) {
+	c := useTestCache(t)
+	inFlight := filepath.Join(c.Dir, cacheTmpPrefix+"1")
+	stale := filepath.Join(c.Dir, cacheTmpPrefix+"2")
+	for _, dir := range []string{inFlight, stale} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * cacheTmpGrace)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.Prune(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 pruned entry, got %d", n)
+	}
+	if _, err := os.Stat(inFlight); err != nil {
+		t.Errorf("expected the in-flight store to be kept: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the stale store to be removed")
+	}
+}
+
+func TestCachePins(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"oci tag", ociPin("ghcr.io/org/repo:v1"), ""},
+		{"oci digest", ociPin("ghcr.io/org/repo@sha256:abc"), "sha256:abc"},
+		{"ocm versioned", ocmPin("ghcr.io/org/ocm//github.com/org/comp:v1.2.0"), "v1.2.0"},
+		{"ocm unversioned", ocmPin("ghcr.io/org/ocm//github.com/org/comp"), ""},
+		{"ocm repo port", ocmPin("ghcr.io:5000//org/comp"), ""},
+		{"ocm port unversioned", ocmPin("localhost:5000/org/comp"), ""},
+		{"ocm port versioned", ocmPin("localhost:5000//github.com/org/comp:v1"), "v1"},
+		{"helm exact", helmPin("1.2.3"), "1.2.3"},
+		{"helm empty", helmPin(""), ""},
+		{"helm constraint", helmPin("^1.2.0"), ""},
+		{"helm wildcard", helmPin("1.2.x"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve_CacheRedactsCredentials(t *testing.T) {
+	c := useTestCache(t)
+	content := []byte("kind: ConfigMap\n")
+	sum := sha256.Sum256(content)
+	pin := hex.EncodeToString(sum[:])
+	srv, _ := countingServer(t, content)
+	url := strings.Replace(srv.URL, "https://", "https://ci:s3cret@", 1) + "/config.yaml?token=s3cret"
+
+	var logs bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	for range 2 {
+		_, cleanup, _, err := Resolve(t.Context(), url, pin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleanup()
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || strings.Contains(entries[0].URI, "s3cret") {
+		t.Errorf("expected a redacted cache entry, got %+v", entries)
+	}
+	meta, err := os.ReadFile(filepath.Join(c.Dir, entries[0].Key, cacheMetaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(meta), "s3cret") {
+		t.Errorf("credentials written to cache metadata: %s", meta)
+	}
+	if !strings.Contains(logs.String(), "source cache hit") || strings.Contains(logs.String(), "s3cret") {
+		t.Errorf("expected redacted cache logs, got:\n%s", logs.String())
+	}
+}
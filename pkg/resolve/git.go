@@ -0,0 +1,130 @@
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var gitCommitRe = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// ResolveGit fetches a Git repository at ref (branch, tag or commit; default
+// HEAD) into a temp directory and returns its path along with the
+// checked-out commit SHA. When commit is set it is checked out instead of
+// ref, which makes the source immutable and cacheable.
+func ResolveGit(ctx context.Context, url, ref, commit string) (string, func(), string, error) {
+	pin := commit
+	if pin == "" && gitCommitRe.MatchString(ref) {
+		pin = ref
+	}
+
+	uri := "git+" + url
+	if pin == "" && ref != "" {
+		uri += "#" + ref
+	}
+	pinned := func(commit string) (string, string) { return "git+" + url, commit }
+	return withCache(uri, pin, pinned, func() (string, func(), string, error) {
+		return fetchGit(ctx, url, ref, commit)
+	})
+}
+
+// splitGitURI splits a "git+URL#ref" URI into its URL and ref.
+func splitGitURI(uri string) (string, string) {
+	url := strings.TrimPrefix(uri, "git+")
+	if i := strings.LastIndex(url, "#"); i >= 0 {
+		return url[:i], url[i+1:]
+	}
+	return url, ""
+}
+
+func fetchGit(ctx context.Context, url, ref, commit string) (string, func(), string, error) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return "", nil, "", fmt.Errorf("git binary not found in PATH — install from: https://git-scm.com/downloads")
+	}
+
+	dir, cleanup, err := mkdirTemp("", "many-git-*")
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	resolved, err := checkoutGit(ctx, gitPath, dir, url, ref, commit)
+	if err != nil {
+		cleanup()
+		return "", nil, "", err
+	}
+
+	// The work dir should only receive the tree, not the repository metadata.
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		cleanup()
+		return "", nil, "", fmt.Errorf("removing .git directory: %w", err)
+	}
+
+	return dir, cleanup, resolved, nil
+}
+
+func checkoutGit(ctx context.Context, gitPath, dir, url, ref, commit string) (string, error) {
+	target := commit
+	if target == "" {
+		target = ref
+	}
+	if target == "" {
+		target = "HEAD"
+	}
+
+	if _, err := runGit(ctx, gitPath, dir, "init", "-q"); err != nil {
+		return "", err
+	}
+
+	// url and target come from pipeline files; --end-of-options keeps a value
+	// starting with "-" from being read as an option such as --upload-pack.
+	checkout := "FETCH_HEAD"
+	if _, err := runGit(ctx, gitPath, dir, "fetch", "-q", "--depth", "1", "--end-of-options", url, target); err != nil {
+		if commit == "" {
+			return "", err
+		}
+		// Some servers refuse to serve unadvertised commits directly; fall
+		// back to fetching all refs and checking out the commit from there.
+		if _, err := runGit(ctx, gitPath, dir, "fetch", "-q", "--end-of-options", url, "+refs/*:refs/remotes/origin/*"); err != nil {
+			return "", err
+		}
+		checkout = commit
+	}
+
+	if _, err := runGit(ctx, gitPath, dir, "-c", "advice.detachedHead=false", "checkout", "-q", "--detach", checkout); err != nil {
+		return "", err
+	}
+
+	resolved, err := runGit(ctx, gitPath, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if commit != "" && resolved != commit {
+		return "", fmt.Errorf("commit mismatch for %s: expected %s, got %s", RedactURL(url), commit, resolved)
+	}
+
+	slog.Debug("checked out git source", "url", RedactURL(url), "ref", ref, "commit", resolved)
+	return resolved, nil
+}
+
+// runGit runs git in dir with prompts disabled and returns trimmed stdout.
+// The process is killed when ctx is done.
+func runGit(ctx context.Context, gitPath, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, gitPath, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w\nstderr: %s", args[0], err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,197 @@
+package resolve
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func skipWithoutGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not in PATH")
+	}
+}
+
+// gitRun runs git in dir for test setup, failing the test on error.
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// setupBareGitRepo creates a bare repository with two commits on main:
+// the first (tagged v1) has deploy/app.yaml = "v1", the second changes it to "v2".
+// It returns the file:// URL and both commit SHAs.
+func setupBareGitRepo(t *testing.T) (string, string, string) {
+	t.Helper()
+	root := t.TempDir()
+	bare := filepath.Join(root, "repo.git")
+	work := filepath.Join(root, "work")
+
+	gitRun(t, root, "init", "-q", "--bare", "-b", "main", bare)
+	gitRun(t, root, "init", "-q", "-b", "main", work)
+	if err := os.MkdirAll(filepath.Join(work, "deploy"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCommit := func(content string) string {
+		if err := os.WriteFile(filepath.Join(work, "deploy", "app.yaml"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		gitRun(t, work, "add", ".")
+		gitRun(t, work, "commit", "-q", "-m", content)
+		return gitRun(t, work, "rev-parse", "HEAD")
+	}
+
+	first := writeCommit("v1")
+	gitRun(t, work, "tag", "-a", "v1", "-m", "v1")
+	second := writeCommit("v2")
+	gitRun(t, work, "push", "-q", bare, "main", "v1")
+
+	return "file://" + bare, first, second
+}
+
+func TestResolveGit(t *testing.T) {
+	skipWithoutGit(t)
+	url, first, second := setupBareGitRepo(t)
+
+	tests := []struct {
+		name       string
+		ref        string
+		commit     string
+		wantCommit string
+		wantData   string
+	}{
+		{"default branch", "", "", second, "v2"},
+		{"branch", "main", "", second, "v2"},
+		{"annotated tag", "v1", "", first, "v1"},
+		{"commit as ref", first, "", first, "v1"},
+		{"pinned commit wins over ref", "main", first, first, "v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cleanup, commit, err := ResolveGit(t.Context(), url, tt.ref, tt.commit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+
+			if commit != tt.wantCommit {
+				t.Errorf("commit = %s, want %s", commit, tt.wantCommit)
+			}
+			data, err := os.ReadFile(filepath.Join(path, "deploy", "app.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("content = %q, want %q", data, tt.wantData)
+			}
+			if _, err := os.Stat(filepath.Join(path, ".git")); !os.IsNotExist(err) {
+				t.Error("expected .git directory to be removed")
+			}
+		})
+	}
+}
+
+func TestResolveGit_UnknownRef(t *testing.T) {
+	skipWithoutGit(t)
+	url, _, _ := setupBareGitRepo(t)
+
+	_, _, _, err := ResolveGit(t.Context(), url, "does-not-exist", "")
+	requireErrorContains(t, err, "git fetch failed")
+}
+
+func TestResolveGit_OptionsAreNotInterpreted(t *testing.T) {
+	skipWithoutGit(t)
+	url, _, _ := setupBareGitRepo(t)
+	marker := filepath.Join(t.TempDir(), "marker")
+
+	for _, tt := range []struct{ url, ref string }{
+		{"--upload-pack=touch " + marker, ""},
+		{url, "--upload-pack=touch " + marker},
+	} {
+		if _, _, _, err := ResolveGit(t.Context(), tt.url, tt.ref, ""); err == nil {
+			t.Errorf("expected fetching %q at %q to fail", tt.url, tt.ref)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Fatalf("git ran the command in %q", tt.url+tt.ref)
+		}
+	}
+}
+
+func TestResolveGit_CachesPinnedCommit(t *testing.T) {
+	skipWithoutGit(t)
+	c := useTestCache(t)
+	url, first, _ := setupBareGitRepo(t)
+
+	_, cleanup, _, err := ResolveGit(t.Context(), url, "", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+
+	// Remove the upstream repository; the pinned commit must come from the cache.
+	if err := os.RemoveAll(strings.TrimPrefix(url, "file://")); err != nil {
+		t.Fatal(err)
+	}
+	path, cleanup, commit, err := ResolveGit(t.Context(), url, "", first)
+	if err != nil {
+		t.Fatalf("expected cache hit: %v", err)
+	}
+	defer cleanup()
+	if commit != first {
+		t.Errorf("commit = %s, want %s", commit, first)
+	}
+	if _, err := os.Stat(filepath.Join(path, "deploy", "app.yaml")); err != nil {
+		t.Error(err)
+	}
+	if entries, _ := c.List(); len(entries) != 1 {
+		t.Errorf("expected 1 cache entry, got %d", len(entries))
+	}
+}
+
+func TestResolve_GitURI(t *testing.T) {
+	skipWithoutGit(t)
+	url, _, _ := setupBareGitRepo(t)
+
+	path, cleanup, _, err := Resolve(t.Context(), "git+"+url+"#v1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	data, err := os.ReadFile(filepath.Join(path, "deploy", "app.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1" {
+		t.Errorf("content = %q, want %q", data, "v1")
+	}
+}
+
+func TestSplitGitURI(t *testing.T) {
+	tests := []struct {
+		uri, url, ref string
+	}{
+		{"git+https://example.com/repo.git", "https://example.com/repo.git", ""},
+		{"git+https://example.com/repo.git#v1.0.0", "https://example.com/repo.git", "v1.0.0"},
+		{"git+file:///tmp/repo.git#main", "file:///tmp/repo.git", "main"},
+	}
+	for _, tt := range tests {
+		url, ref := splitGitURI(tt.uri)
+		if url != tt.url || ref != tt.ref {
+			t.Errorf("splitGitURI(%q) = %q, %q; want %q, %q", tt.uri, url, ref, tt.url, tt.ref)
+		}
+	}
+}
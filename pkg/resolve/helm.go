@@ -1,38 +1,65 @@
 package resolve
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
 )
 
 // ResolveHelm pulls a Helm chart from a repository and returns a local path
-// to the extracted chart directory.
-func ResolveHelm(chart, repo, version string) (string, func(), error) {
-	helmPath, err := exec.LookPath("helm")
-	if err != nil {
-		return "", nil, fmt.Errorf("helm binary not found in PATH — install from: https://helm.sh/docs/intro/install/")
+// to the extracted chart directory. Charts pinned to an exact version are
+// served from the source cache, if one is installed.
+func ResolveHelm(ctx context.Context, chart, repo, version string) (string, func(), error) {
+	uri := "helm://" + chart + "?repo=" + repo
+	pin := helmPin(version)
+	if pin == "" && version != "" {
+		uri += "&version=" + version
 	}
+	p, c, _, err := withCache(uri, pin, nil, func() (string, func(), string, error) {
+		p, c, e := pullHelmChart(ctx, chart, repo, version)
+		return p, c, "", e
+	})
+	return p, c, err
+}
 
-	dir, err := os.MkdirTemp("", "many-helm-*")
+// pullHelmChart downloads and unpacks a chart with the Helm SDK. Repository
+// credentials and caches follow the usual HELM_* environment variables.
+// The SDK cannot be cancelled, so when ctx is done the pull is abandoned and
+// its temp dir removed once it returns (or by RemoveTempDirs).
+func pullHelmChart(ctx context.Context, chart, repo, version string) (string, func(), error) {
+	dir, cleanup, err := mkdirTemp("", "many-helm-*")
 	if err != nil {
-		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+		return "", nil, err
 	}
-	cleanup := func() { _ = os.RemoveAll(dir) }
 
-	args := []string{"pull", chart, "--repo", repo, "--untar", "-d", dir}
-	if version != "" {
-		args = append(args, "--version", version)
-	}
+	pull := action.NewPullWithOpts(action.WithConfig(new(action.Configuration)))
+	pull.Settings = cli.New()
+	pull.RepoURL = repo
+	pull.Version = version
+	pull.Untar = true
+	pull.DestDir = dir
+	pull.UntarDir = dir
 
-	cmd := exec.Command(helmPath, args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	done := make(chan error, 1)
+	go func() {
+		_, err := pull.Run(chart)
+		done <- err
+	}()
 
-	if err := cmd.Run(); err != nil {
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		go func() {
+			<-done
+			cleanup()
+		}()
+		return "", nil, fmt.Errorf("helm pull: %w", context.Cause(ctx))
+	}
+	if err != nil {
 		cleanup()
-		return "", nil, fmt.Errorf("helm pull failed: %w\nstderr: %s", err, stderr.String())
+		return "", nil, fmt.Errorf("helm pull failed: %w", err)
 	}
 
 	return unwrapSingleRoot(dir), cleanup, nil
@@ -1,29 +1,119 @@
 package resolve
 
 import (
-	"os/exec"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
-func TestResolveHelm_MissingBinary(t *testing.T) {
-	// Save PATH and set it to empty to ensure helm is not found.
-	t.Setenv("PATH", "")
+// serveChartRepo packages a minimal chart and serves it from a local chart
+// repository, returning the repository URL.
+func serveChartRepo(t *testing.T, name, version string) string {
+	t.Helper()
 
-	_, _, err := ResolveHelm("mychart", "https://charts.example.com", "1.0.0")
-	if err == nil {
-		t.Fatal("expected error when helm binary is missing")
+	src := filepath.Join(t.TempDir(), name)
+	if err := os.MkdirAll(filepath.Join(src, "templates"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"Chart.yaml":        "apiVersion: v2\nname: " + name + "\nversion: " + version + "\n",
+		"values.yaml":       "replicaCount: 1\n",
+		"templates/cm.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n",
+	}
+	for rel, content := range files {
+		if err := os.WriteFile(filepath.Join(src, rel), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chrt, err := loader.LoadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoDir := t.TempDir()
+	if _, err := chartutil.Save(chrt, repoDir); err != nil {
+		t.Fatal(err)
 	}
-	if got := err.Error(); !contains(got, "helm binary not found") {
-		t.Fatalf("unexpected error: %s", got)
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(srv.Close)
+
+	idx, err := repo.IndexDirectory(repoDir, srv.URL)
+	if err != nil {
+		t.Fatal(err)
 	}
+	if err := idx.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return srv.URL
 }
 
-func TestResolveHelm_InvalidChart(t *testing.T) {
-	if _, err := exec.LookPath("helm"); err != nil {
-		t.Skip("helm not installed, skipping")
+// isolateHelm points Helm's config and cache directories at a temp dir.
+func isolateHelm(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HELM_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("HELM_CACHE_HOME", filepath.Join(home, "cache"))
+	t.Setenv("HELM_DATA_HOME", filepath.Join(home, "data"))
+}
+
+func TestResolveHelm_PullsFromRepository(t *testing.T) {
+	isolateHelm(t)
+	repoURL := serveChartRepo(t, "mychart", "1.2.3")
+
+	dir, cleanup, err := ResolveHelm(t.Context(), "mychart", repoURL, "1.2.3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+
+	data, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		t.Fatalf("expected unpacked chart: %v", err)
+	}
+	if !contains(string(data), "version: 1.2.3") {
+		t.Errorf("unexpected Chart.yaml:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "templates", "cm.yaml")); err != nil {
+		t.Errorf("expected chart templates: %v", err)
+	}
+}
+
+func TestResolveHelm_LatestVersion(t *testing.T) {
+	isolateHelm(t)
+	repoURL := serveChartRepo(t, "mychart", "0.4.0")
+
+	dir, cleanup, err := ResolveHelm(t.Context(), "mychart", repoURL, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+
+	if _, err := os.Stat(filepath.Join(dir, "Chart.yaml")); err != nil {
+		t.Errorf("expected unpacked chart: %v", err)
+	}
+}
+
+func TestResolveHelm_UnknownVersion(t *testing.T) {
+	isolateHelm(t)
+	repoURL := serveChartRepo(t, "mychart", "1.0.0")
+
+	_, _, err := ResolveHelm(t.Context(), "mychart", repoURL, "9.9.9")
+	if err == nil || !contains(err.Error(), "helm pull failed") {
+		t.Fatalf("expected pull error, got %v", err)
 	}
+}
+
+func TestResolveHelm_InvalidChart(t *testing.T) {
+	isolateHelm(t)
 
-	_, _, err := ResolveHelm("nonexistent-chart", "https://127.0.0.1:1", "0.0.0")
+	_, _, err := ResolveHelm(t.Context(), "nonexistent-chart", "https://127.0.0.1:1", "0.0.0")
 	if err == nil {
 		t.Fatal("expected error for invalid chart repo")
 	}
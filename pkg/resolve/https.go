@@ -1,58 +1,166 @@
 package resolve
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strings"
-	"time"
 )
 
-var httpClient = &http.Client{Timeout: 5 * time.Minute}
+// httpClient has no timeout of its own; downloads are bounded by the context
+// passed to ResolveHTTPS (see WithTimeout).
+var httpClient = &http.Client{}
+
+// ResolveHTTPS downloads the resource at url and returns its local path along
+// with the sha256 hex digest of the downloaded content. archive selects how
+// the download is unpacked: "none" keeps it as a single file, a format name
+// ("zip", "tar", "tar.gz", "tar.xz", "tar.zst", "tar.bz2") forces that format,
+// and "" or "auto" detects the format from the URL's extension, falling back
+// to the file's magic bytes. headers are added to the request; their values
+// may reference environment variables as ${VAR}. Credentials for the URL's
+// host come from SetHTTPCredentials or ~/.netrc. Downloads with a sha256 are
+// served from the cache installed via SetCache, if any. Transient failures
+// are retried according to the policy set via SetRetryPolicy.
+func ResolveHTTPS(ctx context.Context, url, sha256, archive string, headers map[string]string) (string, func(), string, error) {
+	key := url
+	if archive != "" && archive != archiveAuto {
+		key += "#archive=" + archive
+	}
+	pinned := func(computed string) (string, string) { return key, computed }
+	return withCache(key, sha256, pinned, func() (string, func(), string, error) {
+		return resolveHTTPS(ctx, url, sha256, archive, headers)
+	})
+}
+
+// HashHTTPS downloads the resource at url, bypassing the cache and vendor
+// directory, and returns the sha256 hex digest of its content. Credentials,
+// headers and retries are handled as by ResolveHTTPS.
+func HashHTTPS(ctx context.Context, url string, headers map[string]string) (string, error) {
+	_, cleanup, computed, err := download(ctx, url, headers)
+	if err != nil {
+		return "", err
+	}
+	cleanup()
+	return computed, nil
+}
+
+// resolveHTTPS downloads the resource at the given URL. Archives are
+// extracted into a temp directory; everything else is kept as a single file.
+// The third return value is the computed sha256 hex digest of the downloaded
+// content, which is checked before anything is extracted.
+func resolveHTTPS(ctx context.Context, url, expectedSHA256, archive string, headers map[string]string) (string, func(), string, error) {
+	p, cleanup, computed, err := download(ctx, url, headers)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	if expectedSHA256 != "" && computed != expectedSHA256 {
+		cleanup()
+		return "", nil, "", fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", RedactURL(url), expectedSHA256, computed)
+	}
+
+	format, err := archiveFormat(p, url, archive)
+	if err != nil {
+		cleanup()
+		return "", nil, "", err
+	}
+	if format == "" {
+		return p, cleanup, computed, nil
+	}
+
+	dir, extractCleanup, err := extractDownload(p, format)
+	cleanup()
+	if err != nil {
+		return "", nil, "", err
+	}
+	return dir, extractCleanup, computed, nil
+}
+
+// download fetches url into a temp file and returns its path and sha256 hex
+// digest. Connection errors, 5xx and 429 responses and interrupted transfers
+// are retried with exponential backoff.
+func download(ctx context.Context, url string, headers map[string]string) (string, func(), string, error) {
+	req, err := newDownloadRequest(ctx, url, headers)
+	if err != nil {
+		return "", nil, "", err
+	}
+	client := *httpClient
+	client.CheckRedirect = redirectPolicy(req.URL, headers)
+
+	policy := activeRetryPolicy()
+	for attempt := 1; ; attempt++ {
+		p, cleanup, computed, resp, err := downloadOnce(&client, req.Clone(ctx), url)
+		if err == nil {
+			return p, cleanup, computed, nil
+		}
+		if ctx.Err() != nil || attempt >= policy.Attempts || (resp != nil && !isTransientStatus(resp.StatusCode)) {
+			return "", nil, "", err
+		}
+		delay := policy.backoff(attempt, resp)
+		slog.Warn("retrying download", "url", RedactURL(url), "attempt", attempt, "delay", delay, "error", err)
+		if err := sleep(ctx, delay); err != nil {
+			return "", nil, "", fmt.Errorf("HTTP GET %s: %w", RedactURL(url), err)
+		}
+	}
+}
 
-// resolveHTTPS downloads the resource at the given URL.
-// Tarball URLs (.tar.gz, .tgz) are extracted into a temp directory.
-// All other URLs are downloaded as a single file.
-// The third return value is the computed sha256 hex digest of the downloaded content.
-func resolveHTTPS(url, expectedSHA256 string) (string, func(), string, error) {
-	resp, err := httpClient.Get(url) //nolint:noctx // no long-lived context available
+// downloadOnce makes a single download attempt. On failure, the response is
+// returned when the server answered, so the caller can decide to retry.
+func downloadOnce(client *http.Client, req *http.Request, url string) (string, func(), string, *http.Response, error) {
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", nil, "", fmt.Errorf("HTTP GET %s: %w", url, err)
+		return "", nil, "", nil, fmt.Errorf("HTTP GET %s: %w", RedactURL(url), err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", nil, "", fmt.Errorf("HTTP GET %s: status %d", url, resp.StatusCode)
+		return "", nil, "", resp, fmt.Errorf("HTTP GET %s: status %d", RedactURL(url), resp.StatusCode)
 	}
 
 	hasher := sha256.New()
-	body := io.TeeReader(resp.Body, hasher)
+	p, cleanup, err := downloadSingleFile(io.TeeReader(resp.Body, hasher), url)
+	if err != nil {
+		// A broken transfer is as transient as a failed connection.
+		return "", nil, "", nil, err
+	}
+	return p, cleanup, hex.EncodeToString(hasher.Sum(nil)), nil, nil
+}
 
-	var p string
-	var cleanup func()
-	if isTarballURL(url) {
-		p, cleanup, err = downloadTarball(body)
-	} else {
-		p, cleanup, err = downloadSingleFile(body, url)
+// archiveFormat returns the format to extract the download at p with, or ""
+// to keep it as a file.
+func archiveFormat(p, url, archive string) (string, error) {
+	switch archive {
+	case archiveNone:
+		return "", nil
+	case "", archiveAuto:
+		if format := archiveFromName(urlPath(url)); format != "" {
+			return format, nil
+		}
+		return sniffArchive(p)
+	default:
+		return archive, nil
 	}
+}
+
+func extractDownload(p, format string) (string, func(), error) {
+	dir, cleanup, err := mkdirTemp("", "many-https-*")
 	if err != nil {
-		return "", nil, "", err
+		return "", nil, err
 	}
 
-	computed := hex.EncodeToString(hasher.Sum(nil))
-	if expectedSHA256 != "" && computed != expectedSHA256 {
-		if cleanup != nil {
-			cleanup()
-		}
-		return "", nil, "", fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", url, expectedSHA256, computed)
+	if err := extractArchive(p, format, dir); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("extracting %s archive: %w", format, err)
 	}
 
-	return p, cleanup, computed, nil
+	return unwrapSingleRoot(dir), cleanup, nil
 }
 
 // filenameFromURL extracts the last path segment from a URL, stripping query
@@ -68,8 +176,8 @@ func filenameFromURL(rawURL string) string {
 	return "download"
 }
 
-func isTarballURL(url string) bool {
-	// Strip query string and fragment before checking suffix.
+// urlPath strips the query string and fragment from url.
+func urlPath(url string) string {
 	path := url
 	if i := strings.Index(path, "?"); i != -1 {
 		path = path[:i]
@@ -77,30 +185,14 @@ func isTarballURL(url string) bool {
 	if i := strings.Index(path, "#"); i != -1 {
 		path = path[:i]
 	}
-	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
-}
-
-func downloadTarball(body io.Reader) (string, func(), error) {
-	dir, err := os.MkdirTemp("", "many-https-*")
-	if err != nil {
-		return "", nil, fmt.Errorf("creating temp dir: %w", err)
-	}
-	cleanup := func() { _ = os.RemoveAll(dir) }
-
-	if err := extractTarGz(body, dir); err != nil {
-		cleanup()
-		return "", nil, fmt.Errorf("extracting tarball: %w", err)
-	}
-
-	return unwrapSingleRoot(dir), cleanup, nil
+	return path
 }
 
 func downloadSingleFile(body io.Reader, rawURL string) (string, func(), error) {
-	dir, err := os.MkdirTemp("", "many-https-*")
+	dir, cleanup, err := mkdirTemp("", "many-https-*")
 	if err != nil {
-		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+		return "", nil, err
 	}
-	cleanup := func() { _ = os.RemoveAll(dir) }
 
 	filePath := dir + "/" + filenameFromURL(rawURL)
 	f, err := os.Create(filePath)
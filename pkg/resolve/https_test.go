@@ -26,7 +26,7 @@ func TestResolveHTTPS_Tarball(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	path, cleanup, computed, err := resolveHTTPS(srv.URL+"/repo.tar.gz", "")
+	path, cleanup, computed, err := resolveHTTPS(t.Context(), srv.URL+"/repo.tar.gz", "", "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -61,7 +61,7 @@ func TestResolveHTTPS_SingleFile(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	path, cleanup, computed, err := resolveHTTPS(srv.URL+"/context.yaml", "")
+	path, cleanup, computed, err := resolveHTTPS(t.Context(), srv.URL+"/context.yaml", "", "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -94,7 +94,7 @@ func TestResolveHTTPS_404(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	_, _, _, err := resolveHTTPS(srv.URL+"/missing.yaml", "")
+	_, _, _, err := resolveHTTPS(t.Context(), srv.URL+"/missing.yaml", "", "", nil)
 	if err == nil {
 		t.Fatal("expected error for 404, got nil")
 	}
@@ -110,7 +110,7 @@ func TestResolveHTTPS_Cleanup(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	path, cleanup, _, err := resolveHTTPS(srv.URL+"/file.txt", "")
+	path, cleanup, _, err := resolveHTTPS(t.Context(), srv.URL+"/file.txt", "", "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -139,7 +139,7 @@ func TestResolveHTTPS_TarballCleanup(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	path, cleanup, _, err := resolveHTTPS(srv.URL+"/archive.tar.gz", "")
+	path, cleanup, _, err := resolveHTTPS(t.Context(), srv.URL+"/archive.tar.gz", "", "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -156,23 +156,32 @@ func TestResolveHTTPS_TarballCleanup(t *testing.T) {
 	}
 }
 
-func TestIsTarballURL(t *testing.T) {
+func TestArchiveFromURL(t *testing.T) {
 	tests := []struct {
 		url  string
-		want bool
+		want string
 	}{
-		{"https://example.com/archive.tar.gz", true},
-		{"https://example.com/archive.tgz", true},
-		{"https://example.com/archive.tar.gz?token=abc", true},
-		{"https://example.com/archive.tgz#section", true},
-		{"https://example.com/archive.tar.gz?a=1#frag", true},
-		{"https://example.com/file.yaml", false},
-		{"https://example.com/file.txt", false},
-		{"https://example.com/file.yaml#tar.gz", false},
+		{"https://example.com/archive.tar.gz", archiveTarGz},
+		{"https://example.com/archive.tgz", archiveTarGz},
+		{"https://example.com/archive.tar.gz?token=abc", archiveTarGz},
+		{"https://example.com/archive.tgz#section", archiveTarGz},
+		{"https://example.com/archive.tar.gz?a=1#frag", archiveTarGz},
+		{"https://example.com/archive.TAR.GZ", archiveTarGz},
+		{"https://example.com/archive.tar.xz", archiveTarXz},
+		{"https://example.com/archive.txz", archiveTarXz},
+		{"https://example.com/archive.tar.zst", archiveTarZst},
+		{"https://example.com/archive.tar.bz2", archiveTarBz2},
+		{"https://example.com/archive.tbz2", archiveTarBz2},
+		{"https://example.com/archive.tar", archiveTar},
+		{"https://example.com/archive.zip", archiveZip},
+		{"https://example.com/file.yaml", ""},
+		{"https://example.com/file.txt", ""},
+		{"https://example.com/file.yaml#tar.gz", ""},
+		{"https://example.com/download", ""},
 	}
 	for _, tt := range tests {
-		if got := isTarballURL(tt.url); got != tt.want {
-			t.Errorf("isTarballURL(%q) = %v, want %v", tt.url, got, tt.want)
+		if got := archiveFromName(urlPath(tt.url)); got != tt.want {
+			t.Errorf("archiveFromName(urlPath(%q)) = %q, want %q", tt.url, got, tt.want)
 		}
 	}
 }
@@ -207,7 +216,7 @@ func TestResolveHTTPS_SingleFilePreservesName(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	path, cleanup, _, err := resolveHTTPS(srv.URL+"/path/to/some-operator.yaml", "")
+	path, cleanup, _, err := resolveHTTPS(t.Context(), srv.URL+"/path/to/some-operator.yaml", "", "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -219,7 +228,8 @@ func TestResolveHTTPS_SingleFilePreservesName(t *testing.T) {
 }
 
 func TestResolveHTTPS_ConnectionRefused(t *testing.T) {
-	_, _, _, err := resolveHTTPS("https://127.0.0.1:1/nope.yaml", "")
+	noRetries(t)
+	_, _, _, err := resolveHTTPS(t.Context(), "https://127.0.0.1:1/nope.yaml", "", "", nil)
 	if err == nil {
 		t.Fatal("expected error for connection refused")
 	}
@@ -235,7 +245,7 @@ func TestResolveHTTPS_SHA256Match(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	path, cleanup, computed, err := resolveHTTPS(srv.URL+"/file.yaml", checksum)
+	path, cleanup, computed, err := resolveHTTPS(t.Context(), srv.URL+"/file.yaml", checksum, "", nil)
 	if err != nil {
 		t.Fatalf("expected no error, got: %v", err)
 	}
@@ -263,7 +273,7 @@ func TestResolveHTTPS_SHA256Mismatch(t *testing.T) {
 	defer srv.Close()
 
 	wrongHash := "0000000000000000000000000000000000000000000000000000000000000000"
-	_, _, _, err := resolveHTTPS(srv.URL+"/file.yaml", wrongHash)
+	_, _, _, err := resolveHTTPS(t.Context(), srv.URL+"/file.yaml", wrongHash, "", nil)
 	if err == nil {
 		t.Fatal("expected error for sha256 mismatch, got nil")
 	}
@@ -280,3 +290,29 @@ func TestResolveHTTPS_SHA256Mismatch(t *testing.T) {
 		t.Errorf("expected actual hash %q in error, got %q", actual, err.Error())
 	}
 }
+
+func TestHashHTTPS_BypassesCache(t *testing.T) {
+	useTestCache(t)
+	content := []byte("kind: ConfigMap\n")
+	sum := sha256.Sum256(content)
+	pin := hex.EncodeToString(sum[:])
+	srv, hits := countingServer(t, content)
+	url := srv.URL + "/config.yaml"
+
+	_, cleanup, _, err := ResolveHTTPS(t.Context(), url, pin, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+
+	got, err := HashHTTPS(t.Context(), url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != pin {
+		t.Errorf("HashHTTPS = %s, want %s", got, pin)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected 2 downloads, got %d", n)
+	}
+}
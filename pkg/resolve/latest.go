@@ -0,0 +1,226 @@
+package resolve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotSemver is returned when a source's current version is not a semantic
+// version, so newer ones cannot be told apart.
+var ErrNotSemver = errors.New("not a semantic version")
+
+// githubReleasePath matches the path of a GitHub release asset download:
+// /{owner}/{repo}/releases/download/{tag}/{asset}.
+var githubReleasePath = regexp.MustCompile(`^/([^/]+)/([^/]+)/releases/download/([^/]+)/([^/]+)$`)
+
+// LatestHelmVersion returns the newest version of chart in repo that is newer
+// than current, or "" if there is none. Classic repositories are queried via
+// their index.yaml, OCI repositories ("oci://...") by listing tags.
+func LatestHelmVersion(ctx context.Context, chart, repo, current string) (string, error) {
+	if rest, ok := strings.CutPrefix(repo, "oci://"); ok {
+		tags, err := listTags(ctx, strings.TrimSuffix(rest, "/")+"/"+chart)
+		if err != nil {
+			return "", err
+		}
+		return newestVersion(current, tags)
+	}
+
+	indexURL := strings.TrimSuffix(repo, "/") + "/index.yaml"
+	data, err := fetchDocument(ctx, indexURL)
+	if err != nil {
+		return "", err
+	}
+	var index struct {
+		Entries map[string][]struct {
+			Version string `yaml:"version"`
+		} `yaml:"entries"`
+	}
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return "", fmt.Errorf("parsing %s: %w", RedactURL(indexURL), err)
+	}
+	charts, ok := index.Entries[chart]
+	if !ok {
+		return "", fmt.Errorf("chart %q not found in %s", chart, RedactURL(repo))
+	}
+	versions := make([]string, 0, len(charts))
+	for _, c := range charts {
+		versions = append(versions, c.Version)
+	}
+	return newestVersion(current, versions)
+}
+
+// LatestOCI returns the reference with the newest tag of ref's repository
+// that is newer than ref's own tag, and that tag's manifest digest. It
+// returns "" if there is no newer tag.
+func LatestOCI(ctx context.Context, ref string) (string, string, error) {
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing OCI reference %q: %w", ref, err)
+	}
+	repo := strings.TrimSuffix(ref, ":"+tag.TagStr())
+	tags, err := listTags(ctx, repo)
+	if err != nil {
+		return "", "", err
+	}
+	newest, err := newestVersion(tag.TagStr(), tags)
+	if err != nil || newest == "" {
+		return "", "", err
+	}
+
+	newRef := repo + ":" + newest
+	parsed, err := name.ParseReference(newRef)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing OCI reference %q: %w", newRef, err)
+	}
+	desc, err := remote.Head(parsed, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return "", "", fmt.Errorf("fetching OCI manifest for %q: %w", newRef, err)
+	}
+	return newRef, desc.Digest.String(), nil
+}
+
+// LatestGitHubRelease returns rawURL with its release tag, and the version in
+// its asset name, replaced by those of the newest release that is newer and
+// has an asset of that name, or "" if there is none. rawURL must have the
+// form https://{host}/{owner}/{repo}/releases/download/{tag}/{asset};
+// releases are listed through the GitHub API of the host (api.github.com for
+// github.com, /api/v3 on GitHub Enterprise). It reports false if rawURL is
+// not a release download.
+func LatestGitHubRelease(ctx context.Context, rawURL string) (string, bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, nil
+	}
+	m := githubReleasePath.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", false, nil
+	}
+	owner, repo, tag, asset := m[1], m[2], m[3], m[4]
+
+	apiBase := u.Scheme + "://" + u.Host + "/api/v3"
+	if u.Host == "github.com" {
+		apiBase = "https://api.github.com"
+	}
+	data, err := fetchDocument(ctx, apiBase+"/repos/"+owner+"/"+repo+"/releases?per_page=100")
+	if err != nil {
+		return "", true, err
+	}
+	var releases []struct {
+		TagName    string `json:"tag_name"`
+		Draft      bool   `json:"draft"`
+		Prerelease bool   `json:"prerelease"`
+		Assets     []struct {
+			Name string `json:"name"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return "", true, fmt.Errorf("parsing releases of %s/%s: %w", owner, repo, err)
+	}
+
+	// Release tags are usually "v" plus the version used in asset names.
+	version := strings.TrimPrefix(tag, "v")
+	assets := make(map[string]string) // tag -> asset name for that release
+	tags := make([]string, 0, len(releases))
+	for _, r := range releases {
+		if r.Draft || (r.Prerelease && !strings.Contains(tag, "-")) {
+			continue
+		}
+		want := strings.ReplaceAll(asset, version, strings.TrimPrefix(r.TagName, "v"))
+		for _, a := range r.Assets {
+			if a.Name == want {
+				assets[r.TagName] = want
+				tags = append(tags, r.TagName)
+				break
+			}
+		}
+	}
+	newest, err := newestVersion(tag, tags)
+	if err != nil || newest == "" {
+		return "", true, err
+	}
+
+	u.Path = strings.Join([]string{"", owner, repo, "releases", "download", newest, assets[newest]}, "/")
+	u.RawPath = ""
+	return u.String(), true, nil
+}
+
+// newestVersion returns the highest of candidates that is newer than current,
+// or "" if none is. Only candidates written like current are considered: with
+// the same "v" prefix and number of version components, so floating tags such
+// as "1.2" never replace "1.2.3". Prereleases are only considered when current
+// is one.
+func newestVersion(current string, candidates []string) (string, error) {
+	cur, err := semver.NewVersion(current)
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", current, ErrNotSemver)
+	}
+	shape := versionShape(current)
+
+	var best *semver.Version
+	var newest string
+	for _, c := range candidates {
+		if versionShape(c) != shape {
+			continue
+		}
+		v, err := semver.NewVersion(c)
+		if err != nil || (v.Prerelease() != "" && cur.Prerelease() == "") {
+			continue
+		}
+		if v.GreaterThan(cur) && (best == nil || v.GreaterThan(best)) {
+			best, newest = v, c
+		}
+	}
+	return newest, nil
+}
+
+// versionShape describes how a version is written: its "v" prefix and the
+// number of dot-separated components before any prerelease or build suffix.
+func versionShape(v string) string {
+	core, _, _ := strings.Cut(v, "-")
+	core, _, _ = strings.Cut(core, "+")
+	prefix := ""
+	if strings.HasPrefix(core, "v") {
+		prefix = "v"
+	}
+	return fmt.Sprintf("%s%d", prefix, strings.Count(core, ".")+1)
+}
+
+// listTags lists the tags of an OCI repository.
+func listTags(ctx context.Context, repo string) ([]string, error) {
+	r, err := name.NewRepository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OCI repository %q: %w", repo, err)
+	}
+	tags, err := remote.List(r, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, fmt.Errorf("listing tags of %q: %w", repo, err)
+	}
+	return tags, nil
+}
+
+// fetchDocument downloads a small document such as a repository index, with
+// the credentials and retries of https sources.
+func fetchDocument(ctx context.Context, rawURL string) ([]byte, error) {
+	p, cleanup, _, err := download(ctx, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", RedactURL(rawURL), err)
+	}
+	return data, nil
+}
@@ -0,0 +1,129 @@
+package resolve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewestVersion(t *testing.T) {
+	tests := []struct {
+		current    string
+		candidates []string
+		want       string
+	}{
+		{"1.0.0", []string{"0.9.0", "1.0.0", "1.2.0", "1.10.0"}, "1.10.0"},
+		{"1.0.0", []string{"1.0.0", "0.1.0"}, ""},
+		{"v1.0.0", []string{"1.5.0", "v1.1.0", "v2", "latest"}, "v1.1.0"},
+		{"1.0.0", []string{"1.1", "2", "1.0.1"}, "1.0.1"},
+		{"1.0.0", []string{"2.0.0-rc.1", "1.1.0"}, "1.1.0"},
+		{"1.0.0-rc.1", []string{"1.0.0-rc.2"}, "1.0.0-rc.2"},
+	}
+	for _, tt := range tests {
+		got, err := newestVersion(tt.current, tt.candidates)
+		if err != nil {
+			t.Errorf("newestVersion(%q): %v", tt.current, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("newestVersion(%q, %v) = %q, want %q", tt.current, tt.candidates, got, tt.want)
+		}
+	}
+}
+
+func TestNewestVersion_NotSemver(t *testing.T) {
+	for _, current := range []string{"latest", "^1.2.0", "main"} {
+		if _, err := newestVersion(current, []string{"1.0.0"}); !errors.Is(err, ErrNotSemver) {
+			t.Errorf("newestVersion(%q): expected ErrNotSemver, got %v", current, err)
+		}
+	}
+}
+
+func TestLatestHelmVersion(t *testing.T) {
+	index := `apiVersion: v1
+entries:
+  mychart:
+    - version: 2.0.0-rc.1
+    - version: 1.10.0
+    - version: 1.2.0
+    - version: 1.0.0
+  other:
+    - version: 9.0.0
+`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/charts/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(index))
+	}))
+	t.Cleanup(srv.Close)
+
+	got, err := LatestHelmVersion(t.Context(), "mychart", srv.URL+"/charts/", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "1.10.0" {
+		t.Errorf("got %q, want 1.10.0", got)
+	}
+
+	if _, err := LatestHelmVersion(t.Context(), "missing", srv.URL+"/charts", "1.0.0"); err == nil {
+		t.Error("expected error for a chart missing from the index")
+	}
+}
+
+func TestLatestOCI(t *testing.T) {
+	host := startRegistry(t, nil)
+	repo := host + "/manifests"
+	var want string
+	for _, tag := range []string{"1.0.0", "1.1.0", "1.1", "latest"} {
+		d := pushImage(t, repo+":"+tag, imageWithFiles(t, map[string]string{"app.yaml": "version: " + tag + "\n"}))
+		if tag == "1.1.0" {
+			want = d
+		}
+	}
+
+	ref, digest, err := LatestOCI(t.Context(), repo+":1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != repo+":1.1.0" || digest != want {
+		t.Errorf("got %s@%s, want %s:1.1.0@%s", ref, digest, repo, want)
+	}
+
+	ref, _, err = LatestOCI(t.Context(), repo+":1.1.0")
+	if err != nil || ref != "" {
+		t.Errorf("expected no newer tag, got %q, %v", ref, err)
+	}
+}
+
+func TestLatestGitHubRelease(t *testing.T) {
+	releases := `[
+  {"tag_name": "v1.4.0", "assets": [{"name": "tool_1.4.0_darwin.tar.gz"}]},
+  {"tag_name": "v1.3.0", "draft": true, "assets": [{"name": "tool_1.3.0_linux.tar.gz"}]},
+  {"tag_name": "v1.3.0-rc.1", "prerelease": true, "assets": [{"name": "tool_1.3.0-rc.1_linux.tar.gz"}]},
+  {"tag_name": "v1.2.0", "assets": [{"name": "tool_1.2.0_linux.tar.gz"}, {"name": "tool_1.2.0_darwin.tar.gz"}]},
+  {"tag_name": "v1.0.0", "assets": [{"name": "tool_1.0.0_linux.tar.gz"}]}
+]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/org/tool/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(releases))
+	}))
+	t.Cleanup(srv.Close)
+
+	got, ok, err := LatestGitHubRelease(t.Context(), srv.URL+"/org/tool/releases/download/v1.0.0/tool_1.0.0_linux.tar.gz")
+	if err != nil || !ok {
+		t.Fatalf("ok = %v, err = %v", ok, err)
+	}
+	if want := srv.URL + "/org/tool/releases/download/v1.2.0/tool_1.2.0_linux.tar.gz"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, ok, err := LatestGitHubRelease(t.Context(), srv.URL+"/files/tool.tar.gz"); ok || err != nil {
+		t.Errorf("expected non-release URL to be skipped, got ok = %v, err = %v", ok, err)
+	}
+}
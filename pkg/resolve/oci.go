@@ -1,52 +1,178 @@
 package resolve
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
-// resolveOCI pulls an OCI image using crane export and extracts the flattened
-// filesystem into a temp directory.
-func resolveOCI(ref string) (string, func(), error) {
-	cranePath, err := exec.LookPath("crane")
-	if err != nil {
-		return "", nil, fmt.Errorf("crane binary not found in PATH — install with: go install github.com/google/go-containerregistry/cmd/crane@latest")
+const (
+	// orasTitleAnnotation names the file a layer was pushed from.
+	orasTitleAnnotation = "org.opencontainers.image.title"
+	// orasUnpackAnnotation marks a layer holding a gzipped tar of a directory.
+	orasUnpackAnnotation = "io.deis.oras.content.unpack"
+)
+
+// ResolveOCI pulls an OCI image or artifact into a temp directory and returns
+// its path along with the manifest digest. When digest is set it is pulled
+// instead of the reference's tag, which makes the source immutable and
+// cacheable. Registry credentials are read from the Docker config
+// (~/.docker/config.json or $DOCKER_CONFIG).
+func ResolveOCI(ctx context.Context, ref, digest string) (string, func(), string, error) {
+	pin := digest
+	if pin == "" {
+		pin = ociPin(ref)
+	}
+	if digest != "" {
+		if i := strings.Index(ref, "@"); i >= 0 {
+			ref = ref[:i]
+		}
+		ref += "@" + digest
 	}
 
-	dir, err := os.MkdirTemp("", "many-oci-*")
+	pinned := func(digest string) (string, string) { return "oci://" + ref + "@" + digest, digest }
+	return withCache("oci://"+ref, pin, pinned, func() (string, func(), string, error) {
+		return pullOCI(ctx, ref)
+	})
+}
+
+// resolveOCI pulls ref without a digest pin.
+func resolveOCI(ctx context.Context, ref string) (string, func(), error) {
+	path, cleanup, _, err := ResolveOCI(ctx, ref, "")
+	return path, cleanup, err
+}
+
+func pullOCI(ctx context.Context, ref string) (string, func(), string, error) {
+	parsed, err := name.ParseReference(ref)
 	if err != nil {
-		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+		return "", nil, "", fmt.Errorf("parsing OCI reference %q: %w", ref, err)
 	}
-	cleanup := func() { _ = os.RemoveAll(dir) }
 
-	cmd := exec.Command(cranePath, "export", ref, "-")
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	desc, err := remote.Get(parsed, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return "", nil, "", fmt.Errorf("fetching OCI manifest for %q: %w", ref, err)
+	}
+	// For an image index this selects the linux/amd64 image.
+	img, err := desc.Image()
+	if err != nil {
+		return "", nil, "", fmt.Errorf("reading OCI image %q: %w", ref, err)
+	}
 
-	stdout, err := cmd.StdoutPipe()
+	dir, cleanup, err := mkdirTemp("", "many-oci-*")
 	if err != nil {
-		cleanup()
-		return "", nil, fmt.Errorf("creating stdout pipe: %w", err)
+		return "", nil, "", err
 	}
 
-	if err := cmd.Start(); err != nil {
+	if err := extractOCI(img, dir); err != nil {
 		cleanup()
-		return "", nil, fmt.Errorf("starting crane export: %w", err)
+		return "", nil, "", fmt.Errorf("extracting %q: %w", ref, err)
 	}
 
-	// crane export produces an uncompressed tar.
-	if err := extractTar(stdout, dir); err != nil {
-		_ = cmd.Wait()
-		cleanup()
-		return "", nil, fmt.Errorf("extracting crane output: %w\nstderr: %s", err, stderr.String())
+	return unwrapSingleRoot(dir), cleanup, desc.Digest.String(), nil
+}
+
+// extractOCI writes the content of img into dir. Container images are
+// flattened into a single filesystem; other artifacts have each layer handled by
+// its media type and annotations.
+func extractOCI(img v1.Image, dir string) error {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
 	}
 
-	if err := cmd.Wait(); err != nil {
-		cleanup()
-		return "", nil, fmt.Errorf("crane export failed: %w\nstderr: %s", err, stderr.String())
+	switch manifest.Config.MediaType {
+	case types.DockerConfigJSON, types.OCIConfigJSON:
+		if !hasTitledLayers(manifest.Layers) {
+			rc := mutate.Extract(img)
+			defer func() { _ = rc.Close() }()
+			return extractTar(rc, dir)
+		}
 	}
 
-	return unwrapSingleRoot(dir), cleanup, nil
+	for _, ld := range manifest.Layers {
+		if err := extractArtifactLayer(img, ld, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasTitledLayers(layers []v1.Descriptor) bool {
+	for _, l := range layers {
+		if l.Annotations[orasTitleAnnotation] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// extractArtifactLayer handles one artifact layer. A titled layer is a file
+// named by its title, unless ORAS marked it as a packed directory. Untitled
+// layers must be tar archives (optionally compressed), such as Flux content.
+func extractArtifactLayer(img v1.Image, ld v1.Descriptor, dir string) error {
+	layer, err := img.LayerByDigest(ld.Digest)
+	if err != nil {
+		return fmt.Errorf("reading layer %s: %w", ld.Digest, err)
+	}
+
+	title := ld.Annotations[orasTitleAnnotation]
+	switch {
+	case title != "" && ld.Annotations[orasUnpackAnnotation] != "true":
+		return writeLayerFile(layer, dir, title)
+	case title != "" || isTarMediaType(ld.MediaType):
+		rc, err := layer.Uncompressed()
+		if err != nil {
+			return fmt.Errorf("reading layer %s: %w", ld.Digest, err)
+		}
+		defer func() { _ = rc.Close() }()
+		if err := extractTar(rc, dir); err != nil {
+			return fmt.Errorf("extracting layer %s: %w", ld.Digest, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("layer %s has unsupported media type %q and no %s annotation", ld.Digest, ld.MediaType, orasTitleAnnotation)
+	}
+}
+
+func isTarMediaType(mt types.MediaType) bool {
+	return strings.Contains(string(mt), "tar")
+}
+
+func writeLayerFile(layer v1.Layer, dir, title string) error {
+	if !filepath.IsLocal(title) {
+		return fmt.Errorf("layer title %q is not a local path", title)
+	}
+	target := filepath.Join(dir, title)
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return fmt.Errorf("creating directory for %s: %w", title, err)
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("reading layer for %s: %w", title, err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", title, err)
+	}
+	if _, err := io.Copy(f, io.LimitReader(rc, maxFileSize)); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing %s: %w", title, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", title, err)
+	}
+	return nil
 }
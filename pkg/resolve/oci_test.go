@@ -1,48 +1,295 @@
 package resolve
 
 import (
-	"os/exec"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
-func skipWithoutCrane(t *testing.T) {
+// startRegistry runs an in-process OCI registry and returns its host.
+func startRegistry(t *testing.T, wrap func(http.Handler) http.Handler) string {
+	t.Helper()
+	var h http.Handler = registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	// Keep the test independent of the developer's Docker credentials.
+	if os.Getenv("DOCKER_CONFIG") == "" {
+		t.Setenv("DOCKER_CONFIG", t.TempDir())
+	}
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// tarBytes builds an uncompressed tar archive holding files.
+func tarBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pushImage pushes img to ref and returns its digest.
+func pushImage(t *testing.T, ref string, img v1.Image) string {
+	t.Helper()
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(r, img); err != nil {
+		t.Fatalf("pushing %s: %v", ref, err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.String()
+}
+
+// imageWithFiles builds a container image whose layers hold the given files.
+func imageWithFiles(t *testing.T, layers ...map[string]string) v1.Image {
 	t.Helper()
-	if _, err := exec.LookPath("crane"); err != nil {
-		t.Skip("crane not in PATH")
+	img := empty.Image
+	for _, files := range layers {
+		data := tarBytes(t, files)
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img, err = mutate.AppendLayers(img, layer); err != nil {
+			t.Fatal(err)
+		}
 	}
+	return img
 }
 
-func TestResolveOCI_MissingCrane(t *testing.T) {
-	// Only run this test if crane is NOT available.
-	if _, err := exec.LookPath("crane"); err == nil {
-		t.Skip("crane is available, skipping missing-crane test")
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected %s to exist: %v", path, err)
 	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", path, data, want)
+	}
+}
 
-	_, _, err := resolveOCI("registry.example.com/repo:tag")
-	if err == nil {
-		t.Fatal("expected error when crane is missing, got nil")
+func TestResolveOCI_Image(t *testing.T) {
+	host := startRegistry(t, nil)
+	img := imageWithFiles(t,
+		map[string]string{"manifests/app.yaml": "v: 1\n", "README": "base"},
+		map[string]string{"manifests/app.yaml": "v: 2\n"},
+	)
+	digest := pushImage(t, host+"/config:v1", img)
+
+	dir, cleanup, got, err := ResolveOCI(t.Context(), host+"/config:v1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if !strings.Contains(err.Error(), "crane binary not found") {
-		t.Errorf("expected 'crane binary not found' error, got %q", err.Error())
+	defer cleanup()
+
+	if got != digest {
+		t.Errorf("digest = %q, want %q", got, digest)
 	}
+	assertFile(t, filepath.Join(dir, "manifests", "app.yaml"), "v: 2\n")
+	assertFile(t, filepath.Join(dir, "README"), "base")
 }
 
-func TestResolveOCI_Integration(t *testing.T) {
-	skipWithoutCrane(t)
+func TestResolveOCI_DigestPin(t *testing.T) {
+	host := startRegistry(t, nil)
+	first := pushImage(t, host+"/config:latest", imageWithFiles(t, map[string]string{"app.yaml": "first"}))
+	pushImage(t, host+"/config:latest", imageWithFiles(t, map[string]string{"app.yaml": "second"}))
 
-	if testing.Short() {
-		t.Skip("skipping integration test in short mode")
+	dir, cleanup, got, err := ResolveOCI(t.Context(), host+"/config:latest", first)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
+	defer cleanup()
 
-	// Pull a small public image (busybox is ~2MB).
-	path, cleanup, err := resolveOCI("busybox:latest")
+	if got != first {
+		t.Errorf("digest = %q, want %q", got, first)
+	}
+	assertFile(t, filepath.Join(dir, "app.yaml"), "first")
+}
+
+func TestResolveOCI_FluxArtifact(t *testing.T) {
+	host := startRegistry(t, nil)
+	content := gzipBytes(t, tarBytes(t, map[string]string{"deploy/app.yaml": "kind: Deployment\n"}))
+	img, err := mutate.Append(
+		mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), "application/vnd.cncf.flux.config.v1+json"),
+		mutate.Addendum{Layer: static.NewLayer(content, "application/vnd.cncf.flux.content.v1.tar+gzip")},
+	)
 	if err != nil {
 		t.Fatal(err)
 	}
+	pushImage(t, host+"/flux:v1", img)
+
+	dir, cleanup, _, err := ResolveOCI(t.Context(), host+"/flux:v1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+
+	assertFile(t, filepath.Join(dir, "app.yaml"), "kind: Deployment\n")
+}
+
+func TestResolveOCI_ORASArtifact(t *testing.T) {
+	host := startRegistry(t, nil)
+	packed := gzipBytes(t, tarBytes(t, map[string]string{"overlays/prod.yaml": "env: prod\n"}))
+	img, err := mutate.Append(
+		mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), "application/vnd.oras.config.v1+json"),
+		mutate.Addendum{
+			Layer:       static.NewLayer([]byte("kind: ConfigMap\n"), "application/vnd.oci.image.layer.v1.tar"),
+			Annotations: map[string]string{orasTitleAnnotation: "cm.yaml"},
+		},
+		mutate.Addendum{
+			Layer:       static.NewLayer(packed, "application/vnd.oci.image.layer.v1.tar+gzip"),
+			Annotations: map[string]string{orasTitleAnnotation: "overlays", orasUnpackAnnotation: "true"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushImage(t, host+"/oras:v1", img)
+
+	dir, cleanup, _, err := ResolveOCI(t.Context(), host+"/oras:v1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	defer cleanup()
 
-	if path == "" {
-		t.Fatal("expected non-empty path")
+	assertFile(t, filepath.Join(dir, "cm.yaml"), "kind: ConfigMap\n")
+	assertFile(t, filepath.Join(dir, "overlays", "prod.yaml"), "env: prod\n")
+}
+
+func TestResolveOCI_UnsupportedLayer(t *testing.T) {
+	host := startRegistry(t, nil)
+	img, err := mutate.Append(
+		mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), "application/vnd.example.config.v1+json"),
+		mutate.Addendum{Layer: static.NewLayer([]byte("{}"), "application/vnd.example.blob.v1+json")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushImage(t, host+"/blob:v1", img)
+
+	_, _, _, err = ResolveOCI(t.Context(), host+"/blob:v1", "")
+	if err == nil || !strings.Contains(err.Error(), "unsupported media type") {
+		t.Fatalf("expected unsupported media type error, got %v", err)
+	}
+}
+
+func TestResolveOCI_UnsafeTitle(t *testing.T) {
+	host := startRegistry(t, nil)
+	img, err := mutate.Append(
+		mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), "application/vnd.oras.config.v1+json"),
+		mutate.Addendum{
+			Layer:       static.NewLayer([]byte("x"), "application/vnd.oci.image.layer.v1.tar"),
+			Annotations: map[string]string{orasTitleAnnotation: "../escape.yaml"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
 	}
+	pushImage(t, host+"/evil:v1", img)
+
+	_, _, _, err = ResolveOCI(t.Context(), host+"/evil:v1", "")
+	if err == nil || !strings.Contains(err.Error(), "not a local path") {
+		t.Fatalf("expected unsafe title error, got %v", err)
+	}
+}
+
+func TestResolveOCI_DockerConfigCredentials(t *testing.T) {
+	host := startRegistry(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "robot" || pass != "s3cret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	configDir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("robot:s3cret"))
+	config := `{"auths":{"` + host + `":{"auth":"` + auth + `"}}}`
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", configDir)
+
+	r, err := name.ParseReference(host + "/private:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := imageWithFiles(t, map[string]string{"secret.yaml": "ok"})
+	if err := remote.Write(r, img, remote.WithAuth(&basicAuth{"robot", "s3cret"})); err != nil {
+		t.Fatalf("pushing: %v", err)
+	}
+
+	dir, cleanup, _, err := ResolveOCI(t.Context(), host+"/private:v1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+	assertFile(t, filepath.Join(dir, "secret.yaml"), "ok")
+
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	if _, _, _, err := ResolveOCI(t.Context(), host+"/private:v1", ""); err == nil {
+		t.Fatal("expected an authentication error without credentials")
+	}
+}
+
+type basicAuth struct{ user, pass string }
+
+func (b *basicAuth) Authorization() (*authn.AuthConfig, error) {
+	return &authn.AuthConfig{Username: b.user, Password: b.pass}, nil
 }
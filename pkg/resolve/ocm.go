@@ -2,8 +2,8 @@ package resolve
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"os"
 	"os/exec"
 	"strings"
 
@@ -11,19 +11,18 @@ import (
 )
 
 // resolveOCM downloads OCM component resources using the ocm CLI.
-func resolveOCM(ref string) (string, func(), error) {
+func resolveOCM(ctx context.Context, ref string) (string, func(), error) {
 	ocmPath, err := exec.LookPath("ocm")
 	if err != nil {
 		return "", nil, fmt.Errorf("ocm binary not found in PATH — install from: https://ocm.software/docs/getting-started/installing-the-ocm-cli/")
 	}
 
-	dir, err := os.MkdirTemp("", "many-ocm-*")
+	dir, cleanup, err := mkdirTemp("", "many-ocm-*")
 	if err != nil {
-		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+		return "", nil, err
 	}
-	cleanup := func() { _ = os.RemoveAll(dir) }
 
-	cmd := exec.Command(ocmPath, "download", "resources", ref, "-O", dir)
+	cmd := exec.CommandContext(ctx, ocmPath, "download", "resources", ref, "-O", dir)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
@@ -37,33 +36,41 @@ func resolveOCM(ref string) (string, func(), error) {
 
 // ResolveOCMRecursive downloads resources for the given OCM component reference
 // and all its component references, merging everything into a single temp directory.
-func ResolveOCMRecursive(ref string) (string, func(), error) {
+// Versioned references are served from the source cache, if one is installed.
+func ResolveOCMRecursive(ctx context.Context, ref string) (string, func(), error) {
+	p, c, _, err := withCache("ocm://"+ref+"?recursive", ocmPin(ref), nil, func() (string, func(), string, error) {
+		p, c, e := resolveOCMRecursive(ctx, ref)
+		return p, c, "", e
+	})
+	return p, c, err
+}
+
+func resolveOCMRecursive(ctx context.Context, ref string) (string, func(), error) {
 	ocmPath, err := exec.LookPath("ocm")
 	if err != nil {
 		return "", nil, fmt.Errorf("ocm binary not found in PATH — install from: https://ocm.software/docs/getting-started/installing-the-ocm-cli/")
 	}
 
-	dir, err := os.MkdirTemp("", "many-ocm-recursive-*")
+	dir, cleanup, err := mkdirTemp("", "many-ocm-recursive-*")
 	if err != nil {
-		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+		return "", nil, err
 	}
-	cleanup := func() { _ = os.RemoveAll(dir) }
 
 	// Download resources for the main component.
-	if err := downloadOCMResources(ocmPath, ref, dir); err != nil {
+	if err := downloadOCMResources(ctx, ocmPath, ref, dir); err != nil {
 		cleanup()
 		return "", nil, fmt.Errorf("downloading main component: %w", err)
 	}
 
 	// Discover and download referenced sub-components.
-	refs, err := getOCMReferences(ocmPath, ref)
+	refs, err := getOCMReferences(ctx, ocmPath, ref)
 	if err != nil {
 		cleanup()
 		return "", nil, fmt.Errorf("getting component references: %w", err)
 	}
 
 	for _, subRef := range refs {
-		if err := downloadOCMResources(ocmPath, subRef, dir); err != nil {
+		if err := downloadOCMResources(ctx, ocmPath, subRef, dir); err != nil {
 			cleanup()
 			return "", nil, fmt.Errorf("downloading referenced component %q: %w", subRef, err)
 		}
@@ -73,8 +80,8 @@ func ResolveOCMRecursive(ref string) (string, func(), error) {
 }
 
 // downloadOCMResources runs `ocm download resources <ref> -O <destDir>`.
-func downloadOCMResources(ocmPath, ref, destDir string) error {
-	cmd := exec.Command(ocmPath, "download", "resources", ref, "-O", destDir)
+func downloadOCMResources(ctx context.Context, ocmPath, ref, destDir string) error {
+	cmd := exec.CommandContext(ctx, ocmPath, "download", "resources", ref, "-O", destDir)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
@@ -97,8 +104,8 @@ type ocmReferencesOutput struct {
 
 // getOCMReferences runs `ocm get references <ref> -o yaml` and returns fully
 // qualified component references for each discovered sub-component.
-func getOCMReferences(ocmPath, ref string) ([]string, error) {
-	cmd := exec.Command(ocmPath, "get", "references", ref, "-o", "yaml")
+func getOCMReferences(ctx context.Context, ocmPath, ref string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, ocmPath, "get", "references", ref, "-o", "yaml")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
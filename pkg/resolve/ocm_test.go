@@ -19,7 +19,7 @@ func TestResolveOCM_MissingOCM(t *testing.T) {
 		t.Skip("ocm is available, skipping missing-ocm test")
 	}
 
-	_, _, err := resolveOCM("ghcr.io/myorg/ocm//github.com/myorg/comp:v1")
+	_, _, err := resolveOCM(t.Context(), "ghcr.io/myorg/ocm//github.com/myorg/comp:v1")
 	if err == nil {
 		t.Fatal("expected error when ocm is missing, got nil")
 	}
@@ -58,7 +58,7 @@ func TestResolveOCMRecursive_MissingOCM(t *testing.T) {
 		t.Skip("ocm is available, skipping missing-ocm test")
 	}
 
-	_, _, err := ResolveOCMRecursive("ghcr.io/myorg/ocm//github.com/myorg/comp:v1")
+	_, _, err := ResolveOCMRecursive(t.Context(), "ghcr.io/myorg/ocm//github.com/myorg/comp:v1")
 	if err == nil {
 		t.Fatal("expected error when ocm is missing, got nil")
 	}
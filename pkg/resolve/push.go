@@ -0,0 +1,198 @@
+package resolve
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Media types and annotations of artifacts pushed by `flux push artifact`,
+// which Flux's OCIRepository consumes.
+const (
+	FluxConfigMediaType  types.MediaType = "application/vnd.cncf.flux.config.v1+json"
+	FluxContentMediaType types.MediaType = "application/vnd.cncf.flux.content.v1.tar+gzip"
+
+	createdAnnotation  = "org.opencontainers.image.created"
+	sourceAnnotation   = "org.opencontainers.image.source"
+	revisionAnnotation = "org.opencontainers.image.revision"
+)
+
+// PushOptions describes the provenance recorded on a pushed artifact.
+type PushOptions struct {
+	Source   string   // where the content came from, e.g. a Git URL
+	Revision string   // revision of Source, e.g. "main@sha1:<commit>"
+	Exclude  []string // names of files and directories to leave out, at any depth
+}
+
+// PushOCI packages dir as a Flux-compatible OCI artifact, pushes it to ref and
+// returns the manifest digest. The content layer is reproducible: entries are
+// sorted and carry no timestamps or ownership, so pushing the same tree twice
+// yields the same layer. The created annotation is taken from
+// SOURCE_DATE_EPOCH when set, which makes the whole manifest reproducible.
+// Symlinks and special files are not included.
+func PushOCI(ctx context.Context, ref, dir string, opts PushOptions) (string, error) {
+	parsed, err := name.ParseReference(strings.TrimPrefix(ref, "oci://"))
+	if err != nil {
+		return "", fmt.Errorf("parsing OCI reference %q: %w", ref, err)
+	}
+
+	created, err := sourceDateEpoch()
+	if err != nil {
+		return "", err
+	}
+
+	img, err := buildArtifact(dir, created, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if err := remote.Write(parsed, img, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain)); err != nil {
+		return "", fmt.Errorf("pushing %q: %w", ref, err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("computing manifest digest: %w", err)
+	}
+	return digest.String(), nil
+}
+
+// sourceDateEpoch returns the time in SOURCE_DATE_EPOCH, or the current time
+// when it is unset.
+func sourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Now().UTC(), nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", v, err)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+func buildArtifact(dir string, created time.Time, opts PushOptions) (v1.Image, error) {
+	content, err := packTarGz(dir, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	img := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), FluxConfigMediaType)
+	img, err = mutate.Append(img, mutate.Addendum{Layer: static.NewLayer(content, FluxContentMediaType)})
+	if err != nil {
+		return nil, fmt.Errorf("adding content layer: %w", err)
+	}
+
+	annotations := map[string]string{createdAnnotation: created.Format(time.RFC3339)}
+	if opts.Source != "" {
+		annotations[sourceAnnotation] = opts.Source
+	}
+	if opts.Revision != "" {
+		annotations[revisionAnnotation] = opts.Revision
+	}
+	return mutate.Annotations(img, annotations).(v1.Image), nil
+}
+
+// packTarGz writes the regular files and directories below dir, except
+// those named in exclude, into a gzipped tar archive with normalised headers.
+func packTarGz(dir string, exclude []string) ([]byte, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("checking directory: %w", err)
+	}
+	if !st.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	// WalkDir visits entries in lexical order, which keeps the archive stable.
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if slices.Contains(exclude, d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return addTarEntry(tw, path, filepath.ToSlash(rel), d)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("packing %s: %w", dir, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("closing tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("closing gzip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func addTarEntry(tw *tar.Writer, path, rel string, d fs.DirEntry) error {
+	hdr := &tar.Header{Name: rel, ModTime: time.Unix(0, 0)}
+	switch {
+	case d.IsDir():
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		hdr.Mode = 0o755
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing %s: %w", rel, err)
+		}
+		return nil
+	case !d.Type().IsRegular():
+		return nil
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", rel, err)
+	}
+	hdr.Typeflag = tar.TypeReg
+	hdr.Size = info.Size()
+	hdr.Mode = 0o644
+	if info.Mode()&0o111 != 0 {
+		hdr.Mode = 0o755
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", rel, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", rel, err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("writing %s: %w", rel, err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package resolve
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func writePushTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "apps", "web"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "apps", "web", "deployment.yaml"), []byte("kind: Deployment\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: [apps/web/deployment.yaml]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPushOCI_RoundTrip(t *testing.T) {
+	host := startRegistry(t, nil)
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	dir := writePushTree(t)
+
+	if err := os.WriteFile(filepath.Join(dir, ".many-manifest"), []byte("state"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := PushOCI(t.Context(), "oci://"+host+"/manifests:v1", dir, PushOptions{
+		Source:   "https://github.com/org/repo",
+		Revision: "main@sha1:abc",
+		Exclude:  []string{".many-manifest"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pulled, cleanup, got, err := ResolveOCI(t.Context(), host+"/manifests:v1", "")
+	if err != nil {
+		t.Fatalf("pulling: %v", err)
+	}
+	defer cleanup()
+
+	if got != digest {
+		t.Errorf("pulled digest = %q, want %q", got, digest)
+	}
+	assertFile(t, filepath.Join(pulled, "kustomization.yaml"), "resources: [apps/web/deployment.yaml]\n")
+	assertFile(t, filepath.Join(pulled, "apps", "web", "deployment.yaml"), "kind: Deployment\n")
+	if _, err := os.Stat(filepath.Join(pulled, ".many-manifest")); !os.IsNotExist(err) {
+		t.Errorf("expected excluded file to be left out, stat error: %v", err)
+	}
+}
+
+func TestPushOCI_ExcludesAtAnyDepth(t *testing.T) {
+	host := startRegistry(t, nil)
+	dir := t.TempDir()
+	// An instances output tree holds a manifest per instance.
+	for _, inst := range []string{"prod", "staging"} {
+		if err := os.MkdirAll(filepath.Join(dir, inst), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"app.yaml": "kind: Deployment\n", ".many-manifest": "state"} {
+			if err := os.WriteFile(filepath.Join(dir, inst, name), []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := PushOCI(t.Context(), "oci://"+host+"/manifests:v1", dir, PushOptions{Exclude: []string{".many-manifest"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pulled, cleanup, _, err := ResolveOCI(t.Context(), host+"/manifests:v1", "")
+	if err != nil {
+		t.Fatalf("pulling: %v", err)
+	}
+	defer cleanup()
+
+	for _, inst := range []string{"prod", "staging"} {
+		assertFile(t, filepath.Join(pulled, inst, "app.yaml"), "kind: Deployment\n")
+		if _, err := os.Stat(filepath.Join(pulled, inst, ".many-manifest")); !os.IsNotExist(err) {
+			t.Errorf("expected %s/.many-manifest to be left out, stat error: %v", inst, err)
+		}
+	}
+}
+
+func TestPushOCI_FluxManifest(t *testing.T) {
+	host := startRegistry(t, nil)
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	ref := host + "/manifests:v1"
+	if _, err := PushOCI(t.Context(), ref, writePushTree(t), PushOptions{Source: "https://github.com/org/repo", Revision: "v1@sha1:abc"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := remote.Image(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Config.MediaType != FluxConfigMediaType {
+		t.Errorf("config media type = %q, want %q", manifest.Config.MediaType, FluxConfigMediaType)
+	}
+	if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != FluxContentMediaType {
+		t.Fatalf("layers = %+v, want one %s layer", manifest.Layers, FluxContentMediaType)
+	}
+	want := map[string]string{
+		createdAnnotation:  "2023-11-14T22:13:20Z",
+		sourceAnnotation:   "https://github.com/org/repo",
+		revisionAnnotation: "v1@sha1:abc",
+	}
+	for k, v := range want {
+		if manifest.Annotations[k] != v {
+			t.Errorf("annotation %s = %q, want %q", k, manifest.Annotations[k], v)
+		}
+	}
+}
+
+func TestPushOCI_Reproducible(t *testing.T) {
+	host := startRegistry(t, nil)
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	first, err := PushOCI(t.Context(), host+"/manifests:a", writePushTree(t), PushOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A fresh copy of the tree has different mtimes and paths.
+	second, err := PushOCI(t.Context(), host+"/manifests:b", writePushTree(t), PushOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("digests differ: %s != %s", first, second)
+	}
+}
+
+func TestPushOCI_Errors(t *testing.T) {
+	host := startRegistry(t, nil)
+
+	t.Run("not a directory", func(t *testing.T) {
+		f := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(f, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := PushOCI(t.Context(), host+"/x:v1", f, PushOptions{})
+		if err == nil || !strings.Contains(err.Error(), "is not a directory") {
+			t.Fatalf("expected not a directory error, got %v", err)
+		}
+	})
+
+	t.Run("invalid reference", func(t *testing.T) {
+		_, err := PushOCI(t.Context(), "oci://UPPER/Case:v1", t.TempDir(), PushOptions{})
+		if err == nil || !strings.Contains(err.Error(), "parsing OCI reference") {
+			t.Fatalf("expected reference error, got %v", err)
+		}
+	})
+
+	t.Run("invalid SOURCE_DATE_EPOCH", func(t *testing.T) {
+		t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+		_, err := PushOCI(t.Context(), host+"/x:v1", t.TempDir(), PushOptions{})
+		if err == nil || !strings.Contains(err.Error(), "invalid SOURCE_DATE_EPOCH") {
+			t.Fatalf("expected SOURCE_DATE_EPOCH error, got %v", err)
+		}
+	})
+}
@@ -1,31 +1,50 @@
 package resolve
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
 // Resolve takes a URI string and returns a local filesystem path.
-// Supported schemes: file:// (or bare path), oci://, https://, ocm://.
-// For now, only file:// and bare paths are implemented; others return an error.
+// Supported schemes:
+//   - file:// or a bare path, returned as is
+//   - https://, downloaded and unpacked by ResolveHTTPS
+//   - oci://, an image or artifact pulled from a registry
+//   - git+URL[#ref], cloned by ResolveGit
+//   - ocm://, a component version downloaded with the ocm CLI
+//
+// helm:// sources need a repository and version, so they are resolved with
+// ResolveHelm; Resolve returns an error for them, as for unknown schemes.
 // The returned cleanup function should be called (if non-nil) when the path is
 // no longer needed — for file:// it is always nil.
-// The third return value (computedSHA256) is non-empty only for HTTPS sources.
-func Resolve(uri, sha256 string) (path string, cleanup func(), computedSHA256 string, err error) {
+// The third return value (computedSHA256) is the SHA256 of HTTPS downloads
+// and the checked-out commit of Git sources, and empty otherwise.
+// Pinned sources (HTTPS with a sha256, OCI by digest, OCM with a component
+// version) are served from the cache installed via SetCache, if any.
+// Cancelling ctx aborts the download and removes anything fetched so far.
+func Resolve(ctx context.Context, uri, sha256 string) (path string, cleanup func(), computedSHA256 string, err error) {
 	switch {
 	case strings.HasPrefix(uri, "file://"):
 		return strings.TrimPrefix(uri, "file://"), nil, "", nil
 
 	case strings.HasPrefix(uri, "oci://"):
-		p, c, e := resolveOCI(strings.TrimPrefix(uri, "oci://"))
+		p, c, e := resolveOCI(ctx, strings.TrimPrefix(uri, "oci://"))
 		return p, c, "", e
 
 	case strings.HasPrefix(uri, "https://"):
-		return resolveHTTPS(uri, sha256) // keep full URL for net/http
+		return ResolveHTTPS(ctx, uri, sha256, "", nil) // keep full URL for net/http
 
 	case strings.HasPrefix(uri, "ocm://"):
-		p, c, e := resolveOCM(strings.TrimPrefix(uri, "ocm://"))
-		return p, c, "", e
+		ref := strings.TrimPrefix(uri, "ocm://")
+		return withCache(uri, ocmPin(ref), nil, func() (string, func(), string, error) {
+			p, c, e := resolveOCM(ctx, ref)
+			return p, c, "", e
+		})
+
+	case strings.HasPrefix(uri, "git+"):
+		url, ref := splitGitURI(uri)
+		return ResolveGit(ctx, url, ref, "")
 
 	case strings.HasPrefix(uri, "helm://"):
 		// Helm sources are resolved directly via ResolveHelm in engine.go
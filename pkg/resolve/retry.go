@@ -0,0 +1,111 @@
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how transient HTTP failures (connection errors, 5xx
+// responses and 429 Too Many Requests) are retried.
+type RetryPolicy struct {
+	Attempts int           // total attempts; 1 disables retries
+	MinDelay time.Duration // delay before the first retry, doubled for each further one
+	MaxDelay time.Duration // upper bound on any delay, including a server's Retry-After
+}
+
+// DefaultRetryPolicy is used until SetRetryPolicy is called.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 4, MinDelay: time.Second, MaxDelay: 30 * time.Second}
+
+// DefaultTimeout bounds resolving a single source until SetTimeout is called.
+const DefaultTimeout = 10 * time.Minute
+
+var (
+	settingsMu     sync.RWMutex
+	retryPolicy    = DefaultRetryPolicy
+	defaultTimeout = DefaultTimeout
+)
+
+// SetRetryPolicy installs the retry policy used for HTTPS downloads.
+func SetRetryPolicy(p RetryPolicy) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	retryPolicy = p
+}
+
+func activeRetryPolicy() RetryPolicy {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return retryPolicy
+}
+
+// SetTimeout sets the timeout WithTimeout applies when a source sets none.
+// Zero disables it.
+func SetTimeout(d time.Duration) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	defaultTimeout = d
+}
+
+// WithTimeout returns a context bounding the resolution of one source to d,
+// or to the timeout set via SetTimeout when d is zero.
+func WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d == 0 {
+		settingsMu.RLock()
+		d = defaultTimeout
+		settingsMu.RUnlock()
+	}
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// isTransientStatus reports whether a response status is worth retrying.
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// backoff returns the delay before retry number n (starting at 1). A
+// Retry-After header on resp, in seconds or as an HTTP date, takes
+// precedence over the exponential delay.
+func (p RetryPolicy) backoff(n int, resp *http.Response) time.Duration {
+	d := p.MinDelay << (n - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if resp != nil {
+		if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			d = min(after, p.MaxDelay)
+		}
+	}
+	return d
+}
+
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("waiting to retry: %w", context.Cause(ctx))
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// noRetries disables retries for the duration of the test.
+func noRetries(t *testing.T) {
+	t.Helper()
+	SetRetryPolicy(RetryPolicy{Attempts: 1})
+	t.Cleanup(func() { SetRetryPolicy(DefaultRetryPolicy) })
+}
+
+// fastRetries retries quickly for the duration of the test.
+func fastRetries(t *testing.T, attempts int) {
+	t.Helper()
+	SetRetryPolicy(RetryPolicy{Attempts: attempts, MinDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+	t.Cleanup(func() { SetRetryPolicy(DefaultRetryPolicy) })
+}
+
+// flakyServer fails the first failures requests with status, then serves body.
+func flakyServer(t *testing.T, failures int32, status int, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestResolveHTTPS_RetriesTransientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway} {
+		fastRetries(t, 3)
+		srv, calls := flakyServer(t, 2, status, "ok")
+
+		path, cleanup, _, err := resolveHTTPS(t.Context(), srv.URL+"/a.txt", "", "", nil)
+		if err != nil {
+			t.Fatalf("status %d: %v", status, err)
+		}
+		cleanup()
+		if path == "" || calls.Load() != 3 {
+			t.Errorf("status %d: expected 3 requests, got %d", status, calls.Load())
+		}
+	}
+}
+
+func TestResolveHTTPS_GivesUpAfterAttempts(t *testing.T) {
+	fastRetries(t, 2)
+	srv, calls := flakyServer(t, 5, http.StatusInternalServerError, "ok")
+
+	_, _, _, err := resolveHTTPS(t.Context(), srv.URL+"/a.txt", "", "", nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 requests, got %d", calls.Load())
+	}
+}
+
+func TestResolveHTTPS_DoesNotRetryClientErrors(t *testing.T) {
+	fastRetries(t, 3)
+	srv, calls := flakyServer(t, 5, http.StatusNotFound, "ok")
+
+	if _, _, _, err := resolveHTTPS(t.Context(), srv.URL+"/a.txt", "", "", nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 request, got %d", calls.Load())
+	}
+}
+
+func TestResolveHTTPS_CancelledDuringBackoff(t *testing.T) {
+	SetRetryPolicy(RetryPolicy{Attempts: 3, MinDelay: time.Hour, MaxDelay: time.Hour})
+	t.Cleanup(func() { SetRetryPolicy(DefaultRetryPolicy) })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, _, err := resolveHTTPS(ctx, srv.URL+"/a.txt", "", "", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("backoff did not stop when the context was done")
+	}
+}
+
+func TestResolveHTTPS_TimeoutAbortsHungServer(t *testing.T) {
+	noRetries(t)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, _, err := resolveHTTPS(ctx, srv.URL+"/a.txt", "", "", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{Attempts: 5, MinDelay: time.Second, MaxDelay: 5 * time.Second}
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 40: 5 * time.Second} {
+		if got := p.backoff(n, nil); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	if got := p.backoff(1, resp); got != 3*time.Second {
+		t.Errorf("Retry-After seconds: got %v", got)
+	}
+	resp.Header.Set("Retry-After", "120")
+	if got := p.backoff(1, resp); got != 5*time.Second {
+		t.Errorf("Retry-After should be capped at MaxDelay, got %v", got)
+	}
+	resp.Header.Set("Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	if got := p.backoff(1, resp); got != 0 {
+		t.Errorf("Retry-After date in the past: got %v", got)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	SetTimeout(time.Minute)
+	t.Cleanup(func() { SetTimeout(DefaultTimeout) })
+
+	ctx, cancel := WithTimeout(t.Context(), 0)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("expected the default timeout, got deadline %v (%v)", deadline, ok)
+	}
+
+	ctx, cancel = WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("expected a 1s timeout, got deadline %v (%v)", deadline, ok)
+	}
+
+	SetTimeout(0)
+	ctx, cancel = WithTimeout(t.Context(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline when timeouts are disabled")
+	}
+}
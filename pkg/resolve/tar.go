@@ -10,7 +10,8 @@ import (
 	"strings"
 )
 
-// maxFileSize is the maximum size of a single file extracted from a tar archive (1 GB).
+// maxFileSize is the maximum size of a single file extracted from an archive
+// or written from an OCI artifact layer (1 GB).
 const maxFileSize = 1 << 30
 
 // extractTarGz decompresses a gzip stream and extracts the tar archive into destDir.
@@ -0,0 +1,49 @@
+package resolve
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	tempDirsMu sync.Mutex
+	tempDirs   = make(map[string]struct{})
+)
+
+// mkdirTemp creates a temp directory like os.MkdirTemp and tracks it until
+// the returned cleanup removes it, so RemoveTempDirs can remove it if the
+// process is interrupted first.
+func mkdirTemp(dir, pattern string) (string, func(), error) {
+	path, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+
+	tempDirsMu.Lock()
+	tempDirs[path] = struct{}{}
+	tempDirsMu.Unlock()
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			_ = os.RemoveAll(path)
+			tempDirsMu.Lock()
+			delete(tempDirs, path)
+			tempDirsMu.Unlock()
+		})
+	}
+	return path, cleanup, nil
+}
+
+// RemoveTempDirs removes every temp directory created while resolving
+// sources that has not been cleaned up yet. It is meant to run when the
+// process is interrupted; paths returned by resolvers are invalid afterwards.
+func RemoveTempDirs() {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	for path := range tempDirs {
+		_ = os.RemoveAll(path)
+		delete(tempDirs, path)
+	}
+}
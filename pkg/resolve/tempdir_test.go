@@ -0,0 +1,28 @@
+package resolve
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRemoveTempDirs(t *testing.T) {
+	kept, keptCleanup, err := mkdirTemp(t.TempDir(), "kept-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaked, _, err := mkdirTemp(t.TempDir(), "leaked-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keptCleanup()
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Errorf("cleanup did not remove %s", kept)
+	}
+
+	RemoveTempDirs()
+	if _, err := os.Stat(leaked); !os.IsNotExist(err) {
+		t.Errorf("RemoveTempDirs did not remove %s", leaked)
+	}
+	keptCleanup() // a second call is a no-op
+}
@@ -0,0 +1,110 @@
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotVendored is returned in offline mode for sources missing from the
+// vendor directory.
+var ErrNotVendored = errors.New("source is not vendored")
+
+// Vendor is a directory holding a copy of every source an input tree uses,
+// in the same layout as the cache. Unlike the cache it also keeps mutable
+// sources (an unpinned Git ref, an OCI tag, an HTTPS URL without sha256),
+// keyed by URI as written, so a render can run without network access.
+type Vendor struct {
+	Dir string
+	// Offline serves sources exclusively from Dir and fails on any that are
+	// missing. Otherwise every resolved source is copied into Dir.
+	Offline bool
+}
+
+var (
+	vendorMu     sync.RWMutex
+	sourceVendor *Vendor
+)
+
+// SetVendor installs the vendor directory used by Resolve and the scheme
+// specific resolvers. A nil vendor restores normal resolution.
+func SetVendor(v *Vendor) {
+	vendorMu.Lock()
+	defer vendorMu.Unlock()
+	sourceVendor = v
+}
+
+func activeVendor() *Vendor {
+	vendorMu.RLock()
+	defer vendorMu.RUnlock()
+	return sourceVendor
+}
+
+// OpenVendor creates the vendor directory if needed and returns a Vendor
+// that records resolved sources into it.
+func OpenVendor(dir string) (*Vendor, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating vendor directory: %w", err)
+	}
+	return &Vendor{Dir: dir}, nil
+}
+
+// List returns all vendored sources.
+func (v *Vendor) List() ([]CacheEntry, error) {
+	return v.cache().List()
+}
+
+func (v *Vendor) cache() *Cache {
+	return &Cache{Dir: v.Dir}
+}
+
+// resolve serves a source from the vendor directory. When recording, pinned
+// sources already vendored are reused and everything else is fetched
+// (through the cache, if any) and stored. Sources that may be pinned later
+// are also stored under their pinned key, so they are still found once the
+// computed value has been written back to the pipeline file.
+func (v *Vendor) resolve(uri, pin string, pinned pinFunc, fetch func() (string, func(), string, error)) (string, func(), string, error) {
+	if v.Offline || pin != "" {
+		if path, cleanup, entry, ok := v.cache().lookup(uri, pin); ok {
+			slog.Debug("serving vendored source", "uri", RedactURL(uri), "pin", pin)
+			return path, cleanup, entry.Resolved, nil
+		}
+	}
+	if v.Offline {
+		return "", nil, "", fmt.Errorf("%w in %s: %s (run many vendor)", ErrNotVendored, v.Dir, RedactURL(uri))
+	}
+
+	path, cleanup, computed, err := fromCache(uri, pin, fetch)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if err := v.put(uri, pin, path, computed); err != nil {
+		cleanup()
+		return "", nil, "", err
+	}
+	if pin == "" && computed != "" && pinned != nil {
+		pinnedURI, pinnedPin := pinned(computed)
+		if err := v.put(pinnedURI, pinnedPin, path, computed); err != nil {
+			cleanup()
+			return "", nil, "", err
+		}
+	}
+	slog.Info("vendored source", "uri", RedactURL(uri), "pin", pin)
+	return path, cleanup, computed, nil
+}
+
+// put stores a resolved source, replacing an earlier copy of a mutable one.
+func (v *Vendor) put(uri, pin, path, computed string) error {
+	if pin == "" {
+		if err := os.RemoveAll(filepath.Join(v.Dir, cacheKey(uri, pin))); err != nil {
+			return fmt.Errorf("replacing vendored source: %w", err)
+		}
+	}
+	if err := v.cache().store(uri, pin, path, computed); err != nil {
+		return fmt.Errorf("vendoring %s: %w", RedactURL(uri), err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package resolve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// useTestVendor installs a recording vendor directory for the test and
+// returns it; set Offline to switch it to serving only.
+func useTestVendor(t *testing.T) *Vendor {
+	t.Helper()
+	v, err := OpenVendor(filepath.Join(t.TempDir(), "vendor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetVendor(v)
+	t.Cleanup(func() { SetVendor(nil) })
+	return v
+}
+
+func readResolved(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestVendor_HTTPSOffline(t *testing.T) {
+	content := []byte("kind: ConfigMap\n")
+	sum := sha256.Sum256(content)
+	pin := hex.EncodeToString(sum[:])
+	srv, hits := countingServer(t, content)
+	url := srv.URL + "/config.yaml"
+
+	v := useTestVendor(t)
+	_, cleanup, _, err := Resolve(t.Context(), url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+
+	SetVendor(&Vendor{Dir: v.Dir, Offline: true})
+	// Unpinned as vendored, and pinned as after the sha256 is written back.
+	for _, want := range []string{"", pin} {
+		path, cleanup, computed, err := Resolve(t.Context(), url, want)
+		if err != nil {
+			t.Fatalf("sha256 %q: %v", want, err)
+		}
+		if got := readResolved(t, path); got != string(content) {
+			t.Errorf("sha256 %q: got %q", want, got)
+		}
+		if computed != pin {
+			t.Errorf("sha256 %q: computed = %q, want %q", want, computed, pin)
+		}
+		cleanup()
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("expected 1 download, got %d", got)
+	}
+}
+
+func TestVendor_OfflineMissing(t *testing.T) {
+	srv, hits := countingServer(t, []byte("data"))
+	SetVendor(&Vendor{Dir: t.TempDir(), Offline: true})
+	t.Cleanup(func() { SetVendor(nil) })
+
+	_, _, _, err := Resolve(t.Context(), srv.URL+"/file.txt", "")
+	if !errors.Is(err, ErrNotVendored) {
+		t.Fatalf("expected ErrNotVendored, got %v", err)
+	}
+	if got := hits.Load(); got != 0 {
+		t.Errorf("expected no download in offline mode, got %d", got)
+	}
+}
+
+func TestVendor_RefreshesUnpinned(t *testing.T) {
+	var body atomic.Value
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	t.Cleanup(srv.Close)
+	orig := httpClient
+	httpClient = srv.Client()
+	t.Cleanup(func() { httpClient = orig })
+	url := srv.URL + "/app.txt"
+
+	v := useTestVendor(t)
+	for _, b := range []string{"v1", "v2"} {
+		body.Store(b)
+		_, cleanup, _, err := Resolve(t.Context(), url, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleanup()
+	}
+
+	SetVendor(&Vendor{Dir: v.Dir, Offline: true})
+	path, cleanup, _, err := Resolve(t.Context(), url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if got := readResolved(t, path); got != "v2" {
+		t.Errorf("expected refreshed content, got %q", got)
+	}
+}
+
+func TestVendor_GitPinnedAfterWriteBack(t *testing.T) {
+	skipWithoutGit(t)
+	url, _, second := setupBareGitRepo(t)
+
+	v := useTestVendor(t)
+	_, cleanup, commit, err := ResolveGit(t.Context(), url, "main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if commit != second {
+		t.Fatalf("commit = %s, want %s", commit, second)
+	}
+
+	SetVendor(&Vendor{Dir: v.Dir, Offline: true})
+	for _, pin := range []string{"", second} {
+		path, cleanup, got, err := ResolveGit(t.Context(), url, "main", pin)
+		if err != nil {
+			t.Fatalf("commit %q: %v", pin, err)
+		}
+		if content := readResolved(t, filepath.Join(path, "deploy", "app.yaml")); content != "v2" {
+			t.Errorf("commit %q: got %q", pin, content)
+		}
+		if got != second {
+			t.Errorf("commit %q: resolved %s, want %s", pin, got, second)
+		}
+		cleanup()
+	}
+
+	if _, _, _, err := ResolveGit(t.Context(), url, "v1", ""); !errors.Is(err, ErrNotVendored) {
+		t.Errorf("expected other ref to be missing, got %v", err)
+	}
+}
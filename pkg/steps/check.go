@@ -0,0 +1,77 @@
+package steps
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/systemstart/many-templates/pkg/api"
+)
+
+// Check performs the offline checks for a step: it parses, without executing,
+// every template the step would execute. files maps the work-dir-relative
+// paths of the input files known ahead of time (those from local sources) to
+// their location on disk; other inputs are not checked. All problems found
+// are returned.
+func Check(cfg api.StepConfig, files map[string]string) []error {
+	switch cfg.Type {
+	case api.StepTypeTemplate:
+		if cfg.Template != nil {
+			return checkTemplateFiles(cfg.Template, files)
+		}
+	case api.StepTypeGenerate:
+		if cfg.Generate != nil {
+			if _, err := template.New(cfg.Name).Funcs(sprig.FuncMap()).Parse(cfg.Generate.Template); err != nil {
+				return []error{fmt.Errorf("generate.template: %w", err)}
+			}
+		}
+	case api.StepTypeSplit:
+		if cfg.Split != nil && cfg.Split.By == api.SplitByCustom {
+			if _, err := template.New("filename").Parse(cfg.Split.FileNameTemplate); err != nil {
+				return []error{fmt.Errorf("split.fileNameTemplate: %w", err)}
+			}
+		}
+	}
+	return nil
+}
+
+func checkTemplateFiles(cfg *api.TemplateConfig, files map[string]string) []error {
+	include := cfg.Files.Include
+	if len(include) == 0 {
+		include = []string{api.DefaultFileInclude}
+	}
+
+	rels := make([]string, 0, len(files))
+	for rel := range files {
+		rels = append(rels, rel)
+	}
+	slices.Sort(rels)
+
+	var errs []error
+	for _, rel := range rels {
+		if !matchAny(include, rel) || matchAny(cfg.Files.Exclude, rel) {
+			continue
+		}
+		content, err := os.ReadFile(files[rel])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rel, err))
+			continue
+		}
+		if _, err := template.New(rel).Funcs(sprig.FuncMap()).Parse(string(content)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rel, err))
+		}
+	}
+	return errs
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := doublestar.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
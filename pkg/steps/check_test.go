@@ -0,0 +1,56 @@
+package steps
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/systemstart/many-templates/pkg/api"
+)
+
+func TestCheck_TemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "ok.yaml", "name: {{ .name | upper }}")
+	writeTestFile(t, dir, "broken.yaml", "name: {{ .name ")
+	writeTestFile(t, dir, "skipped.txt", "{{ broken")
+
+	files := map[string]string{
+		"ok.yaml":     filepath.Join(dir, "ok.yaml"),
+		"broken.yaml": filepath.Join(dir, "broken.yaml"),
+		"skipped.txt": filepath.Join(dir, "skipped.txt"),
+	}
+	cfg := api.StepConfig{
+		Name:     "render",
+		Type:     api.StepTypeTemplate,
+		Template: &api.TemplateConfig{Files: api.FileFilter{Include: []string{"*.yaml"}}},
+	}
+
+	errs := Check(cfg, files)
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "broken.yaml:") {
+		t.Fatalf("expected one error for broken.yaml, got %v", errs)
+	}
+}
+
+func TestCheck_GenerateTemplate(t *testing.T) {
+	cfg := api.StepConfig{
+		Name:     "gen",
+		Type:     api.StepTypeGenerate,
+		Generate: &api.GenerateConfig{Output: "a.yaml", Template: "{{ if .x }}"},
+	}
+	errs := Check(cfg, nil)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "generate.template") {
+		t.Fatalf("expected generate.template error, got %v", errs)
+	}
+}
+
+func TestCheck_SplitFileNameTemplate(t *testing.T) {
+	cfg := api.StepConfig{
+		Name:  "split",
+		Type:  api.StepTypeSplit,
+		Split: &api.SplitConfig{Input: "all.yaml", By: api.SplitByCustom, FileNameTemplate: "{{ .kind "},
+	}
+	errs := Check(cfg, nil)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "split.fileNameTemplate") {
+		t.Fatalf("expected split.fileNameTemplate error, got %v", errs)
+	}
+}
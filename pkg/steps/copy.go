@@ -2,7 +2,6 @@ package steps
 
 import (
 	"fmt"
-	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -31,7 +30,7 @@ func (s *copyStep) Run(ctx StepContext) (*StepResult, error) {
 		return nil, fmt.Errorf("filtering files: %w", err)
 	}
 
-	slog.Info("copy step processing files", "step", s.name, "count", len(files))
+	ctx.logger().Info("copy step processing files", "step", s.name, "count", len(files))
 
 	dest := s.cfg.Dest
 	if dest == "" {
@@ -55,7 +54,7 @@ func (s *copyStep) Run(ctx StepContext) (*StepResult, error) {
 			return nil, fmt.Errorf("writing %s: %w", file, writeErr)
 		}
 
-		slog.Debug("copied file", "file", file)
+		ctx.logger().Debug("copied file", "file", file)
 	}
 
 	return &StepResult{}, nil
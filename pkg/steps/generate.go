@@ -3,7 +3,6 @@ package steps
 import (
 	"bytes"
 	"fmt"
-	"log/slog"
 	"os"
 	"path/filepath"
 	"text/template"
@@ -44,6 +43,6 @@ func (s *generateStep) Run(ctx StepContext) (*StepResult, error) {
 		return nil, fmt.Errorf("writing output file: %w", err)
 	}
 
-	slog.Info("generate step wrote file", "step", s.name, "output", s.cfg.Output)
+	ctx.logger().Info("generate step wrote file", "step", s.name, "output", s.cfg.Output)
 	return &StepResult{}, nil
 }
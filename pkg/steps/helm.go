@@ -3,12 +3,21 @@ package steps
 import (
 	"bytes"
 	"fmt"
-	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
 
+	"github.com/Masterminds/sprig/v3"
 	"github.com/systemstart/many-templates/pkg/api"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
 )
 
 type helmStep struct {
@@ -23,28 +32,37 @@ func NewHelmStep(name string, cfg *api.HelmConfig) Step {
 
 func (s *helmStep) Name() string { return s.name }
 
+// Run renders the chart in-process the way `helm template` does.
 func (s *helmStep) Run(ctx StepContext) (*StepResult, error) {
-	if _, err := exec.LookPath("helm"); err != nil {
-		return nil, fmt.Errorf("helm binary not found in PATH: %w", err)
+	chartPath := s.cfg.Chart
+	if !filepath.IsAbs(chartPath) {
+		chartPath = filepath.Join(ctx.WorkDir, chartPath)
 	}
 
-	args := s.buildArgs(ctx.WorkDir)
+	ctx.logger().Info("running helm template", "step", s.name, "chart", s.cfg.Chart)
 
-	slog.Info("running helm template", "step", s.name, "chart", s.cfg.Chart)
+	chrt, err := loadChart(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("helm template failed: %w", err)
+	}
 
-	cmd := exec.Command("helm", args...)
-	cmd.Dir = ctx.WorkDir
+	vals, err := s.mergeValues(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("helm template failed: %w", err)
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	client, err := s.newInstall()
+	if err != nil {
+		return nil, fmt.Errorf("helm template failed: %w", err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("helm template failed: %w\nstderr: %s", err, stderr.String())
+	rel, err := client.Run(chrt, vals)
+	if err != nil {
+		return nil, fmt.Errorf("helm template failed: %w", err)
 	}
 
 	if s.cfg.OutputFile != "" {
-		if err := writeOutputFile(filepath.Join(ctx.WorkDir, s.cfg.OutputFile), stdout.Bytes()); err != nil {
+		if err := writeOutputFile(filepath.Join(ctx.WorkDir, s.cfg.OutputFile), s.manifests(rel)); err != nil {
 			return nil, err
 		}
 	}
@@ -52,32 +70,188 @@ func (s *helmStep) Run(ctx StepContext) (*StepResult, error) {
 	return &StepResult{}, nil
 }
 
-func (s *helmStep) buildArgs(workDir string) []string {
-	chart := s.cfg.Chart
-	if !filepath.IsAbs(chart) {
-		chart = filepath.Join(workDir, chart)
+func loadChart(path string) (*chart.Chart, error) {
+	chrt, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading chart: %w", err)
+	}
+	if t := chrt.Metadata.Type; t != "" && t != "application" {
+		return nil, fmt.Errorf("%s charts are not installable", t)
+	}
+	if req := chrt.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(chrt, req); err != nil {
+			return nil, fmt.Errorf("checking chart dependencies: %w", err)
+		}
+	}
+	return chrt, nil
+}
+
+// newInstall configures a client-only dry-run install, as `helm template` does.
+func (s *helmStep) newInstall() (*action.Install, error) {
+	client := action.NewInstall(&action.Configuration{Log: func(string, ...any) {}})
+	client.DryRun = true
+	client.DryRunOption = "client"
+	client.ClientOnly = true
+	client.Replace = true
+	client.ReleaseName = s.cfg.ReleaseName
+	client.Namespace = s.cfg.Namespace
+	if client.Namespace == "" {
+		client.Namespace = "default"
+	}
+	client.APIVersions = chartutil.VersionSet(s.cfg.APIVersions)
+	client.IncludeCRDs = s.cfg.IncludeCRDs
+	client.IsUpgrade = s.cfg.IsUpgrade
+	if s.cfg.KubeVersion != "" {
+		kv, err := chartutil.ParseKubeVersion(s.cfg.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubeVersion %q: %w", s.cfg.KubeVersion, err)
+		}
+		client.KubeVersion = kv
 	}
+	return client, nil
+}
 
-	args := []string{"template", s.cfg.ReleaseName, chart}
+// manifests assembles the rendered release like `helm template` prints it.
+func (s *helmStep) manifests(rel *release.Release) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, strings.TrimSpace(rel.Manifest))
+	for _, h := range rel.Hooks {
+		if s.cfg.SkipTests && isTestHook(h) {
+			continue
+		}
+		fmt.Fprintf(&buf, "---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+	}
+	return buf.Bytes()
+}
 
-	ns := s.cfg.Namespace
-	if ns == "" {
-		ns = "default"
+func isTestHook(h *release.Hook) bool {
+	for _, e := range h.Events {
+		if e == release.HookTest {
+			return true
+		}
 	}
-	args = append(args, "--namespace", ns)
+	return false
+}
+
+// mergeValues combines valuesFiles, values and set, in that order of
+// increasing precedence.
+func (s *helmStep) mergeValues(ctx StepContext) (map[string]any, error) {
+	vals := map[string]any{}
 
 	for _, vf := range s.cfg.ValuesFiles {
 		if !filepath.IsAbs(vf) {
-			vf = filepath.Join(workDir, vf)
+			vf = filepath.Join(ctx.WorkDir, vf)
+		}
+		data, err := os.ReadFile(vf)
+		if err != nil {
+			return nil, fmt.Errorf("reading values file: %w", err)
+		}
+		fileVals, err := chartutil.ReadValues(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing values file %s: %w", filepath.Base(vf), err)
+		}
+		vals = mergeMaps(vals, fileVals)
+	}
+
+	if len(s.cfg.Values) > 0 {
+		rendered, err := renderValue(s.cfg.Values, ctx.TemplateData)
+		if err != nil {
+			return nil, fmt.Errorf("rendering values: %w", err)
+		}
+		vals = mergeMaps(vals, rendered.(map[string]any))
+	}
+
+	keys := make([]string, 0, len(s.cfg.Set))
+	for k := range s.cfg.Set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := strvals.ParseInto(k+"="+s.cfg.Set[k], vals); err != nil {
+			return nil, fmt.Errorf("parsing set %q: %w", k, err)
+		}
+	}
+
+	return vals, nil
+}
+
+// mergeMaps deep-merges b over a, like Helm does for values files.
+func mergeMaps(a, b map[string]any) map[string]any {
+	out := make(map[string]any, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if vm, ok := v.(map[string]any); ok {
+			if am, ok := out[k].(map[string]any); ok {
+				out[k] = mergeMaps(am, vm)
+				continue
+			}
 		}
-		args = append(args, "--values", vf)
+		out[k] = v
 	}
+	return out
+}
+
+// renderValue renders string leaves of v as templates against data. A string
+// that consists of a single {{ ... }} action is decoded as YAML after
+// rendering, so `{{ .replicas }}` yields a number and `{{ .hosts | toJson }}`
+// a list.
+func renderValue(v any, data map[string]any) (any, error) {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			r, err := renderValue(item, data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			r, err := renderValue(item, data)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = r
+		}
+		return out, nil
+	case string:
+		return renderValueString(val, data)
+	default:
+		return v, nil
+	}
+}
 
-	for k, v := range s.cfg.Set {
-		args = append(args, "--set", fmt.Sprintf("%s=%s", k, v))
+func renderValueString(s string, data map[string]any) (any, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
 	}
+	tmpl, err := template.New("values").Funcs(sprig.FuncMap()).Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("executing template: %w", err)
+	}
+	if !isSingleAction(s) {
+		return buf.String(), nil
+	}
+	var typed any
+	if err := yaml.Unmarshal(buf.Bytes(), &typed); err != nil || typed == nil {
+		return buf.String(), nil //nolint:nilerr // not YAML; keep the string
+	}
+	return typed, nil
+}
 
-	return args
+// isSingleAction reports whether s is exactly one {{ ... }} action.
+func isSingleAction(s string) bool {
+	t := strings.TrimSpace(s)
+	return strings.HasPrefix(t, "{{") && strings.HasSuffix(t, "}}") && strings.Count(t, "{{") == 1
 }
 
 func writeOutputFile(path string, data []byte) error {
@@ -2,7 +2,6 @@ package steps
 
 import (
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -23,16 +22,7 @@ func createTestChart(t *testing.T, dir, templateName, templateContent string) {
 	writeTestFile(t, tmplDir, templateName, templateContent)
 }
 
-func skipWithoutHelm(t *testing.T) {
-	t.Helper()
-	if _, err := exec.LookPath("helm"); err != nil {
-		t.Skip("helm not in PATH")
-	}
-}
-
 func TestHelmStep_Run(t *testing.T) {
-	skipWithoutHelm(t)
-
 	dir := t.TempDir()
 	createTestChart(t, dir, "configmap.yaml", `apiVersion: v1
 kind: ConfigMap
@@ -64,8 +54,6 @@ data:
 }
 
 func TestHelmStep_RunWithValuesFile(t *testing.T) {
-	skipWithoutHelm(t)
-
 	dir := t.TempDir()
 	createTestChart(t, dir, "deploy.yaml", `apiVersion: apps/v1
 kind: Deployment
@@ -99,8 +87,6 @@ spec:
 }
 
 func TestHelmStep_RunWithSet(t *testing.T) {
-	skipWithoutHelm(t)
-
 	dir := t.TempDir()
 	createTestChart(t, dir, "deploy.yaml", `apiVersion: apps/v1
 kind: Deployment
@@ -132,8 +118,6 @@ spec:
 }
 
 func TestHelmStep_RunInvalidChart(t *testing.T) {
-	skipWithoutHelm(t)
-
 	dir := t.TempDir()
 
 	step := NewHelmStep("render", &api.HelmConfig{
@@ -151,8 +135,6 @@ func TestHelmStep_RunInvalidChart(t *testing.T) {
 }
 
 func TestHelmStep_DefaultNamespace(t *testing.T) {
-	skipWithoutHelm(t)
-
 	dir := t.TempDir()
 	createTestChart(t, dir, "sa.yaml", `apiVersion: v1
 kind: ServiceAccount
@@ -180,3 +162,166 @@ metadata:
 		t.Errorf("expected default namespace, got:\n%s", string(content))
 	}
 }
+
+// renderTestChart runs a helm step against a chart created by createTestChart
+// and returns the rendered output.
+func renderTestChart(t *testing.T, dir string, cfg *api.HelmConfig, data map[string]any) string {
+	t.Helper()
+	cfg.Chart = "test-chart"
+	cfg.OutputFile = "out.yaml"
+	if _, err := NewHelmStep("render", cfg).Run(StepContext{WorkDir: dir, TemplateData: data}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "out.yaml"))
+	if err != nil {
+		t.Fatalf("expected output file to exist: %v", err)
+	}
+	return string(content)
+}
+
+func TestHelmStep_StructuredValues(t *testing.T) {
+	dir := t.TempDir()
+	createTestChart(t, dir, "cm.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  replicas: {{ kindOf .Values.replicaCount | quote }}
+  hosts: {{ join "," .Values.ingress.hosts | quote }}
+  host-kind: {{ kindOf .Values.ingress.hosts | quote }}
+  domain: {{ .Values.ingress.domain | quote }}
+  tag: {{ .Values.image.tag | quote }}
+`)
+	writeTestFile(t, dir, "custom-values.yaml", "image:\n  tag: from-file\n  repository: nginx\n")
+
+	out := renderTestChart(t, dir, &api.HelmConfig{
+		ReleaseName: "app",
+		ValuesFiles: []string{"custom-values.yaml"},
+		Values: map[string]any{
+			"replicaCount": "{{ .replicas }}",
+			"ingress": map[string]any{
+				"hosts":  "{{ .hosts | toJson }}",
+				"domain": "app.{{ .domain }}",
+			},
+			"image": map[string]any{"tag": "from-values"},
+		},
+		Set: map[string]string{"image.tag": "from-set"},
+	}, map[string]any{"replicas": 3, "hosts": []any{"a.example.com", "b.example.com"}, "domain": "example.com"})
+
+	for _, want := range []string{
+		`replicas: "float64"`,
+		`hosts: "a.example.com,b.example.com"`,
+		`host-kind: "slice"`,
+		`domain: "app.example.com"`,
+		`tag: "from-set"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHelmStep_Capabilities(t *testing.T) {
+	dir := t.TempDir()
+	createTestChart(t, dir, "cm.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: caps
+data:
+  kube: {{ .Capabilities.KubeVersion.Version | quote }}
+  monitoring: {{ .Capabilities.APIVersions.Has "monitoring.coreos.com/v1" | quote }}
+  upgrade: {{ .Release.IsUpgrade | quote }}
+`)
+
+	out := renderTestChart(t, dir, &api.HelmConfig{
+		ReleaseName: "app",
+		APIVersions: []string{"monitoring.coreos.com/v1"},
+		KubeVersion: "1.29.3",
+		IsUpgrade:   true,
+	}, nil)
+
+	for _, want := range []string{`kube: "v1.29.3"`, `monitoring: "true"`, `upgrade: "true"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHelmStep_CRDsAndTests(t *testing.T) {
+	dir := t.TempDir()
+	createTestChart(t, dir, "cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: main\n")
+	chart := filepath.Join(dir, "test-chart")
+	if err := os.MkdirAll(filepath.Join(chart, "crds"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(chart, "crds"), "crd.yaml", `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`)
+	writeTestFile(t, filepath.Join(chart, "templates"), "test.yaml", `apiVersion: v1
+kind: Pod
+metadata:
+  name: smoke-test
+  annotations:
+    "helm.sh/hook": test
+`)
+
+	out := renderTestChart(t, dir, &api.HelmConfig{ReleaseName: "app"}, nil)
+	if strings.Contains(out, "widgets.example.com") {
+		t.Errorf("CRDs should be omitted by default, got:\n%s", out)
+	}
+	if !strings.Contains(out, "smoke-test") {
+		t.Errorf("test hooks should be rendered by default, got:\n%s", out)
+	}
+
+	out = renderTestChart(t, dir, &api.HelmConfig{ReleaseName: "app", IncludeCRDs: true, SkipTests: true}, nil)
+	if !strings.Contains(out, "widgets.example.com") {
+		t.Errorf("expected CRDs with includeCRDs, got:\n%s", out)
+	}
+	if strings.Contains(out, "smoke-test") {
+		t.Errorf("expected test hooks to be skipped, got:\n%s", out)
+	}
+}
+
+func TestHelmStep_LibraryChart(t *testing.T) {
+	dir := t.TempDir()
+	createTestChart(t, dir, "cm.yaml", "")
+	writeTestFile(t, filepath.Join(dir, "test-chart"), "Chart.yaml", "apiVersion: v2\nname: test-chart\nversion: 0.1.0\ntype: library\n")
+
+	_, err := NewHelmStep("render", &api.HelmConfig{Chart: "test-chart", ReleaseName: "app"}).Run(StepContext{WorkDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "library charts are not installable") {
+		t.Fatalf("expected library chart error, got %v", err)
+	}
+}
+
+func TestRenderValue(t *testing.T) {
+	data := map[string]any{"n": 2, "name": "web", "tags": []any{"a", "b"}}
+	got, err := renderValue(map[string]any{
+		"count":  "{{ .n }}",
+		"label":  "app-{{ .name }}",
+		"plain":  "no template",
+		"tags":   "{{ .tags | toJson }}",
+		"nested": []any{"{{ .name }}", true},
+	}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := got.(map[string]any)
+	if m["count"] != float64(2) {
+		t.Errorf("count = %#v, want 2", m["count"])
+	}
+	if m["label"] != "app-web" || m["plain"] != "no template" {
+		t.Errorf("unexpected strings: %#v", m)
+	}
+	if tags, ok := m["tags"].([]any); !ok || len(tags) != 2 {
+		t.Errorf("tags = %#v, want a two-element list", m["tags"])
+	}
+	if nested := m["nested"].([]any); nested[0] != "web" || nested[1] != true {
+		t.Errorf("nested = %#v", nested)
+	}
+
+	if _, err := renderValue(map[string]any{"bad": "{{ .n "}, data); err == nil || !strings.Contains(err.Error(), "bad:") {
+		t.Errorf("expected parse error naming the key, got %v", err)
+	}
+}
@@ -13,3 +13,15 @@ func writeTestFile(t *testing.T, dir, name, content string) {
 		t.Fatal(err)
 	}
 }
+
+// assertFileContent fails the test unless the file at path holds exactly want.
+func assertFileContent(t *testing.T, path, want string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected file %s to exist: %v", path, err)
+	}
+	if string(content) != want {
+		t.Errorf("unexpected content in %s:\ngot:\n%s\nwant:\n%s", path, content, want)
+	}
+}
@@ -7,14 +7,18 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime/debug"
 
 	"github.com/systemstart/many-templates/pkg/api"
 	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
 const (
 	kustomizationFilename = "kustomization.yaml"
 	helmChartsDir         = "charts"
+	kustomizeModulePath   = "sigs.k8s.io/kustomize/api"
 )
 
 type kustomizeBuildStep struct {
@@ -36,6 +40,68 @@ func (s *kustomizeBuildStep) Run(ctx StepContext) (*StepResult, error) {
 	}
 	dir = filepath.Join(ctx.WorkDir, dir)
 
+	var (
+		out []byte
+		err error
+	)
+	if s.cfg.Engine == api.KustomizeEngineExec {
+		out, err = s.buildExec(ctx, dir)
+	} else {
+		out, err = s.buildBuiltin(ctx, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.OutputFile != "" {
+		outPath := filepath.Join(ctx.WorkDir, s.cfg.OutputFile)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0o750); err != nil {
+			return nil, fmt.Errorf("creating output directory: %w", err)
+		}
+		if err := os.WriteFile(outPath, out, 0o600); err != nil {
+			return nil, fmt.Errorf("writing output file: %w", err)
+		}
+	}
+
+	var cleanup []string
+	if s.cfg.EnableHelm {
+		cleanup = collectKustomizeCleanup(ctx.logger(), dir)
+	}
+
+	return &StepResult{Cleanup: cleanup}, nil
+}
+
+// buildBuiltin renders dir with the kustomize library linked into many. Like
+// the kustomize binary, the library inflates helmCharts by running helm.
+func (s *kustomizeBuildStep) buildBuiltin(ctx StepContext, dir string) ([]byte, error) {
+	if s.cfg.EnableHelm {
+		if _, err := exec.LookPath("helm"); err != nil {
+			return nil, fmt.Errorf("enableHelm requires the helm binary in PATH: %w", err)
+		}
+	}
+
+	ctx.logger().Info("running kustomize", "step", s.name, "dir", dir, "enableHelm", s.cfg.EnableHelm,
+		"engine", api.KustomizeEngineBuiltin, "kustomizeVersion", KustomizeVersion())
+
+	opts := krusty.MakeDefaultOptions()
+	if s.cfg.EnableHelm {
+		opts.PluginConfig.HelmConfig.Enabled = true
+		opts.PluginConfig.HelmConfig.Command = "helm"
+	}
+
+	resources, err := krusty.MakeKustomizer(opts).Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize build failed: %w", err)
+	}
+	out, err := resources.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("kustomize build failed: encoding output: %w", err)
+	}
+	return out, nil
+}
+
+// buildExec renders dir by running the kustomize binary found on PATH.
+func (s *kustomizeBuildStep) buildExec(ctx StepContext, dir string) ([]byte, error) {
 	if _, err := exec.LookPath("kustomize"); err != nil {
 		return nil, fmt.Errorf("kustomize binary not found in PATH: %w", err)
 	}
@@ -45,9 +111,10 @@ func (s *kustomizeBuildStep) Run(ctx StepContext) (*StepResult, error) {
 		args = append(args, "--enable-helm")
 	}
 
-	slog.Info("running kustomize", "step", s.name, "dir", dir, "enableHelm", s.cfg.EnableHelm)
+	ctx.logger().Info("running kustomize", "step", s.name, "dir", dir, "enableHelm", s.cfg.EnableHelm,
+		"engine", api.KustomizeEngineExec)
 
-	cmd := exec.Command("kustomize", args...)
+	cmd := exec.CommandContext(ctx.context(), "kustomize", args...)
 	cmd.Dir = ctx.WorkDir
 
 	var stdout, stderr bytes.Buffer
@@ -57,23 +124,26 @@ func (s *kustomizeBuildStep) Run(ctx StepContext) (*StepResult, error) {
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("kustomize build failed: %w\nstderr: %s", err, stderr.String())
 	}
+	return stdout.Bytes(), nil
+}
 
-	if s.cfg.OutputFile != "" {
-		outPath := filepath.Join(ctx.WorkDir, s.cfg.OutputFile)
-		if err := os.MkdirAll(filepath.Dir(outPath), 0o750); err != nil {
-			return nil, fmt.Errorf("creating output directory: %w", err)
+// KustomizeVersion returns the version of the kustomize library linked into
+// the binary, or "unknown" when build information is unavailable.
+func KustomizeVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != kustomizeModulePath {
+			continue
 		}
-		if err := os.WriteFile(outPath, stdout.Bytes(), 0o600); err != nil {
-			return nil, fmt.Errorf("writing output file: %w", err)
+		if dep.Replace != nil {
+			return dep.Replace.Version
 		}
+		return dep.Version
 	}
-
-	var cleanup []string
-	if s.cfg.EnableHelm {
-		cleanup = collectKustomizeCleanup(dir)
-	}
-
-	return &StepResult{Cleanup: cleanup}, nil
+	return "unknown"
 }
 
 // kustomizationFile is a minimal representation for collecting cleanup paths.
@@ -86,16 +156,16 @@ type helmChartEntry struct {
 	ValuesFile string `yaml:"valuesFile"`
 }
 
-func collectKustomizeCleanup(dir string) []string {
+func collectKustomizeCleanup(log *slog.Logger, dir string) []string {
 	data, err := os.ReadFile(filepath.Join(dir, kustomizationFilename))
 	if err != nil {
-		slog.Warn("could not read kustomization.yaml for cleanup", "dir", dir, "error", err)
+		log.Warn("could not read kustomization.yaml for cleanup", "dir", dir, "error", err)
 		return nil
 	}
 
 	var kf kustomizationFile
 	if err := yaml.Unmarshal(data, &kf); err != nil {
-		slog.Warn("could not parse kustomization.yaml for cleanup", "dir", dir, "error", err)
+		log.Warn("could not parse kustomization.yaml for cleanup", "dir", dir, "error", err)
 		return nil
 	}
 
@@ -3,13 +3,18 @@ package steps
 import (
 	"bytes"
 	"fmt"
-	"log/slog"
+	"io/fs"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/systemstart/many-templates/pkg/api"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/provider"
 )
 
 type kustomizeCreateStep struct {
@@ -25,20 +30,166 @@ func NewKustomizeCreateStep(name string, cfg *api.KustomizeCreateConfig) Step {
 func (s *kustomizeCreateStep) Name() string { return s.name }
 
 func (s *kustomizeCreateStep) Run(ctx StepContext) (*StepResult, error) {
-	if _, err := exec.LookPath("kustomize"); err != nil {
-		return nil, fmt.Errorf("kustomize binary not found in PATH: %w", err)
-	}
-
 	dir := s.cfg.Dir
 	if dir == "" {
 		dir = "."
 	}
 
+	if s.cfg.Engine == api.KustomizeEngineExec {
+		return s.createExec(ctx, dir)
+	}
+	return s.createBuiltin(ctx, dir)
+}
+
+// createBuiltin writes the kustomization file itself, following the same rules
+// as `kustomize create`.
+func (s *kustomizeCreateStep) createBuiltin(ctx StepContext, dir string) (*StepResult, error) {
+	ctx.logger().Info("running kustomize create", "step", s.name, "dir", dir,
+		"engine", api.KustomizeEngineBuiltin, "kustomizeVersion", KustomizeVersion())
+
+	base := filepath.Join(ctx.WorkDir, dir)
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if _, err := os.Stat(filepath.Join(base, name)); err == nil {
+			return nil, fmt.Errorf("kustomize create failed: kustomization file already exists")
+		}
+	}
+
+	resources, err := globResources(base, s.cfg.Resources)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize create failed: %w", err)
+	}
+	if s.cfg.Autodetect {
+		detected, err := detectResources(base, s.cfg.Recursive)
+		if err != nil {
+			return nil, fmt.Errorf("kustomize create failed: detecting resources: %w", err)
+		}
+		for _, r := range detected {
+			if !slices.Contains(resources, r) {
+				resources = append(resources, r)
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(createdKustomization{
+		APIVersion:        "kustomize.config.k8s.io/v1beta1",
+		Kind:              "Kustomization",
+		Resources:         resources,
+		NamePrefix:        s.cfg.NamePrefix,
+		NameSuffix:        s.cfg.NameSuffix,
+		Namespace:         s.cfg.Namespace,
+		CommonLabels:      s.cfg.Labels,
+		CommonAnnotations: s.cfg.Annotations,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kustomize create failed: encoding kustomization: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, kustomizationFilename), data, 0o600); err != nil {
+		return nil, fmt.Errorf("kustomize create failed: writing kustomization: %w", err)
+	}
+
+	return &StepResult{}, nil
+}
+
+// createdKustomization mirrors the field order `kustomize create` writes.
+type createdKustomization struct {
+	APIVersion        string            `yaml:"apiVersion"`
+	Kind              string            `yaml:"kind"`
+	Resources         []string          `yaml:"resources,omitempty"`
+	NamePrefix        string            `yaml:"namePrefix,omitempty"`
+	NameSuffix        string            `yaml:"nameSuffix,omitempty"`
+	Namespace         string            `yaml:"namespace,omitempty"`
+	CommonLabels      map[string]string `yaml:"commonLabels,omitempty"`
+	CommonAnnotations map[string]string `yaml:"commonAnnotations,omitempty"`
+}
+
+// globResources expands resource patterns relative to base. Patterns without a
+// local match are kept as-is when they look like remote targets.
+func globResources(base string, patterns []string) ([]string, error) {
+	var result []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(base, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("checking resource pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			if !isRemoteResource(pattern) {
+				return nil, fmt.Errorf("%s has no match", pattern)
+			}
+			result = append(result, pattern)
+			continue
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(base, m)
+			if err != nil {
+				return nil, fmt.Errorf("computing relative path: %w", err)
+			}
+			result = append(result, filepath.ToSlash(rel))
+		}
+	}
+	return result, nil
+}
+
+func isRemoteResource(pattern string) bool {
+	return strings.Contains(pattern, "://") ||
+		strings.HasPrefix(pattern, "git@") ||
+		strings.HasPrefix(pattern, "github.com/")
+}
+
+// detectResources lists files under base that parse as Kubernetes resources.
+// With recursive, subdirectories holding a kustomization are added as a whole
+// and not descended into; other subdirectories are searched.
+func detectResources(base string, recursive bool) ([]string, error) {
+	rf := provider.NewDefaultDepProvider().GetResourceFactory()
+
+	var paths []string
+	err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == base {
+			return nil
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return fmt.Errorf("computing relative path: %w", err)
+		}
+		if d.IsDir() {
+			if !recursive {
+				return filepath.SkipDir
+			}
+			for _, name := range konfig.RecognizedKustomizationFileNames() {
+				if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+					paths = append(paths, filepath.ToSlash(rel))
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", rel, err)
+		}
+		if _, err := rf.SliceFromBytes(content); err != nil {
+			return nil //nolint:nilerr // not a resource file
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	return paths, err //nolint:wrapcheck // the caller adds context
+}
+
+// createExec runs the kustomize binary found on PATH.
+func (s *kustomizeCreateStep) createExec(ctx StepContext, dir string) (*StepResult, error) {
+	if _, err := exec.LookPath("kustomize"); err != nil {
+		return nil, fmt.Errorf("kustomize binary not found in PATH: %w", err)
+	}
+
 	args := s.buildArgs()
 
-	slog.Info("running kustomize create", "step", s.name, "dir", dir, "args", args)
+	ctx.logger().Info("running kustomize create", "step", s.name, "dir", dir, "args", args,
+		"engine", api.KustomizeEngineExec)
 
-	cmd := exec.Command("kustomize", args...)
+	cmd := exec.CommandContext(ctx.context(), "kustomize", args...)
 	cmd.Dir = filepath.Join(ctx.WorkDir, dir)
 
 	var stderr bytes.Buffer
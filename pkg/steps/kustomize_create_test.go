@@ -18,8 +18,6 @@ func skipWithoutKustomizeCreate(t *testing.T) {
 }
 
 func TestKustomizeCreateStep_Autodetect(t *testing.T) {
-	skipWithoutKustomizeCreate(t)
-
 	dir := t.TempDir()
 	writeTestFile(t, dir, "deployment.yaml", `apiVersion: apps/v1
 kind: Deployment
@@ -59,8 +57,6 @@ spec:
 }
 
 func TestKustomizeCreateStep_Resources(t *testing.T) {
-	skipWithoutKustomizeCreate(t)
-
 	dir := t.TempDir()
 	writeTestFile(t, dir, "service.yaml", `apiVersion: v1
 kind: Service
@@ -90,8 +86,6 @@ spec:
 }
 
 func TestKustomizeCreateStep_AllFlags(t *testing.T) {
-	skipWithoutKustomizeCreate(t)
-
 	dir := t.TempDir()
 	writeTestFile(t, dir, "cm.yaml", `apiVersion: v1
 kind: ConfigMap
@@ -136,6 +130,7 @@ func TestKustomizeCreateStep_MissingBinary(t *testing.T) {
 
 	step := NewKustomizeCreateStep("create", &api.KustomizeCreateConfig{
 		Autodetect: true,
+		Engine:     api.KustomizeEngineExec,
 	})
 
 	_, err := step.Run(StepContext{WorkDir: t.TempDir()})
@@ -147,6 +142,113 @@ func TestKustomizeCreateStep_MissingBinary(t *testing.T) {
 	}
 }
 
+func TestKustomizeCreateStep_Exec(t *testing.T) {
+	skipWithoutKustomizeCreate(t)
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test-cm\n")
+
+	step := NewKustomizeCreateStep("create", &api.KustomizeCreateConfig{
+		Resources: []string{"cm.yaml"},
+		Engine:    api.KustomizeEngineExec,
+	})
+	if _, err := step.Run(StepContext{WorkDir: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("kustomization.yaml not created: %v", err)
+	}
+	if !strings.Contains(string(content), "cm.yaml") {
+		t.Errorf("expected kustomization.yaml to list cm.yaml, got:\n%s", content)
+	}
+}
+
+func TestKustomizeCreateStep_BuiltinOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test-cm\n")
+	writeTestFile(t, dir, "values.yaml", "replicas: 3\n")
+	writeTestFile(t, dir, "svc.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: svc\n")
+
+	step := NewKustomizeCreateStep("create", &api.KustomizeCreateConfig{
+		Autodetect:  true,
+		Resources:   []string{"svc.yaml"},
+		Namespace:   "staging",
+		NamePrefix:  "acme-",
+		Annotations: map[string]string{"team": "platform"},
+		Labels:      map[string]string{"env": "production"},
+	})
+	if _, err := step.Run(StepContext{WorkDir: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dir, "kustomization.yaml"), `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+    - svc.yaml
+    - cm.yaml
+namePrefix: acme-
+namespace: staging
+commonLabels:
+    env: production
+commonAnnotations:
+    team: platform
+`)
+}
+
+func TestKustomizeCreateStep_BuiltinRecursive(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test-cm\n")
+	for _, sub := range []string{"base", "extra"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "base"), "kustomization.yaml", "resources: []\n")
+	writeTestFile(t, filepath.Join(dir, "base"), "ignored.yaml", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n")
+	writeTestFile(t, filepath.Join(dir, "extra"), "svc.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: svc\n")
+
+	step := NewKustomizeCreateStep("create", &api.KustomizeCreateConfig{Autodetect: true, Recursive: true})
+	if _, err := step.Run(StepContext{WorkDir: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertFileContent(t, filepath.Join(dir, "kustomization.yaml"), `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+    - base
+    - cm.yaml
+    - extra/svc.yaml
+`)
+}
+
+func TestKustomizeCreateStep_BuiltinErrors(t *testing.T) {
+	t.Run("existing kustomization", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "kustomization.yaml", "resources: []\n")
+		_, err := NewKustomizeCreateStep("create", &api.KustomizeCreateConfig{Autodetect: true}).Run(StepContext{WorkDir: dir})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Fatalf("expected already exists error, got %v", err)
+		}
+	})
+	t.Run("unmatched resource", func(t *testing.T) {
+		_, err := NewKustomizeCreateStep("create", &api.KustomizeCreateConfig{Resources: []string{"missing.yaml"}}).Run(StepContext{WorkDir: t.TempDir()})
+		if err == nil || !strings.Contains(err.Error(), "missing.yaml has no match") {
+			t.Fatalf("expected no match error, got %v", err)
+		}
+	})
+}
+
+func TestGlobResources_KeepsRemoteTargets(t *testing.T) {
+	got, err := globResources(t.TempDir(), []string{"https://github.com/org/repo//deploy?ref=v1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0] != "https://github.com/org/repo//deploy?ref=v1" {
+		t.Errorf("unexpected resources: %v", got)
+	}
+}
+
 func TestFormatMapFlag(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1,6 +1,7 @@
 package steps
 
 import (
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -55,7 +56,7 @@ resources:
 				t.Fatal(err)
 			}
 
-			cleanup := collectKustomizeCleanup(dir)
+			cleanup := collectKustomizeCleanup(slog.Default(), dir)
 			sort.Strings(cleanup)
 
 			if len(cleanup) != len(tt.expected) {
@@ -71,7 +72,7 @@ resources:
 }
 
 func TestCollectKustomizeCleanup_NoFile(t *testing.T) {
-	cleanup := collectKustomizeCleanup(t.TempDir())
+	cleanup := collectKustomizeCleanup(slog.Default(), t.TempDir())
 	if cleanup != nil {
 		t.Errorf("expected nil cleanup for missing kustomization.yaml, got %v", cleanup)
 	}
@@ -85,8 +86,6 @@ func skipWithoutKustomize(t *testing.T) {
 }
 
 func TestKustomizeStep_Run(t *testing.T) {
-	skipWithoutKustomize(t)
-
 	dir := t.TempDir()
 	writeTestFile(t, dir, "kustomization.yaml", `apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
@@ -120,8 +119,6 @@ data:
 }
 
 func TestKustomizeStep_RunSubdir(t *testing.T) {
-	skipWithoutKustomize(t)
-
 	dir := t.TempDir()
 	sub := filepath.Join(dir, "overlay")
 	if err := os.MkdirAll(sub, 0o750); err != nil {
@@ -155,8 +152,6 @@ spec:
 }
 
 func TestKustomizeStep_RunInvalidDir(t *testing.T) {
-	skipWithoutKustomize(t)
-
 	_, err := NewKustomizeBuildStep("build", &api.KustomizeBuildConfig{Dir: "nonexistent"}).Run(StepContext{WorkDir: t.TempDir()})
 	if err == nil {
 		t.Fatal("expected error for nonexistent kustomize dir")
@@ -167,8 +162,6 @@ func TestKustomizeStep_RunInvalidDir(t *testing.T) {
 }
 
 func TestKustomizeStep_OutputFile(t *testing.T) {
-	skipWithoutKustomize(t)
-
 	dir := t.TempDir()
 	writeTestFile(t, dir, "kustomization.yaml", `apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
@@ -200,8 +193,6 @@ data:
 }
 
 func TestKustomizeStep_DefaultDir(t *testing.T) {
-	skipWithoutKustomize(t)
-
 	dir := t.TempDir()
 	writeTestFile(t, dir, "kustomization.yaml", `apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
@@ -229,3 +220,88 @@ data:
 		t.Error("output should contain the secret")
 	}
 }
+
+func TestKustomizeStep_RunExec(t *testing.T) {
+	skipWithoutKustomize(t)
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "kustomization.yaml", `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - configmap.yaml
+`)
+	writeTestFile(t, dir, "configmap.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-cm
+`)
+
+	step := NewKustomizeBuildStep("build", &api.KustomizeBuildConfig{OutputFile: "out.yaml", Engine: api.KustomizeEngineExec})
+	if _, err := step.Run(StepContext{WorkDir: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "out.yaml"))
+	if err != nil {
+		t.Fatalf("expected output file to exist: %v", err)
+	}
+	if !strings.Contains(string(content), "test-cm") {
+		t.Error("output file should contain configmap name")
+	}
+}
+
+func TestKustomizeStep_ExecMissingBinary(t *testing.T) {
+	if _, err := exec.LookPath("kustomize"); err == nil {
+		t.Skip("kustomize is available, skipping missing binary test")
+	}
+
+	step := NewKustomizeBuildStep("build", &api.KustomizeBuildConfig{OutputFile: "out.yaml", Engine: api.KustomizeEngineExec})
+	_, err := step.Run(StepContext{WorkDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "kustomize binary not found") {
+		t.Fatalf("expected missing binary error, got %v", err)
+	}
+}
+
+func TestKustomizeStep_BuiltinMissingHelm(t *testing.T) {
+	if _, err := exec.LookPath("helm"); err == nil {
+		t.Skip("helm is available, skipping missing binary test")
+	}
+
+	step := NewKustomizeBuildStep("build", &api.KustomizeBuildConfig{OutputFile: "out.yaml", EnableHelm: true})
+	_, err := step.Run(StepContext{WorkDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "enableHelm requires the helm binary") {
+		t.Fatalf("expected missing helm error, got %v", err)
+	}
+}
+
+func TestKustomizeStep_BuiltinAppliesTransformers(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "kustomization.yaml", `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: staging
+namePrefix: acme-
+resources:
+  - configmap.yaml
+`)
+	writeTestFile(t, dir, "configmap.yaml", `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-cm
+`)
+
+	step := NewKustomizeBuildStep("build", &api.KustomizeBuildConfig{OutputFile: "out.yaml"})
+	if _, err := step.Run(StepContext{WorkDir: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dir, "out.yaml"), `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: acme-test-cm
+  namespace: staging
+`)
+}
+
+func TestKustomizeVersion(t *testing.T) {
+	if v := KustomizeVersion(); v == "" {
+		t.Error("expected a non-empty kustomize version")
+	}
+}
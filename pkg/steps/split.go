@@ -50,7 +50,7 @@ func (s *splitStep) Run(ctx StepContext) (*StepResult, error) {
 		return nil, fmt.Errorf("parsing multi-doc YAML: %w", err)
 	}
 
-	slog.Info("split step", "step", s.name, "manifests", len(manifests), "strategy", s.cfg.By)
+	ctx.logger().Info("split step", "step", s.name, "manifests", len(manifests), "strategy", s.cfg.By)
 
 	strategy, err := getStrategy(s.cfg.By)
 	if err != nil {
@@ -68,14 +68,14 @@ func (s *splitStep) Run(ctx StepContext) (*StepResult, error) {
 	}
 	outputDir = filepath.Join(ctx.WorkDir, outputDir)
 
-	if err := writeAssignments(outputDir, assignments); err != nil {
+	if err := writeAssignments(ctx.logger(), outputDir, assignments); err != nil {
 		return nil, err
 	}
 
 	return &StepResult{}, nil
 }
 
-func writeAssignments(outputDir string, assignments map[string][]Manifest) error {
+func writeAssignments(log *slog.Logger, outputDir string, assignments map[string][]Manifest) error {
 	for relPath, docs := range assignments {
 		absPath := filepath.Join(outputDir, relPath)
 		if err := os.MkdirAll(filepath.Dir(absPath), 0o750); err != nil {
@@ -87,7 +87,7 @@ func writeAssignments(outputDir string, assignments map[string][]Manifest) error
 		if err := os.WriteFile(absPath, data, 0o600); err != nil {
 			return fmt.Errorf("writing %s: %w", relPath, err)
 		}
-		slog.Debug("split wrote file", "path", relPath, "manifests", len(docs))
+		log.Debug("split wrote file", "path", relPath, "manifests", len(docs))
 	}
 	return nil
 }
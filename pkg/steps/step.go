@@ -1,10 +1,33 @@
 package steps
 
+import (
+	"context"
+	"log/slog"
+)
+
 // StepContext provides the runtime context for a step.
 type StepContext struct {
 	WorkDir      string
 	SourceDir    string
 	TemplateData map[string]any
+	Log          *slog.Logger    // optional; attributes log lines to a pipeline
+	Context      context.Context // optional; cancels external commands
+}
+
+// logger returns the step's logger, falling back to the default logger.
+func (c StepContext) logger() *slog.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return slog.Default()
+}
+
+// context returns the step's context, falling back to context.Background.
+func (c StepContext) context() context.Context {
+	if c.Context != nil {
+		return c.Context
+	}
+	return context.Background()
 }
 
 // StepResult holds the output of a step.
@@ -32,10 +32,10 @@ func (s *templateStep) Run(ctx StepContext) (*StepResult, error) {
 		return nil, fmt.Errorf("filtering files: %w", err)
 	}
 
-	slog.Info("template step processing files", "step", s.name, "count", len(files))
+	ctx.logger().Info("template step processing files", "step", s.name, "count", len(files))
 
 	for _, file := range files {
-		if err := processFile(ctx.WorkDir, file, ctx.TemplateData); err != nil {
+		if err := processFile(ctx.logger(), ctx.WorkDir, file, ctx.TemplateData); err != nil {
 			return nil, fmt.Errorf("processing %s: %w", file, err)
 		}
 	}
@@ -89,7 +89,7 @@ func filterFiles(fsys fs.FS, include, exclude []string) ([]string, error) {
 	return result, nil
 }
 
-func processFile(workDir, filename string, data map[string]any) error {
+func processFile(log *slog.Logger, workDir, filename string, data map[string]any) error {
 	absPath := filepath.Join(workDir, filename)
 
 	content, err := os.ReadFile(absPath)
@@ -119,6 +119,6 @@ func processFile(workDir, filename string, data map[string]any) error {
 		return fmt.Errorf("executing template: %w", execErr)
 	}
 
-	slog.Debug("template rendered", "file", filename)
+	log.Debug("template rendered", "file", filename)
 	return nil
 }